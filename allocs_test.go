@@ -0,0 +1,82 @@
+package workq
+
+import (
+	"testing"
+)
+
+// Max allocations per command on the hot paths, the measured counts. Lower
+// them along with encoder and parser improvements.
+var allocBudgets = []struct {
+	name   string
+	budget float64
+	setup  func() func()
+}{
+	{"add", 0, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte("+OK\r\n")})
+		j := &BgJob{
+			ID:      "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+			Name:    "j1",
+			TTR:     5000,
+			TTL:     60000,
+			Payload: []byte("a"),
+		}
+		return func() { client.Add(j) }
+	}},
+	{"add-flags", 0, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte("+OK\r\n")})
+		j := &BgJob{
+			ID:          "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+			Name:        "j1",
+			TTR:         5000,
+			TTL:         60000,
+			Payload:     []byte("a"),
+			Priority:    10,
+			MaxAttempts: 3,
+		}
+		return func() { client.Add(j) }
+	}},
+	{"lease", 4, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+				"a\r\n",
+		)})
+		names := []string{"j1"}
+		return func() { client.Lease(names, 1000) }
+	}},
+	{"lease-names", 5, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+				"a\r\n",
+		)})
+		names := []string{"j1", "j2"}
+		return func() { client.Lease(names, 1000) }
+	}},
+	{"result", 3, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 1 1\r\n" +
+				"a\r\n",
+		)})
+		return func() { client.Result("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 1000) }
+	}},
+	{"complete", 0, func() func() {
+		client := NewClient(&TestRepeatConn{resp: []byte("+OK\r\n")})
+		result := []byte("a")
+		return func() { client.Complete("6ba7b810-9dad-11d1-80b4-00c04fd430c4", result) }
+	}},
+}
+
+func TestAllocBudgets(t *testing.T) {
+	if raceEnabled {
+		t.Skip("Allocations differ under the race detector")
+	}
+
+	for _, tt := range allocBudgets {
+		allocs := testing.AllocsPerRun(100, tt.setup())
+		if allocs > tt.budget {
+			t.Fatalf("Allocs mismatch, cmd=%s, allocs=%v, budget=%v", tt.name, allocs, tt.budget)
+		}
+	}
+}
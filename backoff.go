@@ -0,0 +1,32 @@
+package workq
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// Bounds of the backoff between dial retries.
+	minDialBackoff = 50 * time.Millisecond
+	maxDialBackoff = 2 * time.Second
+
+	// Default bounds of the backoff between command retries, see RetryPolicy.
+	minRetryBackoff = 50 * time.Millisecond
+	maxRetryBackoff = 2 * time.Second
+)
+
+// JitteredBackoff returns the backoff before retry n (starting at 0),
+// doubling from min up to max with the upper half randomized so many clients
+// retrying at once spread out.
+func JitteredBackoff(n int, min time.Duration, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
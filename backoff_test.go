@@ -0,0 +1,28 @@
+package workq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitteredBackoff(t *testing.T) {
+	tests := []struct {
+		n        int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{10, time.Second, 2 * time.Second},
+		{100, time.Second, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := JitteredBackoff(tt.n, 100*time.Millisecond, 2*time.Second)
+			if d < tt.min || d > tt.max {
+				t.Fatalf("Backoff out of range, n=%d, d=%s", tt.n, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package workq
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+)
+
+// Buffers larger than this are left to the garbage collector rather than
+// pinning memory in the pool, a max data block plus room for the command line.
+const maxPooledBuffer = maxDataBlock + 4096
+
+// Request encoding buffers reused across commands and clients.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// Leased job payload buffers, see WithPooledPayloads.
+var payloadPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// Write a space separated command argument.
+func writeArg(buf *bytes.Buffer, s string) {
+	buf.WriteByte(' ')
+	buf.WriteString(s)
+}
+
+// Write a space separated integer argument without going through fmt.
+func writeInt(buf *bytes.Buffer, n int) {
+	var b [20]byte
+	buf.WriteByte(' ')
+	buf.Write(strconv.AppendInt(b[:0], int64(n), 10))
+}
+
+// Write an optional integer flag, e.g. " -priority=10", omitted if 0.
+func writeFlag(buf *bytes.Buffer, name string, n int) {
+	if n == 0 {
+		return
+	}
+
+	var b [20]byte
+	buf.WriteString(" -")
+	buf.WriteString(name)
+	buf.WriteByte('=')
+	buf.Write(strconv.AppendInt(b[:0], int64(n), 10))
+}
+
+// Write the flags of a job set, in protocol order.
+func writeFlags(buf *bytes.Buffer, f JobFlags) {
+	writeFlag(buf, "priority", f.Priority)
+	writeFlag(buf, "max-attempts", f.MaxAttempts)
+	writeFlag(buf, "max-fails", f.MaxFails)
+}
+
+// Write a data block followed by the line terminator.
+func writeBlock(buf *bytes.Buffer, b []byte) {
+	buf.Write(b)
+	buf.WriteString(crnl)
+}
@@ -0,0 +1,88 @@
+package workq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLeasePooledPayload(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 3\r\n" +
+				"abc\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithPooledPayloads())
+	j, err := client.Lease([]string{"j1"}, 1000)
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if !bytes.Equal(j.Payload, []byte("abc")) || j.buf == nil {
+		t.Fatalf("Payload mismatch, job=%+v", j)
+	}
+
+	j.Release()
+	if j.Payload != nil || j.buf != nil {
+		t.Fatalf("Expected released payload, job=%+v", j)
+	}
+
+	// Release is idempotent.
+	j.Release()
+}
+
+func TestLeasePooledPayloadMalformed(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 3\r\n" +
+				"abcd\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithPooledPayloads())
+	_, err := client.Lease([]string{"j1"}, 1000)
+	if err != ErrMalformed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestReleaseUnpooled(t *testing.T) {
+	j := &LeasedJob{Payload: []byte("a")}
+	j.Release()
+	if !bytes.Equal(j.Payload, []byte("a")) {
+		t.Fatalf("Payload mismatch, act=%q", j.Payload)
+	}
+}
+
+func TestPutBufferDiscardsLarge(t *testing.T) {
+	buf := getBuffer()
+	buf.Grow(maxPooledBuffer + 1)
+	putBuffer(buf)
+
+	if getBuffer() == buf {
+		t.Fatalf("Expected large buffer to be discarded")
+	}
+}
+
+func BenchmarkLeasePooledPayload(b *testing.B) {
+	conn := &TestRepeatConn{resp: []byte(
+		"+OK 1\r\n" +
+			"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+			"a\r\n",
+	)}
+	client := NewClient(conn, WithPooledPayloads())
+	names := []string{"j1"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j, err := client.Lease(names, 1000)
+		if err != nil {
+			b.Fatalf("Response mismatch, err=%s", err)
+		}
+
+		j.Release()
+	}
+}
@@ -4,13 +4,16 @@ package workq
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net"
-	"regexp"
+	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/satori/go.uuid"
 )
@@ -19,12 +22,48 @@ var (
 	// ErrMalformed is returned when responses from workq can not be parsed
 	// due to unrecognized responses.
 	ErrMalformed = errors.New("Malformed response")
+
+	// ErrNotDialed is returned when cloning a Client created by NewClient as
+	// there is no address to dial.
+	ErrNotDialed = errors.New("Client not created by Connect")
+
+	// ErrPoisoned is returned for commands on a connection left out of sync
+	// by a previous malformed or interrupted response, see WithReconnect.
+	ErrPoisoned = errors.New("Connection out of sync")
+
+	// ErrBusy is returned instead of waiting when the max commands in flight
+	// or Clients borrowed from a Pool is reached, see WithMaxInFlight and
+	// PoolConfig.FailBusy.
+	ErrBusy = errors.New("Too many commands in flight")
+
+	// ErrInvalidID is returned by ValidateID.
+	ErrInvalidID = errors.New("Invalid ID")
+
+	// ErrInvalidName is returned by ValidateName.
+	ErrInvalidName = errors.New("Invalid name")
+
+	// ErrPayloadTooLarge is returned without sending the command when a job
+	// payload or result exceeds the max payload size, see WithMaxPayloadSize.
+	ErrPayloadTooLarge = errors.New("Payload too large")
+
+	// ErrInvalidSize is returned without sending the command for a negative
+	// size of a streamed data block.
+	ErrInvalidSize = errors.New("Invalid size")
 )
 
 const (
 	// Max Data Block that can be read within a response, 1 MiB.
 	maxDataBlock = 1048576
 
+	// Max response line length, well above any line of the protocol.
+	maxLineLen = 65536
+
+	// Response reader buffer size unless set WithReadBufferSize.
+	defaultReaderSize = 4096
+
+	// TLS handshake timeout unless set WithDialTimeout.
+	defaultHandshakeTimeout = 10 * time.Second
+
 	// Line terminator in string form.
 	crnl    = "\r\n"
 	termLen = 2
@@ -34,30 +73,149 @@ const (
 )
 
 // Client represents a single connection to Workq.
+//
+// A Client is safe for concurrent use, commands are executed one at a time
+// over the connection in the order they acquire it. Blocking commands such as
+// "lease" hold the connection until they return, use Clone for a dedicated
+// connection.
 type Client struct {
-	conn   net.Conn
+	mu     sync.Mutex // Serializes commands.
+	conn   io.ReadWriteCloser
 	rdr    *bufio.Reader
 	parser *responseParser
+
+	// Guards swapping conn on reconnect against a concurrent Close.
+	connMu sync.Mutex
+	closed bool
+
+	// Bounds commands in flight & waiting, nil if unlimited.
+	sem chan struct{}
+
+	// Address for dialing fresh connections, empty when the connection was
+	// created externally.
+	addr string
+	opts *options
+
+	// Set when the response stream can no longer be trusted to be aligned
+	// with commands sent.
+	poisoned bool
+
+	recorder *flightRecorder
+
+	// Consecutive malformed responses, see WithErrorReporter.
+	malformed int
+
+	// Contexts carrying profiler labels by command & job name.
+	labelCtxs map[labelKey]context.Context
+
+	created time.Time
 }
 
 // Connect to a Workq server returning a Client
-func Connect(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+func Connect(addr string, opts ...Option) (*Client, error) {
+	return connect(addr, newOptions(opts))
+}
+
+func connect(addr string, o *options) (*Client, error) {
+	conn, err := o.dial(addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewClient(conn), nil
+	c := newClient(conn, o)
+	c.addr = addr
+	if err := c.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c.publish(Event{Type: EventConnected})
+	return c, nil
+}
+
+// Authenticate a freshly dialed connection if configured, see WithAuth.
+// Written directly to the connection to keep the token out of the flight
+// recorder, slow command log and events.
+func (c *Client) handshake() error {
+	if c.opts.auth == "" {
+		return nil
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("auth")
+	writeInt(buf, len(c.opts.auth))
+	buf.WriteString(crnl)
+	writeBlock(buf, []byte(c.opts.auth))
+	if err := c.write(&request{data: buf.Bytes()}); err != nil {
+		return NewNetError(err.Error())
+	}
+
+	return c.parser.parseOk()
+}
+
+// Clone dials a new connection to the same address with the same options,
+// e.g. for a dedicated connection to block on "lease".
+// Returns ErrNotDialed if the Client was not created by Connect.
+func (c *Client) Clone() (*Client, error) {
+	if c.addr == "" {
+		return nil, ErrNotDialed
+	}
+
+	return connect(c.addr, c.opts)
 }
 
-// NewClient returns a Client from a net.Conn.
-func NewClient(conn net.Conn) *Client {
-	rdr := bufio.NewReader(conn)
-	return &Client{
-		conn:   conn,
-		rdr:    rdr,
-		parser: &responseParser{rdr: rdr},
+// NewClient returns a Client from a net.Conn or any other io.ReadWriteCloser
+// transport such as an in-process pipe or a multiplexed stream.
+// Options for dialing are ignored.
+func NewClient(conn io.ReadWriteCloser, opts ...Option) *Client {
+	return newClient(conn, newOptions(opts))
+}
+
+func newClient(conn io.ReadWriteCloser, o *options) *Client {
+	c := &Client{
+		conn:    conn,
+		opts:    o,
+		created: o.clock.Now(),
+	}
+	if o.flightRecorder > 0 {
+		c.recorder = newFlightRecorder(o.flightRecorder, o.clock)
+		c.recorder.redact = o.redactor
 	}
+	if o.maxInFlight > 0 {
+		c.sem = make(chan struct{}, o.maxInFlight)
+	}
+
+	size := o.readerSize
+	if size <= 0 {
+		size = defaultReaderSize
+	}
+	c.rdr = bufio.NewReaderSize(c.reader(conn), size)
+	c.parser = &responseParser{
+		rdr:            c.rdr,
+		pooledPayloads: o.pooledPayloads,
+		lenient:        o.parseMode == ParseLenient,
+	}
+	return c
+}
+
+// Reader for responses, recording received frames if enabled.
+func (c *Client) reader(conn io.Reader) io.Reader {
+	if c.recorder == nil {
+		return conn
+	}
+
+	return &recordingReader{rdr: conn, recorder: c.recorder}
+}
+
+// DebugDump returns the last frames sent & received, oldest first.
+// Returns nil unless enabled through WithFlightRecorder.
+func (c *Client) DebugDump() []Frame {
+	if c.recorder == nil {
+		return nil
+	}
+
+	return c.recorder.frames()
 }
 
 // "add" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#add
@@ -66,37 +224,29 @@ func NewClient(conn net.Conn) *Client {
 // Returns ResponseError for Workq response errors.
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
+// Returns ErrPayloadTooLarge if the payload exceeds the max payload size.
+// Returns LintError for suspicious jobs if created WithStrictJobs.
 func (c *Client) Add(j *BgJob) error {
-	var flagsPad string
-	var flags []string
-	if j.Priority != 0 {
-		flags = append(flags, fmt.Sprintf("-priority=%d", j.Priority))
-	}
-	if j.MaxAttempts != 0 {
-		flags = append(flags, fmt.Sprintf("-max-attempts=%d", j.MaxAttempts))
-	}
-	if j.MaxFails != 0 {
-		flags = append(flags, fmt.Sprintf("-max-fails=%d", j.MaxFails))
-	}
-	if len(flags) > 0 {
-		flagsPad = " "
-	}
-	r := []byte(fmt.Sprintf(
-		"add %s %s %d %d %d%s"+crnl+"%s"+crnl,
-		j.ID,
-		j.Name,
-		j.TTR,
-		j.TTL,
-		len(j.Payload),
-		flagsPad+strings.Join(flags, " "),
-		j.Payload,
-	))
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return NewNetError(err.Error())
+	if err := c.checkSize(j.Payload); err != nil {
+		return err
+	}
+	if err := c.lint(j); err != nil {
+		return err
 	}
 
-	return c.parser.parseOk()
+	id := jobID(j.ID, j.UUID)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("add")
+	writeArg(buf, id)
+	writeArg(buf, j.Name)
+	writeInt(buf, j.TTR)
+	writeInt(buf, j.TTL)
+	writeInt(buf, len(j.Payload))
+	writeFlags(buf, j.Flags())
+	buf.WriteString(crnl)
+	writeBlock(buf, j.Payload)
+	return c.do(&request{name: "add", id: id, job: j.Name, data: buf.Bytes()}, c.parser.parseOk)
 }
 
 // "run" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#run
@@ -105,37 +255,54 @@ func (c *Client) Add(j *BgJob) error {
 // Returns ResponseError for Workq response errors
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
+// Returns ErrPayloadTooLarge if the payload exceeds the max payload size.
+// Returns LintError for suspicious jobs if created WithStrictJobs.
 func (c *Client) Run(j *FgJob) (*JobResult, error) {
-	var flags string
-	if j.Priority != 0 {
-		flags = fmt.Sprintf(" -priority=%d", j.Priority)
-	}
-	r := []byte(fmt.Sprintf(
-		"run %s %s %d %d %d%s"+crnl+"%s"+crnl,
-		j.ID,
-		j.Name,
-		j.TTR,
-		j.Timeout,
-		len(j.Payload),
-		flags,
-		j.Payload,
-	))
-
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return nil, NewNetError(err.Error())
-	}
+	var result *JobResult
+	err := c.run(j, func() error {
+		err := c.parser.parseSingleReply()
+		if err != nil {
+			return err
+		}
 
-	count, err := c.parser.parseOkWithReply()
-	if err != nil {
-		return nil, err
-	}
+		result, err = c.parser.readResult()
+		return err
+	})
+	return result, err
+}
 
-	if count != 1 {
-		return nil, ErrMalformed
+// RunResults is Run accepting any number of results in the reply, which the
+// protocol reserves for future use. Results are returned in reply order.
+func (c *Client) RunResults(j *FgJob) ([]*JobResult, error) {
+	var results []*JobResult
+	err := c.run(j, func() (err error) {
+		results, err = c.parser.readResults()
+		return err
+	})
+	return results, err
+}
+
+func (c *Client) run(j *FgJob, read func() error) error {
+	if err := c.checkSize(j.Payload); err != nil {
+		return err
+	}
+	if err := c.lint(j); err != nil {
+		return err
 	}
 
-	return c.parser.readResult()
+	id := jobID(j.ID, j.UUID)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("run")
+	writeArg(buf, id)
+	writeArg(buf, j.Name)
+	writeInt(buf, j.TTR)
+	writeInt(buf, j.Timeout)
+	writeInt(buf, len(j.Payload))
+	writeFlags(buf, j.Flags())
+	buf.WriteString(crnl)
+	writeBlock(buf, j.Payload)
+	return c.do(&request{name: "run", id: id, job: j.Name, data: buf.Bytes()}, read)
 }
 
 // "schedule" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#schedule
@@ -144,38 +311,30 @@ func (c *Client) Run(j *FgJob) (*JobResult, error) {
 // Returns ResponseError for Workq response errors.
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
+// Returns ErrPayloadTooLarge if the payload exceeds the max payload size.
+// Returns LintError for suspicious jobs if created WithStrictJobs.
 func (c *Client) Schedule(j *ScheduledJob) error {
-	var flagsPad string
-	var flags []string
-	if j.Priority != 0 {
-		flags = append(flags, fmt.Sprintf("-priority=%d", j.Priority))
-	}
-	if j.MaxAttempts != 0 {
-		flags = append(flags, fmt.Sprintf("-max-attempts=%d", j.MaxAttempts))
-	}
-	if j.MaxFails != 0 {
-		flags = append(flags, fmt.Sprintf("-max-fails=%d", j.MaxFails))
-	}
-	if len(flags) > 0 {
-		flagsPad = " "
-	}
-	r := []byte(fmt.Sprintf(
-		"schedule %s %s %d %d %s %d%s"+crnl+"%s"+crnl,
-		j.ID,
-		j.Name,
-		j.TTR,
-		j.TTL,
-		j.Time,
-		len(j.Payload),
-		flagsPad+strings.Join(flags, " "),
-		j.Payload,
-	))
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return NewNetError(err.Error())
+	if err := c.checkSize(j.Payload); err != nil {
+		return err
+	}
+	if err := c.lint(j); err != nil {
+		return err
 	}
 
-	return c.parser.parseOk()
+	id := jobID(j.ID, j.UUID)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("schedule")
+	writeArg(buf, id)
+	writeArg(buf, j.Name)
+	writeInt(buf, j.TTR)
+	writeInt(buf, j.TTL)
+	writeArg(buf, c.opts.scheduleTime(j))
+	writeInt(buf, len(j.Payload))
+	writeFlags(buf, j.Flags())
+	buf.WriteString(crnl)
+	writeBlock(buf, j.Payload)
+	return c.do(&request{name: "schedule", id: id, job: j.Name, data: buf.Bytes()}, c.parser.parseOk)
 }
 
 // "result" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#result
@@ -185,25 +344,39 @@ func (c *Client) Schedule(j *ScheduledJob) error {
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
 func (c *Client) Result(id string, timeout int) (*JobResult, error) {
-	r := []byte(fmt.Sprintf(
-		"result %s %d"+crnl,
-		id,
-		timeout,
-	))
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return nil, NewNetError(err.Error())
-	}
+	var result *JobResult
+	err := c.result(id, timeout, func() error {
+		err := c.parser.parseSingleReply()
+		if err != nil {
+			return err
+		}
 
-	count, err := c.parser.parseOkWithReply()
-	if err != nil {
-		return nil, err
-	}
-	if count != 1 {
-		return nil, ErrMalformed
-	}
+		result, err = c.parser.readResult()
+		return err
+	})
+	return result, err
+}
+
+// Results is Result accepting any number of results in the reply, which the
+// protocol reserves for future use, e.g. batched results. Results are
+// returned in reply order.
+func (c *Client) Results(id string, timeout int) ([]*JobResult, error) {
+	var results []*JobResult
+	err := c.result(id, timeout, func() (err error) {
+		results, err = c.parser.readResults()
+		return err
+	})
+	return results, err
+}
 
-	return c.parser.readResult()
+func (c *Client) result(id string, timeout int, read func() error) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("result")
+	writeArg(buf, id)
+	writeInt(buf, timeout)
+	buf.WriteString(crnl)
+	return c.do(&request{name: "result", id: id, data: buf.Bytes()}, read)
 }
 
 // "lease" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#lease
@@ -213,26 +386,63 @@ func (c *Client) Result(id string, timeout int) (*JobResult, error) {
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
 func (c *Client) Lease(names []string, timeout int) (*LeasedJob, error) {
-	r := []byte(fmt.Sprintf(
-		"lease %s %d"+crnl,
-		strings.Join(names, " "),
-		timeout,
-	))
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("lease")
+	for _, name := range names {
+		writeArg(buf, name)
+	}
+	writeInt(buf, timeout)
+	buf.WriteString(crnl)
 
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return nil, NewNetError(err.Error())
+	var job *LeasedJob
+	err := c.do(&request{name: "lease", job: strings.Join(names, ","), data: buf.Bytes()}, func() error {
+		err := c.parser.parseSingleReply()
+		if err != nil {
+			return err
+		}
+
+		job, err = c.parser.readLeasedJob()
+		return err
+	})
+	return job, err
+}
+
+// LeaseTo is Lease streaming the payload of the leased job into sink instead
+// of buffering it in memory, e.g. into a file or a decoder.
+// Returns the error of sink if it fails, after reading the rest of the
+// payload off the connection to keep it in sync.
+func (c *Client) LeaseTo(names []string, timeout int, sink io.Writer) (*LeasedJobMeta, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("lease")
+	for _, name := range names {
+		writeArg(buf, name)
 	}
+	writeInt(buf, timeout)
+	buf.WriteString(crnl)
 
-	count, err := c.parser.parseOkWithReply()
+	var meta *LeasedJobMeta
+	var sinkErr error
+	err := c.do(&request{name: "lease", job: strings.Join(names, ","), data: buf.Bytes()}, func() error {
+		err := c.parser.parseSingleReply()
+		if err != nil {
+			return err
+		}
+
+		meta = &LeasedJobMeta{}
+		if err := c.parser.readLeasedJobMeta(meta); err != nil {
+			return err
+		}
+
+		sinkErr, err = c.parser.copyBlock(sink, meta.Size)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	if count != 1 {
-		return nil, ErrMalformed
-	}
 
-	return c.parser.readLeasedJob()
+	return meta, sinkErr
 }
 
 // "complete" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#complete
@@ -241,19 +451,43 @@ func (c *Client) Lease(names []string, timeout int) (*LeasedJob, error) {
 // Returns ResponseError for Workq response errors.
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
+// Returns ErrPayloadTooLarge if the payload exceeds the max payload size.
 func (c *Client) Complete(id string, result []byte) error {
-	r := []byte(fmt.Sprintf(
-		"complete %s %d"+crnl+"%s"+crnl,
-		id,
-		len(result),
-		result,
-	))
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return NewNetError(err.Error())
+	if err := c.checkSize(result); err != nil {
+		return err
 	}
 
-	return c.parser.parseOk()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("complete")
+	writeArg(buf, id)
+	writeInt(buf, len(result))
+	buf.WriteString(crnl)
+	writeBlock(buf, result)
+	return c.do(&request{name: "complete", id: id, data: buf.Bytes()}, c.parser.parseOk)
+}
+
+// CompleteFrom is Complete streaming a result of size bytes from r to the
+// server without buffering it in memory, e.g. a large result written to a
+// file by the job.
+// Returns NetError if r ends or fails before size bytes were read, as the
+// connection is left out of sync.
+// Returns ErrPayloadTooLarge if size exceeds the max payload size.
+func (c *Client) CompleteFrom(id string, size int64, r io.Reader) error {
+	if size < 0 {
+		return ErrInvalidSize
+	}
+	if err := c.checkLen(size); err != nil {
+		return err
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("complete")
+	writeArg(buf, id)
+	writeInt(buf, int(size))
+	buf.WriteString(crnl)
+	return c.do(&request{name: "complete", id: id, data: buf.Bytes(), body: r, size: size}, c.parser.parseOk)
 }
 
 // "fail" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#fail
@@ -262,19 +496,20 @@ func (c *Client) Complete(id string, result []byte) error {
 // Returns ResponseError for Workq response errors.
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
+// Returns ErrPayloadTooLarge if the payload exceeds the max payload size.
 func (c *Client) Fail(id string, result []byte) error {
-	r := []byte(fmt.Sprintf(
-		"fail %s %d"+crnl+"%s"+crnl,
-		id,
-		len(result),
-		result,
-	))
-	_, err := c.conn.Write(r)
-	if err != nil {
-		return NewNetError(err.Error())
+	if err := c.checkSize(result); err != nil {
+		return err
 	}
 
-	return c.parser.parseOk()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("fail")
+	writeArg(buf, id)
+	writeInt(buf, len(result))
+	buf.WriteString(crnl)
+	writeBlock(buf, result)
+	return c.do(&request{name: "fail", id: id, data: buf.Bytes()}, c.parser.parseOk)
 }
 
 // "delete" command: https://github.com/iamduo/workq/blob/master/doc/protocol.md#delete
@@ -284,24 +519,288 @@ func (c *Client) Fail(id string, result []byte) error {
 // Returns NetError on any network errors.
 // Returns ErrMalformed if response can't be parsed.
 func (c *Client) Delete(id string) error {
-	r := []byte(fmt.Sprintf(
-		"delete %s"+crnl,
-		id,
-	))
-	_, err := c.conn.Write(r)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("delete")
+	writeArg(buf, id)
+	buf.WriteString(crnl)
+	return c.do(&request{name: "delete", id: id, data: buf.Bytes()}, c.parser.parseOk)
+}
+
+// Conn returns the underlying connection, nil if the transport passed to
+// NewClient is not a net.Conn.
+//
+// Advanced use only, e.g. to apply custom deadlines. Reading or writing
+// directly corrupts the state of the protocol stream.
+func (c *Client) Conn() net.Conn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	conn, _ := c.conn.(net.Conn)
+	return conn
+}
+
+// Check a payload or result against the max payload size before encoding,
+// as a server rejecting an oversized block leaves the connection desynced.
+func (c *Client) checkSize(b []byte) error {
+	return c.checkLen(int64(len(b)))
+}
+
+func (c *Client) checkLen(n int64) error {
+	max := c.opts.maxPayload
+	if max <= 0 {
+		max = maxDataBlock
+	}
+	if n > int64(max) {
+		return ErrPayloadTooLarge
+	}
+
+	return nil
+}
+
+// A single encoded command.
+type request struct {
+	name string // Command name, e.g. "add".
+	id   string // Job ID the command refers to, if any.
+	job  string // Job name(s) the command refers to, if any.
+	data []byte
+
+	// Data block streamed after data, if any, of size bytes.
+	body io.Reader
+	size int64
+}
+
+// Profiler labels attributing time spent to the command & job name.
+func (r *request) labels() pprof.LabelSet {
+	return pprof.Labels("workq_cmd", r.name, "job_name", r.job)
+}
+
+// Max labelled contexts cached per client, commands with other job names,
+// e.g. leases of many name combinations, build their labels each time.
+const maxLabelCtxs = 64
+
+type labelKey struct {
+	name string
+	job  string
+}
+
+// Context carrying the profiler labels of req, cached as building labels
+// allocates several times per command. Must be called with c.mu held.
+func (c *Client) labelContext(req *request) context.Context {
+	key := labelKey{req.name, req.job}
+	if ctx, ok := c.labelCtxs[key]; ok {
+		return ctx
+	}
+
+	ctx := pprof.WithLabels(context.Background(), req.labels())
+	if c.labelCtxs == nil {
+		c.labelCtxs = make(map[labelKey]context.Context)
+	}
+	if len(c.labelCtxs) < maxLabelCtxs {
+		c.labelCtxs[key] = ctx
+	}
+
+	return ctx
+}
+
+// Send request and read its response with read.
+//
+// Malformed responses and network errors leave the reader at an unknown
+// position within the stream, any later response would be misread. The
+// connection is marked poisoned and further commands fail with ErrPoisoned
+// or reconnect first if enabled.
+func (c *Client) do(req *request, read func() error) error {
+	if c.sem != nil {
+		if c.opts.failBusy {
+			select {
+			case c.sem <- struct{}{}:
+			default:
+				return ErrBusy
+			}
+		} else {
+			c.sem <- struct{}{}
+		}
+		defer func() { <-c.sem }()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// As pprof.Do from a background context, without building labels anew.
+	pprof.SetGoroutineLabels(c.labelContext(req))
+	defer pprof.SetGoroutineLabels(context.Background())
+	return c.exec(req, read)
+}
+
+func (c *Client) exec(req *request, read func() error) error {
+	if c.poisoned {
+		if err := c.reconnect(); err != nil {
+			return req.annotate(err)
+		}
+	}
+
+	if c.recorder != nil {
+		c.recorder.record(true, req.data)
+	}
+
+	start := c.opts.clock.Now()
+	if c.opts.slowThreshold > 0 {
+		defer c.logSlow(req, start)
+	}
+
+	c.publish(Event{Type: EventCommandStarted, Command: req.name, JobID: req.id})
+	err := req.annotate(c.roundTrip(req, read))
+	if _, ok := err.(*ResponseError); ok {
+		c.publish(Event{Type: EventResponseError, Command: req.name, JobID: req.id, Err: err})
+	}
+	c.publish(Event{
+		Type:     EventCommandFinished,
+		Command:  req.name,
+		JobID:    req.id,
+		Duration: c.opts.clock.Now().Sub(start),
+		Err:      err,
+	})
+
+	return err
+}
+
+// Write a command and read its response, poisoning the connection when the
+// response stream is no longer aligned with commands sent.
+func (c *Client) roundTrip(req *request, read func() error) error {
+	err := c.write(req)
 	if err != nil {
-		return NewNetError(err.Error())
+		c.poisoned = true
+		err = NewNetError(err.Error())
+		c.publish(Event{Type: EventDisconnected, Err: err})
+		return err
 	}
 
-	return c.parser.parseOk()
+	err = read()
+	if _, ok := err.(*NetError); ok || err == ErrMalformed {
+		c.poisoned = true
+		c.publish(Event{Type: EventDisconnected, Err: err})
+	}
+
+	if err == ErrMalformed {
+		c.malformed++
+		c.reportMalformed(req)
+	} else if _, ok := err.(*ResponseError); ok || err == nil {
+		c.malformed = 0
+	}
+
+	return err
+}
+
+func (c *Client) reportMalformed(req *request) {
+	if c.opts.reporter == nil {
+		return
+	}
+
+	c.opts.reporter.Report(ErrMalformed, map[string]string{
+		"workq_cmd":   req.name,
+		"job_id":      req.id,
+		"consecutive": strconv.Itoa(c.malformed),
+	})
+}
+
+// Write a command and its streamed data block, if any, within the write
+// deadline.
+func (c *Client) write(req *request) error {
+	n := len(req.data)
+	if req.body != nil {
+		n += int(req.size) + termLen
+	}
+
+	conn, ok := c.conn.(net.Conn)
+	if d := c.opts.writeDeadline(n); ok && d > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(d)); err != nil {
+			return err
+		}
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+
+	if _, err := c.conn.Write(req.data); err != nil || req.body == nil {
+		return err
+	}
+
+	if _, err := io.CopyN(c.conn, req.body, req.size); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(c.conn, crnl)
+	return err
+}
+
+// Log commands taking longer than the slow threshold since start.
+func (c *Client) logSlow(req *request, start time.Time) {
+	d := c.opts.clock.Now().Sub(start)
+	if d < c.opts.slowThreshold || c.opts.logger == nil {
+		return
+	}
+
+	c.opts.logger.Printf("workq: slow command %s id=%s took %s", req.name, req.id, d)
+}
+
+// Replace a poisoned connection with a freshly dialed and authenticated one.
+// Returns ErrPoisoned if reconnecting is not enabled.
+func (c *Client) reconnect() error {
+	if c.addr == "" || !c.opts.reconnect {
+		return ErrPoisoned
+	}
+
+	conn, err := c.opts.dial(c.addr)
+	if err != nil {
+		err = NewNetError(err.Error())
+		c.publish(Event{Type: EventReconnectAttempt, Err: err})
+		return err
+	}
+
+	c.connMu.Lock()
+	if c.closed {
+		c.connMu.Unlock()
+		conn.Close()
+		return ErrPoisoned
+	}
+
+	c.conn.Close()
+	c.conn = conn
+	c.rdr.Reset(c.reader(conn))
+	c.created = c.opts.clock.Now()
+	c.connMu.Unlock()
+
+	// Replay the handshake so reconnected clients are never silently
+	// unauthenticated. On failure the client stays poisoned, dialing again
+	// before the next command.
+	err = c.handshake()
+	c.publish(Event{Type: EventReconnectAttempt, Err: err})
+	if err != nil {
+		return err
+	}
+
+	c.poisoned = false
+	c.publish(Event{Type: EventConnected})
+	return nil
 }
 
 type responseParser struct {
-	rdr *bufio.Reader
+	rdr  *bufio.Reader
+	line []byte // Scratch space for lines exceeding the reader buffer.
+
+	// Read leased job payloads into buffers from payloadPool.
+	pooledPayloads bool
+
+	// Tolerate sloppy framing, see ParseLenient.
+	lenient bool
 }
 
-// Close client connection.
+// Close client connection, interrupting any command in progress.
 func (c *Client) Close() error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if !c.closed {
+		c.publish(Event{Type: EventDisconnected})
+	}
+
+	c.closed = true
 	return c.conn.Close()
 }
 
@@ -316,12 +815,11 @@ func (p *responseParser) parseOk() error {
 		return ErrMalformed
 	}
 
-	sign := string(line[0])
-	if sign == "+" && string(line[1:3]) == "OK" && len(line) == 3 {
+	if string(line) == "+OK" {
 		return nil
 	}
 
-	if sign != "-" {
+	if line[0] != '-' {
 		return ErrMalformed
 	}
 
@@ -340,17 +838,16 @@ func (p *responseParser) parseOkWithReply() (int, error) {
 		return 0, ErrMalformed
 	}
 
-	sign := string(line[0])
-	if sign == "+" && string(line[1:3]) == "OK" {
-		count, err := strconv.Atoi(string(line[4:]))
-		if err != nil {
+	if string(line[:4]) == "+OK " {
+		count, ok := parseUint(line[4:])
+		if !ok {
 			return 0, ErrMalformed
 		}
 
 		return count, nil
 	}
 
-	if sign != "-" {
+	if line[0] != '-' {
 		return 0, ErrMalformed
 	}
 
@@ -358,49 +855,120 @@ func (p *responseParser) parseOkWithReply() (int, error) {
 	return 0, err
 }
 
+// Parse "OK 1\r\n" response for commands replying with a single reply.
+func (p *responseParser) parseSingleReply() error {
+	count, err := p.parseOkWithReply()
+	if err != nil {
+		return err
+	}
+
+	if count != 1 {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
 // Read valid line terminated by "\r\n"
+// The line is only valid until the next read.
 func (p *responseParser) readLine() ([]byte, error) {
-	line, err := p.rdr.ReadBytes(byte('\n'))
+	line, err := p.rdr.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// Line exceeds the reader buffer, accumulate in scratch space.
+		p.line = append(p.line[:0], line...)
+		for err == bufio.ErrBufferFull {
+			if len(p.line) > maxLineLen {
+				return nil, ErrMalformed
+			}
+
+			line, err = p.rdr.ReadSlice('\n')
+			p.line = append(p.line, line...)
+		}
+
+		line = p.line
+	}
 	if err != nil {
 		return nil, NewNetError(err.Error())
 	}
 
-	if len(line) < termLen {
-		return nil, ErrMalformed
+	if p.lenient {
+		return bytes.TrimRight(line[:len(line)-1], "\r "), nil
 	}
 
-	if len(line) >= termLen {
-		if line[len(line)-termLen] != '\r' {
-			return nil, ErrMalformed
-		}
-
-		line = line[:len(line)-termLen]
+	if len(line) < termLen || line[len(line)-termLen] != '\r' {
+		return nil, ErrMalformed
 	}
 
-	return line, nil
+	return line[:len(line)-termLen], nil
 }
 
 // Read data block up to size terminated by "\r\n"
 func (p *responseParser) readBlock(size int) ([]byte, error) {
+	return p.readBlockInto(nil, size)
+}
+
+// Read data block into dst, reusing its capacity when large enough.
+func (p *responseParser) readBlockInto(dst []byte, size int) ([]byte, error) {
 	if size < 0 || size > maxDataBlock {
 		return nil, ErrMalformed
 	}
 
-	block := make([]byte, size)
-	n, err := io.ReadAtLeast(p.rdr, block, size)
+	var block []byte
+	if cap(dst) >= size {
+		block = dst[:size]
+	} else {
+		block = make([]byte, size)
+	}
+	n, err := io.ReadFull(p.rdr, block)
 	if n != size || err != nil {
 		return nil, ErrMalformed
 	}
 
-	b := make([]byte, termLen)
-	n, err = p.rdr.Read(b)
-	if err != nil || n != termLen || string(b) != crnl {
+	if err := p.readBlockEnd(); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// Read the "\r\n" terminating a data block.
+func (p *responseParser) readBlockEnd() error {
+	if p.lenient {
+		if term, err := p.rdr.Peek(1); err == nil && term[0] == '\n' {
+			p.rdr.Discard(1)
+			return nil
+		}
+	}
+
+	term, err := p.rdr.Peek(termLen)
+	if err != nil || string(term) != crnl {
 		// Size does not match end of line.
 		// Trailing garbage is not allowed.
-		return nil, ErrMalformed
+		return ErrMalformed
 	}
 
-	return block, nil
+	p.rdr.Discard(termLen)
+	return nil
+}
+
+// Read "+OK <count>" followed by count job results.
+func (p *responseParser) readResults() ([]*JobResult, error) {
+	count, err := p.parseOkWithReply()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*JobResult{}
+	for i := 0; i < count; i++ {
+		result, err := p.readResult()
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
 }
 
 // Read job result consisting of 2 separate terminated lines.
@@ -408,26 +976,35 @@ func (p *responseParser) readBlock(size int) ([]byte, error) {
 // <result-block>\r\n"
 func (p *responseParser) readResult() (*JobResult, error) {
 	line, err := p.readLine()
-	split := strings.Split(string(line), " ")
-	if len(split) != 3 {
-		return nil, ErrMalformed
+	if err != nil {
+		return nil, err
 	}
 
-	if split[1] != "0" && split[1] != "1" {
+	var fields [3][]byte
+	if !splitFields(line, fields[:]) {
 		return nil, ErrMalformed
 	}
 
-	result := &JobResult{}
-	if split[1] == "1" {
+	id, err := idFromString(string(fields[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &JobResult{ID: id}
+	switch string(fields[1]) {
+	case "1":
 		result.Success = true
+	case "0":
+	default:
+		return nil, ErrMalformed
 	}
 
-	resultLen, err := strconv.ParseUint(split[2], 10, 64)
-	if err != nil {
+	resultLen, ok := parseUint(fields[2])
+	if !ok {
 		return nil, ErrMalformed
 	}
 
-	result.Result, err = p.readBlock(int(resultLen))
+	result.Result, err = p.readBlock(resultLen)
 	if err != nil {
 		return nil, err
 	}
@@ -436,86 +1013,232 @@ func (p *responseParser) readResult() (*JobResult, error) {
 }
 
 // Read leased job consisting of 2 separate terminated lines.
-// "<id> <name> <payload-length>\r\n
+// "<id> <name> <ttr> <payload-length>\r\n
 // <payload-block\r\n"
 func (p *responseParser) readLeasedJob() (*LeasedJob, error) {
-	line, err := p.readLine()
-	split := strings.Split(string(line), " ")
-	if len(split) != 4 {
-		return nil, ErrMalformed
+	var meta LeasedJobMeta
+	if err := p.readLeasedJobMeta(&meta); err != nil {
+		return nil, err
 	}
 
-	j := &LeasedJob{}
-	j.ID, err = idFromString(split[0])
-	if err != nil {
-		return nil, err
+	var err error
+	j := &LeasedJob{ID: meta.ID, Name: meta.Name, TTR: meta.TTR}
+	if !p.pooledPayloads {
+		j.Payload, err = p.readBlock(meta.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		return j, nil
 	}
 
-	j.Name, err = nameFromString(split[1])
+	j.buf = payloadPool.Get().(*[]byte)
+	j.Payload, err = p.readBlockInto(*j.buf, meta.Size)
 	if err != nil {
+		j.Release()
 		return nil, err
 	}
 
-	ttr, err := strconv.ParseInt(split[2], 10, 64)
+	return j, nil
+}
+
+// Read the "<id> <name> <ttr> <payload-length>\r\n" line of a leased job
+// into meta.
+func (p *responseParser) readLeasedJobMeta(meta *LeasedJobMeta) error {
+	line, err := p.readLine()
 	if err != nil {
-		return nil, ErrMalformed
+		return err
 	}
 
-	j.TTR = int(ttr)
+	var fields [4][]byte
+	if !splitFields(line, fields[:]) {
+		return ErrMalformed
+	}
 
-	payloadLen, err := strconv.ParseUint(split[3], 10, 64)
+	meta.ID, err = idFromString(string(fields[0]))
 	if err != nil {
-		return nil, ErrMalformed
+		return err
 	}
 
-	j.Payload, err = p.readBlock(int(payloadLen))
+	meta.Name, err = nameFromString(string(fields[1]))
 	if err != nil {
+		return err
+	}
+
+	var ok bool
+	meta.TTR, ok = parseInt(fields[2])
+	if !ok {
+		return ErrMalformed
+	}
+
+	meta.Size, ok = parseUint(fields[3])
+	if !ok || meta.Size > maxDataBlock {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+// Copy a data block of size terminated by "\r\n" into w. A failing w is
+// returned as sinkErr after reading the rest of the block.
+func (p *responseParser) copyBlock(w io.Writer, size int) (sinkErr error, err error) {
+	sink := &sinkWriter{w: w}
+	n, err := io.CopyN(sink, p.rdr, int64(size))
+	if n != int64(size) || err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := p.readBlockEnd(); err != nil {
 		return nil, err
 	}
 
-	return j, nil
+	return sink.err, nil
+}
+
+// Writer discarding writes once w failed, keeping its error.
+type sinkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *sinkWriter) Write(b []byte) (int, error) {
+	if s.err == nil {
+		_, s.err = s.w.Write(b)
+	}
+
+	return len(b), nil
 }
 
 // Parse an error from "-CODE TEXT"
 func (p *responseParser) errorFromLine(line []byte) (error, bool) {
-	split := strings.SplitN(string(line), " ", 2)
-	if len(split[0]) <= 1 {
+	code, text := line, []byte(nil)
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		code, text = line[:i], line[i+1:]
+		if len(text) == 0 {
+			return ErrMalformed, false
+		}
+	}
+
+	if len(code) <= 1 || !printable(line) {
 		return ErrMalformed, false
 	}
 
-	code := split[0][1:]
-	var text string
-	if len(split) == 2 {
-		if len(split[1]) == 0 {
-			return ErrMalformed, false
+	return NewResponseError(string(code[1:]), string(text)), true
+}
+
+// Returns whether b is free of control characters, e.g. embedded nulls.
+func printable(b []byte) bool {
+	for _, c := range b {
+		if c < ' ' || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Split line in place into exactly len(fields) space separated fields.
+// Returns false if the number of fields differs.
+func splitFields(line []byte, fields [][]byte) bool {
+	last := len(fields) - 1
+	for i := 0; i < last; i++ {
+		j := bytes.IndexByte(line, ' ')
+		if j < 0 {
+			return false
+		}
+
+		fields[i] = line[:j]
+		line = line[j+1:]
+	}
+
+	if bytes.IndexByte(line, ' ') >= 0 {
+		return false
+	}
+
+	fields[last] = line
+	return true
+}
+
+// Parse an unsigned decimal integer without allocating.
+func parseUint(b []byte) (int, bool) {
+	// Bound digits to rule out overflow.
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+
+	var n int
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
 		}
 
-		text = split[1]
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
+
+// Parse an optionally negative decimal integer without allocating.
+func parseInt(b []byte) (int, bool) {
+	if len(b) > 0 && b[0] == '-' {
+		n, ok := parseUint(b[1:])
+		return -n, ok
+	}
+
+	return parseUint(b)
+}
+
+// ValidateID returns ErrInvalidID unless id is a UUID, as enforced for IDs
+// in responses.
+func ValidateID(id string) error {
+	if _, err := uuid.FromString(id); err != nil {
+		return ErrInvalidID
 	}
 
-	return NewResponseError(code, text), true
+	return nil
 }
 
 // Return a valid ID string
 // Returns ErrMalformed if not a valid UUID.
 func idFromString(s string) (string, error) {
-	_, err := uuid.FromString(s)
-	if err != nil {
+	if ValidateID(s) != nil {
 		return "", ErrMalformed
 	}
 
 	return s, nil
 }
 
-var nameRe = regexp.MustCompile("^[a-zA-Z0-9_.-]*$")
+// Max length of a job name.
+const maxNameLen = 128
+
+// ValidateName returns ErrInvalidName unless name is 1-128 characters of
+// alphanumerics and special chars: "_", ".", "-".
+func ValidateName(name string) error {
+	if len(name) == 0 || len(name) > maxNameLen {
+		return ErrInvalidName
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+		case c == '_' || c == '.' || c == '-':
+		default:
+			return ErrInvalidName
+		}
+	}
+
+	return nil
+}
 
 // Return a valid name string
 // Returns ErrMalformed if name is not alphanumeric + special chars: "_", ".", "-"
 func nameFromString(name string) (string, error) {
-	l := len(name)
-	if l > 0 && l <= 128 && nameRe.MatchString(name) {
-		return name, nil
+	if ValidateName(name) != nil {
+		return "", ErrMalformed
 	}
 
-	return "", ErrMalformed
+	return name, nil
 }
@@ -1,9 +1,19 @@
 package workq
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -37,6 +47,88 @@ func TestConnectAndClose(t *testing.T) {
 	}
 }
 
+func TestClone(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	accepted := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			accepted <- struct{}{}
+		}
+	}()
+
+	client, err := Connect(server.Addr().String(), WithNoDelay(true))
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	clone, err := client.Clone()
+	if err != nil {
+		t.Fatalf("Unable to clone, err=%s", err)
+	}
+	defer clone.Close()
+
+	if clone == client || clone.conn == client.conn || clone.addr != client.addr || clone.opts != client.opts {
+		t.Fatalf("Clone mismatch, clone=%+v", clone)
+	}
+
+	<-accepted
+	<-accepted
+}
+
+func TestCloneNotDialed(t *testing.T) {
+	client := NewClient(&TestConn{})
+	_, err := client.Clone()
+	if err != ErrNotDialed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestClientConn(t *testing.T) {
+	conn := &TestConn{}
+	client := NewClient(conn)
+	if client.Conn() != conn {
+		t.Fatalf("Conn mismatch")
+	}
+
+	client = NewClient(&TestReadWriteCloser{})
+	if client.Conn() != nil {
+		t.Fatalf("Expected nil Conn for non net.Conn transport")
+	}
+}
+
+func TestNewClientReadWriteCloser(t *testing.T) {
+	wrt := bytes.NewBuffer([]byte(""))
+	conn := &TestReadWriteCloser{
+		Reader: bytes.NewBuffer([]byte("+OK\r\n")),
+		Writer: wrt,
+	}
+	client := NewClient(conn)
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	expWrite := []byte("delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n")
+	if !bytes.Equal(expWrite, wrt.Bytes()) {
+		t.Fatalf("Write mismatch, act=%q", wrt.Bytes())
+	}
+
+	if err = client.Close(); err != nil || !conn.closed {
+		t.Fatalf("Close mismatch, err=%v", err)
+	}
+}
+
 func TestAdd(t *testing.T) {
 	conn := &TestConn{
 		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
@@ -159,7 +251,7 @@ func TestAddErrors(t *testing.T) {
 		client := NewClient(conn)
 		j := &BgJob{}
 		err := client.Add(j)
-		if err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q", err)
 		}
 	}
@@ -276,7 +368,7 @@ func TestRunErrors(t *testing.T) {
 			Payload: []byte("a"),
 		}
 		result, err := client.Run(j)
-		if result != nil || err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if result != nil || err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, result=%v, err=%q", result, err)
 		}
 
@@ -428,7 +520,7 @@ func TestScheduleErrors(t *testing.T) {
 		client := NewClient(conn)
 		j := &ScheduledJob{}
 		err := client.Schedule(j)
-		if err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q", err)
 		}
 	}
@@ -514,7 +606,7 @@ func TestResultErrors(t *testing.T) {
 		}
 		client := NewClient(conn)
 		result, err := client.Result("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 1000)
-		if result != nil || err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if result != nil || err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
 		}
 	}
@@ -533,6 +625,63 @@ func TestResultBadConnError(t *testing.T) {
 	}
 }
 
+func TestResults(t *testing.T) {
+	id1 := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	id2 := "6ba7b811-9dad-11d1-80b4-00c04fd430c4"
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 2\r\n" +
+				id1 + " 1 1\r\na\r\n" +
+				id2 + " 0 1\r\nb\r\n" +
+				"+OK 0\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	results, err := client.Results(id1, 1000)
+	exp := []*JobResult{
+		{ID: id1, Success: true, Result: []byte("a")},
+		{ID: id2, Success: false, Result: []byte("b")},
+	}
+	if err != nil || !reflect.DeepEqual(exp, results) {
+		t.Fatalf("Results mismatch, results=%+v, err=%v", results, err)
+	}
+
+	results, err = client.RunResults(&FgJob{ID: id1, Name: "j1", TTR: 1, Timeout: 1000})
+	if err != nil || len(results) != 0 {
+		t.Fatalf("Results mismatch, results=%+v, err=%v", results, err)
+	}
+
+	expWrite := "result " + id1 + " 1000\r\n" + "run " + id1 + " j1 1 1000 0\r\n\r\n"
+	if act := conn.wrt.String(); act != expWrite {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
+
+func TestResultsErrors(t *testing.T) {
+	tests := []RespErrTestCase{
+		{
+			resp:   []byte("+OK 2\r\n6ba7b810-9dad-11d1-80b4-00c04fd430c4 0 1\r\na\r\n"),
+			expErr: NewNetError("EOF"),
+		},
+		{
+			resp:   []byte("-NOT-FOUND\r\n"),
+			expErr: NewResponseError("NOT-FOUND", ""),
+		},
+	}
+	for _, tt := range tests {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer(tt.resp),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		client := NewClient(conn)
+		results, err := client.Results("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 1000)
+		if results != nil || !reflect.DeepEqual(annotated("result", "6ba7b810-9dad-11d1-80b4-00c04fd430c4", tt.expErr), err) {
+			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
+		}
+	}
+}
+
 func TestLease(t *testing.T) {
 	conn := &TestConn{
 		rdr: bytes.NewBuffer([]byte(
@@ -666,7 +815,7 @@ func TestLeaseErrors(t *testing.T) {
 		}
 		client := NewClient(conn)
 		j, err := client.Lease([]string{"j1"}, 1000)
-		if j != nil || err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if j != nil || err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
 		}
 	}
@@ -685,6 +834,73 @@ func TestLeaseBadConnError(t *testing.T) {
 	}
 }
 
+func TestLeaseTo(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 60 3\r\n" +
+				"abc\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	var sink bytes.Buffer
+	meta, err := client.LeaseTo([]string{"j1", "j2"}, 1000, &sink)
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	exp := &LeasedJobMeta{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c4", Name: "j1", TTR: 60, Size: 3}
+	if !reflect.DeepEqual(exp, meta) || sink.String() != "abc" {
+		t.Fatalf("Lease mismatch, meta=%+v, sink=%q", meta, sink.String())
+	}
+	if conn.wrt.String() != "lease j1 j2 1000\r\n" {
+		t.Fatalf("Write mismatch, act=%s", conn.wrt.Bytes())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestLeaseToSinkError(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 60 3\r\n" +
+				"abc\r\n" +
+				"+OK\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	if _, err := client.LeaseTo([]string{"j1"}, 1000, failingWriter{}); err == nil || err.Error() != "disk full" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	// Rest of the payload was read, the connection is still in sync.
+	if err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+		t.Fatalf("Delete mismatch, err=%s", err)
+	}
+}
+
+func TestLeaseToTruncated(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 60 3\r\n" +
+				"ab",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	if _, err := client.LeaseTo([]string{"j1"}, 1000, ioutil.Discard); err != ErrMalformed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
 func TestComplete(t *testing.T) {
 	conn := &TestConn{
 		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
@@ -715,7 +931,7 @@ func TestCompleteErrors(t *testing.T) {
 		}
 		client := NewClient(conn)
 		err := client.Complete("6ba7b810-9dad-11d1-80b4-00c04fd430c4", []byte("a"))
-		if err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
 		}
 	}
@@ -730,6 +946,52 @@ func TestCompleteBadConnError(t *testing.T) {
 	}
 }
 
+func TestCompleteFrom(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	err := client.CompleteFrom("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 3, strings.NewReader("abcdef"))
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	expWrite := []byte(
+		"complete 6ba7b810-9dad-11d1-80b4-00c04fd430c4 3\r\nabc\r\n",
+	)
+	if !bytes.Equal(expWrite, conn.wrt.Bytes()) {
+		t.Fatalf("Write mismatch, act=%s", conn.wrt.Bytes())
+	}
+}
+
+func TestCompleteFromErrors(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithMaxPayloadSize(10))
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	if err := client.CompleteFrom(id, 11, strings.NewReader("")); err != ErrPayloadTooLarge {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if err := client.CompleteFrom(id, -1, strings.NewReader("")); err != ErrInvalidSize {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if conn.wrt.Len() != 0 {
+		t.Fatalf("Write mismatch, act=%s", conn.wrt.Bytes())
+	}
+
+	// Short reader leaves the connection out of sync.
+	err := client.CompleteFrom(id, 3, strings.NewReader("a"))
+	if _, ok := err.(*NetError); !ok {
+		t.Fatalf("Error mismatch, err=%+v", err)
+	}
+	if err := client.CompleteFrom(id, 1, strings.NewReader("a")); err != ErrPoisoned {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
 func TestFail(t *testing.T) {
 	conn := &TestConn{
 		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
@@ -760,7 +1022,7 @@ func TestFailErrors(t *testing.T) {
 		}
 		client := NewClient(conn)
 		err := client.Fail("6ba7b810-9dad-11d1-80b4-00c04fd430c4", []byte("a"))
-		if err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
 		}
 	}
@@ -805,7 +1067,7 @@ func TestDeleteErrors(t *testing.T) {
 		}
 		client := NewClient(conn)
 		err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
-		if err == nil || tt.expErr == nil || err.Error() != tt.expErr.Error() {
+		if err == nil || tt.expErr == nil || errText(err) != tt.expErr.Error() {
 			t.Fatalf("Response mismatch, err=%q, expErr=%q", err, tt.expErr)
 		}
 	}
@@ -820,6 +1082,401 @@ func TestDeleteBadConnError(t *testing.T) {
 	}
 }
 
+func TestPoisonedAfterMalformed(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+BAD\r\n+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != ErrMalformed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != ErrPoisoned {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	expWrite := []byte("delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n")
+	if !bytes.Equal(expWrite, conn.wrt.Bytes()) {
+		t.Fatalf("Write mismatch, act=%q", conn.wrt.Bytes())
+	}
+}
+
+func TestNotPoisonedAfterResponseError(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-NOT-FOUND\r\n+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if _, ok := err.(*ResponseError); !ok {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%v", err)
+	}
+}
+
+func TestReconnectAfterMalformed(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	go func() {
+		resps := []string{"+BAD\r\n", "+OK\r\n"}
+		for _, resp := range resps {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			buf := make([]byte, 1024)
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+			conn.Write([]byte(resp))
+		}
+	}()
+
+	client, err := Connect(server.Addr().String(), WithReconnect())
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != ErrMalformed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch after reconnect, err=%v", err)
+	}
+}
+
+func TestRequestLabels(t *testing.T) {
+	req := &request{name: "lease", job: "j1,j2"}
+	labels := make(map[string]string)
+	pprof.ForLabels(pprof.WithLabels(context.Background(), req.labels()), func(k, v string) bool {
+		labels[k] = v
+		return true
+	})
+
+	if len(labels) != 2 || labels["workq_cmd"] != "lease" || labels["job_name"] != "j1,j2" {
+		t.Fatalf("Labels mismatch, labels=%v", labels)
+	}
+}
+
+func TestLabelContextCache(t *testing.T) {
+	client := NewClient(&TestConn{})
+	req := &request{name: "lease", job: "j1"}
+	ctx := client.labelContext(req)
+	if client.labelContext(&request{name: "lease", job: "j1"}) != ctx {
+		t.Fatalf("Expected cached context")
+	}
+	if v, _ := pprof.Label(ctx, "job_name"); v != "j1" {
+		t.Fatalf("Label mismatch, job_name=%q", v)
+	}
+
+	for i := 0; i < maxLabelCtxs*2; i++ {
+		client.labelContext(&request{name: "lease", job: strconv.Itoa(i)})
+	}
+	if len(client.labelCtxs) != maxLabelCtxs {
+		t.Fatalf("Cache size mismatch, size=%d", len(client.labelCtxs))
+	}
+}
+
+func TestResultTruncatedNetError(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK 1\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	_, err := client.Result("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 1000)
+	if _, ok := err.(*NetError); !ok {
+		t.Fatalf("Error mismatch, err=%+v", err)
+	}
+}
+
+func TestLineExceedingReaderBuffer(t *testing.T) {
+	text := strings.Repeat("x", 10000)
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-SERVER-ERROR " + text + "\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	rerr, ok := err.(*ResponseError)
+	if !ok || rerr.Code() != "SERVER-ERROR" || rerr.Text() != text {
+		t.Fatalf("Error mismatch, err=%.64v", err)
+	}
+}
+
+func TestLineExceedingMaxLen(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-SERVER-ERROR " + strings.Repeat("x", maxLineLen+4096) + "\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	if err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != ErrMalformed {
+		t.Fatalf("Error mismatch, err=%.64v", err)
+	}
+}
+
+func TestErrorWithControlChars(t *testing.T) {
+	for _, resp := range []string{"-NOT-FOUND\x00\r\n", "-CLIENT-ERROR a\x00b\r\n", "-TIMEOUT \x1b[2J\r\n"} {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer([]byte(resp)),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		client := NewClient(conn)
+		if err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != ErrMalformed {
+			t.Fatalf("Error mismatch, resp=%q, err=%v", resp, err)
+		}
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	if err := ValidateID("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+		t.Fatalf("Expected valid ID, err=%s", err)
+	}
+
+	invalid := []string{"", "a", "6ba7b810-9dad-11d1-80b4-00c04fd430c", "6ba7b810-9dad-11d1-80b4-00c04fd430cz"}
+	for _, id := range invalid {
+		if err := ValidateID(id); err != ErrInvalidID {
+			t.Fatalf("Expected invalid ID, id=%q, err=%v", id, err)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	valid := []string{"a", "j1", "A_b.c-D", strings.Repeat("a", 128)}
+	for _, name := range valid {
+		if err := ValidateName(name); err != nil {
+			t.Fatalf("Expected valid name, name=%q, err=%s", name, err)
+		}
+	}
+
+	invalid := []string{"", "a b", "a*", "é", "a\x00", strings.Repeat("a", 129)}
+	for _, name := range invalid {
+		if err := ValidateName(name); err != ErrInvalidName {
+			t.Fatalf("Expected invalid name, name=%q, err=%v", name, err)
+		}
+	}
+}
+
+func BenchmarkValidateName(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ValidateName("email.send-welcome_v2")
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	conn := &TestRepeatConn{resp: []byte("+OK\r\n")}
+	client := NewClient(conn)
+	j := &BgJob{
+		ID:      "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+		Name:    "j1",
+		TTR:     5000,
+		TTL:     60000,
+		Payload: bytes.Repeat([]byte("a"), 256*1024),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.Add(j); err != nil {
+			b.Fatalf("Response mismatch, err=%s", err)
+		}
+	}
+}
+
+func BenchmarkLease(b *testing.B) {
+	conn := &TestRepeatConn{resp: []byte(
+		"+OK 1\r\n" +
+			"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+			"a\r\n",
+	)}
+	client := NewClient(conn)
+	names := []string{"j1"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Lease(names, 1000); err != nil {
+			b.Fatalf("Response mismatch, err=%s", err)
+		}
+	}
+}
+
+func BenchmarkResult(b *testing.B) {
+	conn := &TestRepeatConn{resp: []byte(
+		"+OK 1\r\n" +
+			"6ba7b810-9dad-11d1-80b4-00c04fd430c4 1 1\r\n" +
+			"a\r\n",
+	)}
+	client := NewClient(conn)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Result("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 1000); err != nil {
+			b.Fatalf("Response mismatch, err=%s", err)
+		}
+	}
+}
+
+// Serve "+OK" for every line received on a pipe, waiting for release
+// before each response if non-nil.
+func pipeOkServer(release chan struct{}) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		rdr := bufio.NewReader(server)
+		for {
+			if _, err := rdr.ReadString('\n'); err != nil {
+				return
+			}
+			if release != nil {
+				<-release
+			}
+			if _, err := server.Write([]byte("+OK\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	return client
+}
+
+func TestPayloadTooLarge(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithMaxPayloadSize(2))
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	payload := []byte("abc")
+
+	errs := []error{
+		client.Add(&BgJob{ID: id, Name: "j1", Payload: payload}),
+		client.Schedule(&ScheduledJob{ID: id, Name: "j1", Payload: payload}),
+		client.Complete(id, payload),
+		client.Fail(id, payload),
+	}
+	_, err := client.Run(&FgJob{ID: id, Name: "j1", Payload: payload})
+	errs = append(errs, err)
+	for i, err := range errs {
+		if err != ErrPayloadTooLarge {
+			t.Fatalf("Error mismatch, i=%d, err=%v", i, err)
+		}
+	}
+
+	if conn.wrt.Len() != 0 {
+		t.Fatalf("Expected nothing written, act=%q", conn.wrt.Bytes())
+	}
+}
+
+func TestPayloadTooLargeDefault(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	if err := client.Complete(id, make([]byte, maxDataBlock+1)); err != ErrPayloadTooLarge {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if err := client.Complete(id, make([]byte, maxDataBlock)); err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	client := NewClient(pipeOkServer(nil))
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+				t.Errorf("Response mismatch, err=%s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMaxInFlightBusy(t *testing.T) {
+	release := make(chan struct{})
+	client := NewClient(pipeOkServer(release), WithMaxInFlight(1, true))
+	defer client.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	}()
+
+	// Wait for the first command to occupy the only slot.
+	for len(client.sem) == 0 {
+		runtime.Gosched()
+	}
+
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != ErrBusy {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+}
+
+func TestMaxInFlightBlocks(t *testing.T) {
+	release := make(chan struct{})
+	client := NewClient(pipeOkServer(release), WithMaxInFlight(1, false))
+	defer client.Close()
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatalf("Response mismatch, err=%s", err)
+		}
+	}
+}
+
+// Error text without the command context, see request.annotate.
+func errText(err error) string {
+	switch e := err.(type) {
+	case *ResponseError:
+		return NewResponseError(e.code, e.text).Error()
+	case *NetError:
+		return NewNetError(e.text).Error()
+	}
+
+	return err.Error()
+}
+
+// Error as returned for command cmd of job id.
+func annotated(cmd string, id string, err error) error {
+	return (&request{name: cmd, id: id}).annotate(err)
+}
+
 type RespErrTestCase struct {
 	resp   []byte
 	expErr error
@@ -887,6 +1544,11 @@ func invalidCommonErrorTests() []RespErrTestCase {
 
 func invalidResultErrorTests() []RespErrTestCase {
 	return []RespErrTestCase{
+		// Invalid ID
+		{
+			resp:   []byte("+OK 1\r\n6ba7b810 1 1\r\na\r\n"),
+			expErr: ErrMalformed,
+		},
 		// Invalid reply-count
 		{
 			resp:   []byte("+OK 2\r\n6ba7b810-9dad-11d1-80b4-00c04fd430c4 0 1\r\na\r\n"),
@@ -1018,3 +1680,31 @@ func (c *TestBadWriteConn) LocalAddr() net.Addr {
 func (c *TestBadWriteConn) RemoteAddr() net.Addr {
 	return &TestAddr{}
 }
+
+type TestReadWriteCloser struct {
+	io.Reader
+	io.Writer
+	closed bool
+}
+
+func (c *TestReadWriteCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestRepeatConn replies with the same response endlessly, discarding writes.
+type TestRepeatConn struct {
+	TestConn
+	resp []byte
+	off  int
+}
+
+func (c *TestRepeatConn) Read(b []byte) (int, error) {
+	n := copy(b, c.resp[c.off:])
+	c.off = (c.off + n) % len(c.resp)
+	return n, nil
+}
+
+func (c *TestRepeatConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,68 @@
+package workq
+
+import (
+	"time"
+)
+
+// Clock is the source of time for the timers and timestamps of clients,
+// pools and workers, replaceable to test time dependent behaviour without
+// sleeping, see WithClock and workqtest.FakeClock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event timer of a Clock, as time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker delivers ticks of a Clock at intervals, as time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package, the default.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Sleep blocks for d on clock.
+func Sleep(clock Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	<-clock.NewTimer(d).C()
+}
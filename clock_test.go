@@ -0,0 +1,67 @@
+package workq
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// Clock stopped at now, timers and tickers of the system clock.
+type stoppedClock struct {
+	systemClock
+	now time.Time
+}
+
+func (c stoppedClock) Now() time.Time {
+	return c.now
+}
+
+func TestClockTimestamps(t *testing.T) {
+	clock := stoppedClock{now: time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)}
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(4)
+	defer cancel()
+
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithClock(clock), WithEventBus(bus), WithFlightRecorder(4))
+	if err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	for _, f := range client.DebugDump() {
+		if !f.Time.Equal(clock.now) {
+			t.Fatalf("Frame time mismatch, frame=%s", f)
+		}
+	}
+	if len(events) == 0 {
+		t.Fatalf("Expected events published")
+	}
+	for len(events) > 0 {
+		if e := <-events; !e.Time.Equal(clock.now) {
+			t.Fatalf("Event time mismatch, e=%+v", e)
+		}
+	}
+}
+
+func TestWaitResultClockAhead(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	// A client clock past the deadline of ctx doesn't shorten polls.
+	clock := stoppedClock{now: time.Now().Add(24 * time.Hour)}
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK 1\r\n" + id + " 1 1\r\na\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	if _, err := NewClient(conn, WithClock(clock)).WaitResult(ctx, id, 200*time.Millisecond); err != nil {
+		t.Fatalf("Result mismatch, err=%v", err)
+	}
+	if act := conn.wrt.String(); act != "result "+id+" 200\r\n" {
+		t.Fatalf("Poll mismatch, act=%q", act)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqbench"
+)
+
+func cmdBench(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	var config workqbench.Config
+	fs := newFlagSet("bench", out)
+	fs.StringVar(&config.Workload, "workload", workqbench.WorkloadAdd, "Workload: add, run or lease")
+	fs.StringVar(&config.Name, "name", "workqbench", "Job name")
+	fs.IntVar(&config.Concurrency, "c", 1, "Connections running operations")
+	fs.IntVar(&config.Requests, "n", 1000, "Operations to run, 0 runs until -d")
+	fs.DurationVar(&config.Duration, "d", 0, "Max time to run, 0 runs until -n")
+	fs.IntVar(&config.PayloadSize, "size", 0, "Payload size in bytes")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output, out)
+	if err != nil {
+		return err
+	}
+
+	config.Dial = c.Clone
+	r, err := workqbench.Run(context.Background(), config)
+	if err != nil {
+		return err
+	}
+
+	return p.print([]field{
+		{"workload", r.Workload, r.Workload},
+		{"ops", fmt.Sprint(r.Ops), r.Ops},
+		{"errors", fmt.Sprint(r.Errors), r.Errors},
+		{"elapsed", r.Elapsed.String(), r.Elapsed.Seconds()},
+		{"ops/s", fmt.Sprintf("%.1f", r.Throughput()), r.Throughput()},
+		{"p50", r.P50.String(), r.P50.Seconds()},
+		{"p90", r.P90.String(), r.P90.Seconds()},
+		{"p99", r.P99.String(), r.P99.Seconds()},
+		{"max", r.Max.String(), r.Max.Seconds()},
+	})
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/satori/go.uuid"
+)
+
+// A CLI command, args exclude the command name.
+type command struct {
+	usage string
+	desc  string
+	run   func(c *workq.Client, args []string, in io.Reader, out io.Writer) error
+}
+
+var commands map[string]*command
+
+// Max payload size accepted by the server.
+const maxPayload = 1048576
+
+func init() {
+	commands = map[string]*command{
+		"add": {
+			usage: "add [flags] <payload|->",
+			desc:  "Add background jobs, printing their IDs.",
+			run:   cmdAdd,
+		},
+		"run": {
+			usage: "run [flags] <payload>",
+			desc:  "Run a job and wait for its result.",
+			run:   cmdRun,
+		},
+		"schedule": {
+			usage: "schedule [flags] -time <UTC time> <payload>",
+			desc:  "Schedule a job at a UTC time, printing its ID.",
+			run:   cmdSchedule,
+		},
+		"result": {
+			usage: "result [-timeout d] [-output f] <id>",
+			desc:  "Get a job result.",
+			run:   cmdResult,
+		},
+		"lease": {
+			usage: "lease [-timeout d] [-output f] <name>...",
+			desc:  "Lease a job within one or more names.",
+			run:   cmdLease,
+		},
+		"complete": {
+			usage: "complete <id> <result>",
+			desc:  "Mark a job successfully completed.",
+			run:   cmdComplete,
+		},
+		"fail": {
+			usage: "fail <id> <result>",
+			desc:  "Mark a job failed.",
+			run:   cmdFail,
+		},
+		"delete": {
+			usage: "delete <id>",
+			desc:  "Delete a job.",
+			run:   cmdDelete,
+		},
+		"watch": {
+			usage: "watch [-timeout d] [-output f] <id>...",
+			desc:  "Wait for job results, printing each as it arrives.",
+			run:   cmdWatch,
+		},
+		"bench": {
+			usage: "bench [-workload w] [-c n] [-n n] [-d d] [flags]",
+			desc:  "Benchmark add, run or lease throughput and latency.",
+			run:   cmdBench,
+		},
+		"help": {
+			usage: "help",
+			desc:  "List commands.",
+			run: func(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+				printCommands(out)
+				return nil
+			},
+		},
+	}
+}
+
+func printCommands(out io.Writer) {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "Commands:")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(out, "  %-45s %s\n", cmd.usage, cmd.desc)
+	}
+}
+
+func execCommand(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see \"help\"", args[0])
+	}
+
+	return cmd.run(c, args[1:], in, out)
+}
+
+func newFlagSet(name string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	return fs
+}
+
+// Flags common to job submitting commands.
+type jobFlags struct {
+	id          string
+	name        string
+	ttr         time.Duration
+	priority    int
+	maxAttempts int
+	maxFails    int
+}
+
+func (f *jobFlags) register(fs *flag.FlagSet, withLimits bool) {
+	fs.StringVar(&f.id, "id", "", "Job ID, generated if empty")
+	fs.StringVar(&f.name, "name", "", "Job name (required)")
+	fs.DurationVar(&f.ttr, "ttr", time.Minute, "Time-to-run")
+	fs.IntVar(&f.priority, "priority", 0, "Numeric priority")
+	if withLimits {
+		fs.IntVar(&f.maxAttempts, "max-attempts", 0, "Absolute max num of attempts")
+		fs.IntVar(&f.maxFails, "max-fails", 0, "Absolute max num of failures")
+	}
+}
+
+func (f *jobFlags) validate() error {
+	if f.name == "" {
+		return errors.New("-name is required")
+	}
+	if f.id == "" {
+		f.id = uuid.NewV4().String()
+	}
+
+	return nil
+}
+
+// Payload from the single positional argument, "-" reads stdin.
+func payloadArg(fs *flag.FlagSet, in io.Reader) ([]byte, error) {
+	if fs.NArg() != 1 {
+		return nil, errors.New("expected a single payload argument")
+	}
+
+	if fs.Arg(0) == "-" {
+		return ioutil.ReadAll(in)
+	}
+
+	return []byte(fs.Arg(0)), nil
+}
+
+func cmdAdd(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	var jf jobFlags
+	fs := newFlagSet("add", out)
+	jf.register(fs, true)
+	ttl := fs.Duration("ttl", time.Hour, "Time-to-live")
+	format := fs.String("format", "line", "Stdin payload format: line, json or raw")
+	conns := fs.Int("c", 1, "Connections to add stdin payloads over")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	stream := fs.NArg() == 1 && fs.Arg(0) == "-" && *format != "raw"
+	if stream && jf.id != "" {
+		return errors.New("-id requires -format raw when reading stdin")
+	}
+	if err := jf.validate(); err != nil {
+		return err
+	}
+
+	j := workq.BgJob{
+		ID:          jf.id,
+		Name:        jf.name,
+		TTR:         millis(jf.ttr),
+		TTL:         millis(*ttl),
+		Priority:    jf.priority,
+		MaxAttempts: jf.maxAttempts,
+		MaxFails:    jf.maxFails,
+	}
+	if stream {
+		next, err := payloadReader(*format, in)
+		if err != nil {
+			return err
+		}
+
+		return addStream(c, j, next, *conns, out)
+	}
+
+	payload, err := payloadArg(fs, in)
+	if err != nil {
+		return err
+	}
+
+	j.Payload = payload
+	if err := c.Add(&j); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, j.ID)
+	return nil
+}
+
+// Add a job per payload returned by next until io.EOF, each a copy of tmpl
+// with a generated ID. Adds are spread across up to n connections cloned
+// from c, stopping at the first error.
+func addStream(c *workq.Client, tmpl workq.BgJob, next func() ([]byte, error), n int, out io.Writer) error {
+	clients := []*workq.Client{c}
+	for i := 1; i < n; i++ {
+		clone, err := c.Clone()
+		if err == workq.ErrNotDialed {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		defer clone.Close()
+		clients = append(clients, clone)
+	}
+
+	var (
+		outMu   sync.Mutex
+		wg      sync.WaitGroup
+		once    sync.Once
+		addErr  error
+		jobs    = make(chan *workq.BgJob)
+		stopped = make(chan struct{})
+	)
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *workq.Client) {
+			defer wg.Done()
+			for j := range jobs {
+				if err := client.Add(j); err != nil {
+					once.Do(func() {
+						addErr = err
+						close(stopped)
+					})
+					return
+				}
+
+				outMu.Lock()
+				fmt.Fprintln(out, j.ID)
+				outMu.Unlock()
+			}
+		}(client)
+	}
+
+	var readErr error
+feed:
+	for {
+		payload, err := next()
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+
+		j := tmpl
+		j.ID = uuid.NewV4().String()
+		j.Payload = payload
+		select {
+		case jobs <- &j:
+		case <-stopped:
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	if addErr != nil {
+		return addErr
+	}
+
+	return readErr
+}
+
+// Returns a func reading successive payloads from in, io.EOF when done.
+// "line" yields each non-empty line, "json" each top level JSON value.
+func payloadReader(format string, in io.Reader) (func() ([]byte, error), error) {
+	switch format {
+	case "line":
+		s := bufio.NewScanner(in)
+		s.Buffer(nil, maxPayload+1)
+		return func() ([]byte, error) {
+			for s.Scan() {
+				if len(s.Bytes()) > 0 {
+					return append([]byte(nil), s.Bytes()...), nil
+				}
+			}
+			if err := s.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, io.EOF
+		}, nil
+	case "json":
+		dec := json.NewDecoder(in)
+		return func() ([]byte, error) {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+
+			return raw, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown payload format %q", format)
+}
+
+func cmdRun(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	var jf jobFlags
+	fs := newFlagSet("run", out)
+	jf.register(fs, false)
+	timeout := fs.Duration("timeout", time.Minute, "Max time to wait for the result")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := jf.validate(); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output, out)
+	if err != nil {
+		return err
+	}
+
+	payload, err := payloadArg(fs, in)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Run(&workq.FgJob{
+		ID:       jf.id,
+		Name:     jf.name,
+		TTR:      millis(jf.ttr),
+		Timeout:  millis(*timeout),
+		Payload:  payload,
+		Priority: jf.priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printResult(p, jf.id, result)
+}
+
+func cmdSchedule(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	var jf jobFlags
+	fs := newFlagSet("schedule", out)
+	jf.register(fs, true)
+	ttl := fs.Duration("ttl", time.Hour, "Time-to-live")
+	at := fs.String("time", "", "UTC time to start the job at, e.g. "+workq.TimeFormat+" (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := jf.validate(); err != nil {
+		return err
+	}
+	if *at == "" {
+		return errors.New("-time is required")
+	}
+
+	payload, err := payloadArg(fs, in)
+	if err != nil {
+		return err
+	}
+
+	err = c.Schedule(&workq.ScheduledJob{
+		ID:          jf.id,
+		Name:        jf.name,
+		TTR:         millis(jf.ttr),
+		TTL:         millis(*ttl),
+		Time:        *at,
+		Payload:     payload,
+		Priority:    jf.priority,
+		MaxAttempts: jf.maxAttempts,
+		MaxFails:    jf.maxFails,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, jf.id)
+	return nil
+}
+
+func cmdResult(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("result", out)
+	timeout := fs.Duration("timeout", 0, "Max time to wait for the result")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected a single job ID")
+	}
+	p, err := newPrinter(*output, out)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.Result(fs.Arg(0), millis(*timeout))
+	if err != nil {
+		return err
+	}
+
+	return printResult(p, fs.Arg(0), result)
+}
+
+func cmdLease(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("lease", out)
+	timeout := fs.Duration("timeout", time.Minute, "Max time to wait for a job")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("expected one or more job names")
+	}
+	p, err := newPrinter(*output, out)
+	if err != nil {
+		return err
+	}
+
+	j, err := c.Lease(fs.Args(), millis(*timeout))
+	if err != nil {
+		return err
+	}
+
+	return p.print([]field{
+		{"id", j.ID, j.ID},
+		{"name", j.Name, j.Name},
+		{"ttr", (time.Duration(j.TTR) * time.Millisecond).String(), j.TTR},
+		{"payload", fmt.Sprintf("%q", j.Payload), string(j.Payload)},
+	})
+}
+
+func cmdComplete(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("expected a job ID and result")
+	}
+
+	return printOk(out, c.Complete(args[0], []byte(args[1])))
+}
+
+func cmdFail(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("expected a job ID and result")
+	}
+
+	return printOk(out, c.Fail(args[0], []byte(args[1])))
+}
+
+func cmdDelete(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("expected a single job ID")
+	}
+
+	return printOk(out, c.Delete(args[0]))
+}
+
+func printOk(out io.Writer, err error) error {
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "OK")
+	return nil
+}
+
+func printResult(p *printer, id string, r *workq.JobResult) error {
+	return p.print([]field{
+		{"id", id, id},
+		{"success", fmt.Sprint(r.Success), r.Success},
+		{"result", fmt.Sprintf("%q", r.Result), string(r.Result)},
+	})
+}
+
+func millis(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
+
+// Split a command line into arguments, honoring double quoted arguments
+// with backslash escapes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var inArg, quoted, escaped bool
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
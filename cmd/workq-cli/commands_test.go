@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+const testID = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+
+func TestExecCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		resp    []byte
+		expReq  *workqtest.Request
+		expOut  string
+		expFail bool
+	}{
+		{
+			args:   []string{"add", "-id", testID, "-name", "j1", "-ttr", "5s", "-ttl", "1m", "-priority", "3", "a"},
+			resp:   workqtest.OK(),
+			expReq: &workqtest.Request{Name: "add", Args: []string{testID, "j1", "5000", "60000", "1", "-priority=3"}, Data: []byte("a")},
+			expOut: testID + "\n",
+		},
+		{
+			args:   []string{"run", "-id", testID, "-name", "j1", "-ttr", "5s", "-timeout", "1s", "a"},
+			resp:   workqtest.Result(testID, true, []byte("b")),
+			expReq: &workqtest.Request{Name: "run", Args: []string{testID, "j1", "5000", "1000", "1"}, Data: []byte("a")},
+			expOut: "id:      " + testID + "\nsuccess: true\nresult:  \"b\"\n",
+		},
+		{
+			args:   []string{"schedule", "-id", testID, "-name", "j1", "-time", "2016-12-01T00:00:00Z", "a"},
+			resp:   workqtest.OK(),
+			expReq: &workqtest.Request{Name: "schedule", Args: []string{testID, "j1", "60000", "3600000", "2016-12-01T00:00:00Z", "1"}, Data: []byte("a")},
+			expOut: testID + "\n",
+		},
+		{
+			args:   []string{"result", "-timeout", "2s", testID},
+			resp:   workqtest.Result(testID, false, []byte("b")),
+			expReq: &workqtest.Request{Name: "result", Args: []string{testID, "2000"}},
+			expOut: "id:      " + testID + "\nsuccess: false\nresult:  \"b\"\n",
+		},
+		{
+			args:   []string{"lease", "-timeout", "1s", "j1", "j2"},
+			resp:   workqtest.LeasedJob(testID, "j1", 5000, []byte("a")),
+			expReq: &workqtest.Request{Name: "lease", Args: []string{"j1", "j2", "1000"}},
+			expOut: "id:      " + testID + "\nname:    j1\nttr:     5s\npayload: \"a\"\n",
+		},
+		{
+			args:   []string{"result", "-output", "json", testID},
+			resp:   workqtest.Result(testID, true, []byte("b")),
+			expReq: &workqtest.Request{Name: "result", Args: []string{testID, "0"}},
+			expOut: `{"id":"` + testID + `","result":"b","success":true}` + "\n",
+		},
+		{
+			args:   []string{"lease", "-output", "csv", "j1"},
+			resp:   workqtest.LeasedJob(testID, "j1", 5000, []byte("a,b")),
+			expReq: &workqtest.Request{Name: "lease", Args: []string{"j1", "60000"}},
+			expOut: "id,name,ttr,payload\n" + testID + ",j1,5000,\"a,b\"\n",
+		},
+		{
+			args:    []string{"result", "-output", "xml", testID},
+			expFail: true,
+		},
+		{
+			args:   []string{"complete", testID, "b"},
+			resp:   workqtest.OK(),
+			expReq: &workqtest.Request{Name: "complete", Args: []string{testID, "1"}, Data: []byte("b")},
+			expOut: "OK\n",
+		},
+		{
+			args:   []string{"fail", testID, "b"},
+			resp:   workqtest.OK(),
+			expReq: &workqtest.Request{Name: "fail", Args: []string{testID, "1"}, Data: []byte("b")},
+			expOut: "OK\n",
+		},
+		{
+			args:    []string{"delete", testID},
+			resp:    workqtest.Error("NOT-FOUND", ""),
+			expReq:  &workqtest.Request{Name: "delete", Args: []string{testID}},
+			expFail: true,
+		},
+		{
+			args:    []string{"add", "a"},
+			expFail: true,
+		},
+		{
+			args:    []string{"unknown"},
+			expFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		var req *workqtest.Request
+		client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+			req = r
+			return tt.resp
+		})
+
+		out := bytes.NewBuffer(nil)
+		err := execCommand(client, tt.args, strings.NewReader(""), out)
+		client.Close()
+		if (err != nil) != tt.expFail {
+			t.Fatalf("Error mismatch, args=%q, err=%v", tt.args, err)
+		}
+
+		if !reflect.DeepEqual(tt.expReq, req) {
+			t.Fatalf("Request mismatch, args=%q, req=%+v", tt.args, req)
+		}
+
+		if !tt.expFail && out.String() != tt.expOut {
+			t.Fatalf("Output mismatch, args=%q, out=%q", tt.args, out.String())
+		}
+	}
+}
+
+func TestAddGeneratesID(t *testing.T) {
+	var req *workqtest.Request
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		req = r
+		return workqtest.OK()
+	})
+	defer client.Close()
+
+	out := bytes.NewBuffer(nil)
+	err := execCommand(client, []string{"add", "-name", "j1", "-"}, strings.NewReader("stdin"), out)
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if strings.TrimSpace(out.String()) != req.Args[0] || len(req.Args[0]) != 36 || string(req.Data) != "stdin" {
+		t.Fatalf("Request mismatch, req=%+v, out=%q", req, out.String())
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		exp  []string
+	}{
+		{"", nil},
+		{"delete  a", []string{"delete", "a"}},
+		{`add -name j1 "hello world"`, []string{"add", "-name", "j1", "hello world"}},
+		{`add "say \"hi\"" ""`, []string{"add", `say "hi"`, ""}},
+	}
+
+	for _, tt := range tests {
+		args, err := splitArgs(tt.line)
+		if err != nil || !reflect.DeepEqual(tt.exp, args) {
+			t.Fatalf("Args mismatch, line=%q, args=%q, err=%v", tt.line, args, err)
+		}
+	}
+
+	if _, err := splitArgs(`add "open`); err == nil {
+		t.Fatalf("Expected unterminated quote error")
+	}
+}
+
+func TestAddStdinPayloads(t *testing.T) {
+	tests := []struct {
+		format string
+		in     string
+		exp    []string
+	}{
+		{"line", "a\n\nb c\nd", []string{"a", "b c", "d"}},
+		{"json", `{"a":1} "b"` + "\n[1, 2]", []string{`{"a":1}`, `"b"`, `[1, 2]`}},
+		{"raw", "a\nb\n", []string{"a\nb\n"}},
+	}
+
+	for _, tt := range tests {
+		var payloads []string
+		var ids []string
+		client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+			payloads = append(payloads, string(r.Data))
+			ids = append(ids, r.Args[0])
+			return workqtest.OK()
+		})
+
+		out := bytes.NewBuffer(nil)
+		args := []string{"add", "-name", "j1", "-format", tt.format, "-c", "4", "-"}
+		err := execCommand(client, args, strings.NewReader(tt.in), out)
+		client.Close()
+		if err != nil {
+			t.Fatalf("Response mismatch, format=%s, err=%s", tt.format, err)
+		}
+
+		if !reflect.DeepEqual(tt.exp, payloads) {
+			t.Fatalf("Payload mismatch, format=%s, payloads=%q", tt.format, payloads)
+		}
+
+		if out.String() != strings.Join(ids, "\n")+"\n" {
+			t.Fatalf("Output mismatch, format=%s, out=%q", tt.format, out.String())
+		}
+	}
+}
+
+func TestAddStdinStopsOnError(t *testing.T) {
+	var n int
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		n++
+		if n == 2 {
+			return workqtest.Error("CLIENT-ERROR", "Invalid payload")
+		}
+
+		return workqtest.OK()
+	})
+	defer client.Close()
+
+	out := bytes.NewBuffer(nil)
+	err := execCommand(client, []string{"add", "-name", "j1", "-"}, strings.NewReader("a\nb\nc\n"), out)
+	if err == nil || n != 2 || strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("Response mismatch, n=%d, err=%v, out=%q", n, err, out.String())
+	}
+}
+
+func TestAddStdinInvalid(t *testing.T) {
+	tests := [][]string{
+		{"add", "-name", "j1", "-id", testID, "-"},
+		{"add", "-name", "j1", "-format", "xml", "-"},
+	}
+
+	for _, args := range tests {
+		client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+			return workqtest.OK()
+		})
+
+		err := execCommand(client, args, strings.NewReader("a\n"), bytes.NewBuffer(nil))
+		client.Close()
+		if err == nil {
+			t.Fatalf("Expected error, args=%q", args)
+		}
+	}
+}
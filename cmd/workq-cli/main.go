@@ -0,0 +1,48 @@
+// Command workq-cli is a command line client for Workq.
+//
+// Usage:
+//
+//	workq-cli [-addr host:port] <command> [arguments]
+//
+// Without a command, an interactive prompt reads commands from stdin.
+// Run "workq-cli help" for the list of commands.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/iamduo/go-workq"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9922", "Workq server address")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: workq-cli [-addr host:port] [command] [arguments]\n\n")
+		printCommands(os.Stderr)
+	}
+	flag.Parse()
+
+	client, err := workq.Connect(*addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = execMain(client, flag.Args(), os.Stdin, os.Stdout)
+	client.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func execMain(client *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return repl(client, in, out)
+	}
+
+	return execCommand(client, args, in, out)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// A printed field, Text shown in tables and Value in JSON & CSV.
+type field struct {
+	Key   string
+	Text  string
+	Value interface{}
+}
+
+// Prints records of fields in an output format: "table" aligns a field per
+// line, "json" prints an object per line and "csv" a header followed by a
+// row per record. Field keys are stable across releases.
+type printer struct {
+	format string
+	out    io.Writer
+	csv    *csv.Writer
+	header bool // Whether the CSV header was written.
+}
+
+// Register the -output flag of commands printing records.
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", "table", "Output format: table, json or csv")
+}
+
+func newPrinter(format string, out io.Writer) (*printer, error) {
+	switch format {
+	case "table", "json":
+	case "csv":
+		return &printer{format: format, out: out, csv: csv.NewWriter(out)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+
+	return &printer{format: format, out: out}, nil
+}
+
+func (p *printer) print(fields []field) error {
+	switch p.format {
+	case "json":
+		obj := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			obj[f.Key] = f.Value
+		}
+
+		return json.NewEncoder(p.out).Encode(obj)
+	case "csv":
+		if !p.header {
+			keys := make([]string, len(fields))
+			for i, f := range fields {
+				keys[i] = f.Key
+			}
+			p.csv.Write(keys)
+			p.header = true
+		}
+
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			row[i] = fmt.Sprint(f.Value)
+		}
+		p.csv.Write(row)
+		p.csv.Flush()
+		return p.csv.Error()
+	}
+
+	for _, f := range fields {
+		fmt.Fprintf(p.out, "%-8s %s\n", f.Key+":", f.Text)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/iamduo/go-workq"
+)
+
+const prompt = "workq> "
+
+// Read commands line by line until EOF or "exit", printing errors instead of
+// stopping. "history" lists previous commands, "!n" runs command n again.
+func repl(c *workq.Client, in io.Reader, out io.Writer) error {
+	var history []string
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(out, prompt)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(history) {
+				fmt.Fprintf(out, "error: no such history entry %q\n", line)
+				fmt.Fprint(out, prompt)
+				continue
+			}
+
+			line = history[n-1]
+			fmt.Fprintln(out, line)
+		}
+
+		switch line {
+		case "":
+		case "exit", "quit":
+			return nil
+		case "history":
+			for i, h := range history {
+				fmt.Fprintf(out, "%4d  %s\n", i+1, h)
+			}
+		default:
+			history = append(history, line)
+			if err := replExec(c, line, out); err != nil {
+				fmt.Fprintf(out, "error: %s\n", err)
+			}
+		}
+
+		fmt.Fprint(out, prompt)
+	}
+
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
+
+// Execute a single interactive command line. Payloads can't be read from
+// stdin as it is the prompt input.
+func replExec(c *workq.Client, line string, out io.Writer) error {
+	args, err := splitArgs(line)
+	if err != nil {
+		return err
+	}
+
+	return execCommand(c, args, strings.NewReader(""), out)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestRepl(t *testing.T) {
+	var reqs []string
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		reqs = append(reqs, r.Name+" "+strings.Join(r.Args, " "))
+		if r.Args[0] == "missing" {
+			return workqtest.Error("NOT-FOUND", "")
+		}
+
+		return workqtest.OK()
+	})
+	defer client.Close()
+
+	in := strings.NewReader(
+		"delete " + testID + "\n" +
+			"\n" +
+			"delete missing\n" +
+			"history\n" +
+			"!1\n" +
+			"!9\n" +
+			"exit\n" +
+			"delete never\n",
+	)
+	out := bytes.NewBuffer(nil)
+	if err := repl(client, in, out); err != nil {
+		t.Fatalf("Repl error, err=%s", err)
+	}
+
+	expOut := prompt + "OK\n" +
+		prompt +
+		prompt + "error: delete missing: NOT-FOUND\n" +
+		prompt + "   1  delete " + testID + "\n   2  delete missing\n" +
+		prompt + "delete " + testID + "\nOK\n" +
+		prompt + "error: no such history entry \"!9\"\n" +
+		prompt
+	if out.String() != expOut {
+		t.Fatalf("Output mismatch, act=%q", out.String())
+	}
+
+	if len(reqs) != 3 || reqs[2] != "delete "+testID {
+		t.Fatalf("Request mismatch, reqs=%q", reqs)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// A watched job outcome, Error is set when no result could be retrieved.
+type outcome struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Result  string `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (o *outcome) String() string {
+	switch {
+	case o.Error != "":
+		return fmt.Sprintf("%s error %s", o.ID, o.Error)
+	case o.Success:
+		return fmt.Sprintf("%s success %q", o.ID, o.Result)
+	}
+
+	return fmt.Sprintf("%s failed %q", o.ID, o.Result)
+}
+
+func cmdWatch(c *workq.Client, args []string, in io.Reader, out io.Writer) error {
+	fs := newFlagSet("watch", out)
+	timeout := fs.Duration("timeout", 0, "Max time to wait for all results, 0 waits forever")
+	poll := fs.Duration("poll", 30*time.Second, "Max time a single result request waits")
+	output := outputFlag(fs)
+	asJSON := fs.Bool("json", false, "Print outcomes as JSON lines, same as -output json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("expected one or more job IDs")
+	}
+	if *asJSON {
+		*output = "json"
+	}
+	p, err := newPrinter(*output, out)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed int
+	)
+	enc := json.NewEncoder(out)
+	for _, id := range fs.Args() {
+		// Watch each ID over its own connection when possible so a slow job
+		// does not hold up results of the others.
+		client := c
+		if fs.NArg() > 1 {
+			clone, err := c.Clone()
+			if err != nil && err != workq.ErrNotDialed {
+				return err
+			}
+			if err == nil {
+				defer clone.Close()
+				client = clone
+			}
+		}
+
+		wg.Add(1)
+		go func(client *workq.Client, id string) {
+			defer wg.Done()
+			o := watchResult(ctx, client, id, *poll)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !o.Success {
+				failed++
+			}
+			switch *output {
+			case "json":
+				enc.Encode(o)
+			case "csv":
+				p.print([]field{
+					{"id", o.ID, o.ID},
+					{"success", "", o.Success},
+					{"result", "", o.Result},
+					{"error", "", o.Error},
+				})
+			default:
+				fmt.Fprintln(out, o)
+			}
+		}(client, id)
+	}
+
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs did not succeed", failed, fs.NArg())
+	}
+
+	return nil
+}
+
+// Long-poll the result of id in requests waiting at most poll each, until a
+// result is returned, an error other than TIMED-OUT occurs or ctx is done.
+func watchResult(ctx context.Context, c *workq.Client, id string, poll time.Duration) *outcome {
+	r, err := c.WaitResult(ctx, id, poll)
+	switch {
+	case err == context.DeadlineExceeded:
+		return &outcome{ID: id, Error: workq.CodeTimedOut}
+	case err != nil:
+		return &outcome{ID: id, Error: err.Error()}
+	}
+
+	return &outcome{ID: id, Success: r.Success, Result: string(r.Result)}
+}
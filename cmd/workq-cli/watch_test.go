@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestWatch(t *testing.T) {
+	polls := make(map[string]int)
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		id := r.Args[0]
+		polls[id]++
+		switch {
+		case id == "missing":
+			return workqtest.Error("NOT-FOUND", "")
+		case polls[id] < 3:
+			return workqtest.Error("TIMED-OUT", "")
+		case id == testID:
+			return workqtest.Result(id, true, []byte("a"))
+		}
+
+		return workqtest.Result(id, false, []byte("b"))
+	})
+	defer client.Close()
+
+	const otherID = "ac6a3327-5a59-4cbb-9b18-0ba09a6e2e35"
+
+	out := bytes.NewBuffer(nil)
+	err := execCommand(client, []string{"watch", testID}, nil, out)
+	if err != nil || out.String() != testID+" success \"a\"\n" || polls[testID] != 3 {
+		t.Fatalf("Watch mismatch, err=%v, out=%q, polls=%d", err, out.String(), polls[testID])
+	}
+
+	out.Reset()
+	err = execCommand(client, []string{"watch", "-json", otherID, "missing"}, nil, out)
+	if err == nil || err.Error() != "2 of 2 jobs did not succeed" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	exp := map[string]bool{
+		`{"id":"` + otherID + `","success":false,"result":"b"}`:                true,
+		`{"id":"missing","success":false,"error":"result missing: NOT-FOUND"}`: true,
+	}
+	if len(lines) != 2 || !exp[lines[0]] || !exp[lines[1]] {
+		t.Fatalf("Output mismatch, out=%q", out.String())
+	}
+}
+
+func TestWatchTimeout(t *testing.T) {
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		time.Sleep(5 * time.Millisecond)
+		return workqtest.Error("TIMED-OUT", "")
+	})
+	defer client.Close()
+
+	out := bytes.NewBuffer(nil)
+	err := execCommand(client, []string{"watch", "-timeout", "20ms", "-poll", "10ms", testID}, nil, out)
+	if err == nil || out.String() != testID+" error TIMED-OUT\n" {
+		t.Fatalf("Watch mismatch, err=%v, out=%q", err, out.String())
+	}
+}
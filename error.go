@@ -1,20 +1,31 @@
 package workq
 
+import (
+	"net"
+	"strings"
+)
+
 type ResponseError struct {
 	code string
 	text string
+
+	cmd string // Command returning the error, if known.
+	id  string // Job ID the command referred to, if any.
 }
 
 func NewResponseError(code string, text string) error {
 	return &ResponseError{code: code, text: text}
 }
 
+// Error returns the code and text, prefixed with the command and job ID
+// returning it when known, e.g. "delete <id>: NOT-FOUND".
 func (e *ResponseError) Error() string {
+	msg := e.code
 	if e.text != "" {
-		return e.code + " " + e.text
+		msg += " " + e.text
 	}
 
-	return e.code
+	return withCommand(e.cmd, e.id, msg)
 }
 
 func (e *ResponseError) Code() string {
@@ -25,14 +36,146 @@ func (e *ResponseError) Text() string {
 	return e.text
 }
 
+// Command returns the name of the command returning the error, e.g. "add",
+// empty if unknown.
+func (e *ResponseError) Command() string {
+	return e.cmd
+}
+
+// JobID returns the job ID the command returning the error referred to,
+// empty if none.
+func (e *ResponseError) JobID() string {
+	return e.id
+}
+
 type NetError struct {
 	text string
+
+	cmd string // Command interrupted by the error, if known.
+	id  string // Job ID the command referred to, if any.
 }
 
+// Error returns the text prefixed with the command and job ID interrupted
+// when known, e.g. "add <id>: Net Error: EOF".
 func (e *NetError) Error() string {
-	return "Net Error: " + e.text
+	return withCommand(e.cmd, e.id, "Net Error: "+e.text)
+}
+
+// Command returns the name of the command interrupted by the error, e.g.
+// "add", empty if unknown.
+func (e *NetError) Command() string {
+	return e.cmd
+}
+
+// JobID returns the job ID the interrupted command referred to, empty if
+// none.
+func (e *NetError) JobID() string {
+	return e.id
 }
 
 func NewNetError(text string) error {
 	return &NetError{text: text}
 }
+
+// Set the command & job ID of response and network errors returned for req.
+func (r *request) annotate(err error) error {
+	switch e := err.(type) {
+	case *ResponseError:
+		e.cmd, e.id = r.name, r.id
+	case *NetError:
+		e.cmd, e.id = r.name, r.id
+	}
+
+	return err
+}
+
+func withCommand(cmd string, id string, msg string) string {
+	switch {
+	case cmd == "":
+		return msg
+	case id == "":
+		return cmd + ": " + msg
+	}
+
+	return cmd + " " + id + ": " + msg
+}
+
+// Error codes of ResponseError documented by the protocol:
+// https://github.com/iamduo/workq/blob/master/doc/protocol.md#errors
+const (
+	CodeClientError = "CLIENT-ERROR" // Invalid command or arguments.
+	CodeServerError = "SERVER-ERROR"
+	CodeNotFound    = "NOT-FOUND"
+	CodeTimedOut    = "TIMED-OUT"
+)
+
+// Text prefix of the CLIENT-ERROR response to adding or running a job with
+// the ID of an existing job. The protocol has no dedicated conflict code.
+const TextDuplicate = "Duplicate job"
+
+// HasCode returns whether err is a ResponseError with code.
+func HasCode(err error, code string) bool {
+	rerr, ok := err.(*ResponseError)
+	return ok && rerr.code == code
+}
+
+// IsClientError returns whether err is a CLIENT-ERROR response.
+func IsClientError(err error) bool {
+	return HasCode(err, CodeClientError)
+}
+
+// IsServerError returns whether err is a SERVER-ERROR response.
+func IsServerError(err error) bool {
+	return HasCode(err, CodeServerError)
+}
+
+// IsNotFound returns whether err is a NOT-FOUND response.
+func IsNotFound(err error) bool {
+	return HasCode(err, CodeNotFound)
+}
+
+// IsTimedOut returns whether err is a TIMED-OUT response.
+func IsTimedOut(err error) bool {
+	return HasCode(err, CodeTimedOut)
+}
+
+// IsDuplicate returns whether err is the CLIENT-ERROR response to a job ID
+// already in use, e.g. by a job added before a retry of the same add. A
+// duplicate add of an idempotent producer is a success.
+func IsDuplicate(err error) bool {
+	rerr, ok := err.(*ResponseError)
+	return ok && rerr.code == CodeClientError && strings.HasPrefix(rerr.text, TextDuplicate)
+}
+
+// IsRetryable returns whether the command returning err may succeed when
+// retried as is:
+//
+//   - NetError and network timeouts dialing, the connection was lost
+//   - SERVER-ERROR responses
+//   - TIMED-OUT responses to "result" & "lease", nothing was ready yet
+//   - ErrBusy
+//
+// CLIENT-ERROR and NOT-FOUND responses, malformed responses and errors
+// validating commands before sending are not retryable.
+//
+// A command interrupted by a NetError may have been applied by the server,
+// only retry commands that are idempotent, e.g. adding a job with the same ID.
+func IsRetryable(err error) bool {
+	switch e := err.(type) {
+	case *NetError:
+		return true
+	case *ResponseError:
+		switch e.code {
+		case CodeServerError:
+			return true
+		case CodeTimedOut:
+			return e.cmd == "result" || e.cmd == "lease"
+		}
+
+		return false
+	case net.Error:
+		return e.Timeout()
+	}
+
+	return err == ErrBusy
+}
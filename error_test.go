@@ -19,3 +19,103 @@ func TestNetError(t *testing.T) {
 		t.Fatalf("Error mismatch, err=%s", err)
 	}
 }
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		is   func(error) bool
+		code string
+	}{
+		{IsClientError, CodeClientError},
+		{IsServerError, CodeServerError},
+		{IsNotFound, CodeNotFound},
+		{IsTimedOut, CodeTimedOut},
+	}
+
+	for _, tt := range tests {
+		if !tt.is(NewResponseError(tt.code, "")) || !HasCode(NewResponseError(tt.code, "a"), tt.code) {
+			t.Fatalf("Expected code match, code=%s", tt.code)
+		}
+		if tt.is(NewResponseError("CODE", "")) || tt.is(NewNetError(tt.code)) || tt.is(nil) {
+			t.Fatalf("Expected code mismatch, code=%s", tt.code)
+		}
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	tests := []struct {
+		err error
+		exp bool
+	}{
+		{NewResponseError(CodeClientError, "Duplicate job ID"), true},
+		{NewResponseError(CodeClientError, "Duplicate job"), true},
+		{NewResponseError(CodeClientError, "Invalid job name"), false},
+		{NewResponseError(CodeServerError, "Duplicate job"), false},
+		{NewNetError("Duplicate job"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if IsDuplicate(tt.err) != tt.exp {
+			t.Fatalf("Duplicate mismatch, err=%v, exp=%t", tt.err, tt.exp)
+		}
+	}
+}
+
+func TestErrorCommandContext(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	tests := []struct {
+		err    error
+		expMsg string
+	}{
+		{(&request{name: "delete", id: id}).annotate(NewResponseError("NOT-FOUND", "")), "delete " + id + ": NOT-FOUND"},
+		{(&request{name: "lease"}).annotate(NewResponseError("TIMED-OUT", "a")), "lease: TIMED-OUT a"},
+		{(&request{name: "add", id: id}).annotate(NewNetError("EOF")), "add " + id + ": Net Error: EOF"},
+		{(&request{name: "add", id: id}).annotate(ErrMalformed), "Malformed response"},
+	}
+
+	for _, tt := range tests {
+		if tt.err.Error() != tt.expMsg {
+			t.Fatalf("Error mismatch, act=%q", tt.err)
+		}
+	}
+
+	rerr := tests[0].err.(*ResponseError)
+	nerr := tests[2].err.(*NetError)
+	if rerr.Command() != "delete" || rerr.JobID() != id || nerr.Command() != "add" || nerr.JobID() != id {
+		t.Fatalf("Context mismatch, rerr=%+v, nerr=%+v", rerr, nerr)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err error
+		exp bool
+	}{
+		{NewNetError("EOF"), true},
+		{timeoutError{}, true},
+		{NewResponseError(CodeServerError, "a"), true},
+		{annotated("result", "", NewResponseError(CodeTimedOut, "")), true},
+		{annotated("lease", "", NewResponseError(CodeTimedOut, "")), true},
+		{annotated("run", "", NewResponseError(CodeTimedOut, "")), false},
+		{NewResponseError(CodeClientError, "a"), false},
+		{NewResponseError(CodeNotFound, ""), false},
+		{ErrBusy, true},
+		{ErrMalformed, false},
+		{ErrPoisoned, false},
+		{ErrInvalidName, false},
+		{ErrPayloadTooLarge, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if act := IsRetryable(tt.err); act != tt.exp {
+			t.Fatalf("Retryable mismatch, err=%v, act=%t", tt.err, act)
+		}
+	}
+}
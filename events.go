@@ -0,0 +1,124 @@
+package workq
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a client lifecycle event.
+type EventType int
+
+const (
+	// EventConnected is published once a connection is established, by
+	// Connect and after reconnecting.
+	EventConnected EventType = iota + 1
+
+	// EventDisconnected is published once a connection is lost to a network
+	// error, left out of sync by a malformed response, or closed. Err is nil
+	// for a connection closed by Close.
+	EventDisconnected
+
+	// EventCommandStarted is published before a command is written.
+	EventCommandStarted
+
+	// EventCommandFinished is published once a command returned, with its
+	// round trip Duration and error if any.
+	EventCommandFinished
+
+	// EventResponseError is published when a command returned a
+	// ResponseError, ahead of its EventCommandFinished.
+	EventResponseError
+
+	// EventReconnectAttempt is published after each attempt to replace a
+	// connection left out of sync, Err set when the attempt failed.
+	EventReconnectAttempt
+
+	// EventClockSkew is published by ProbeSkew with the estimated skew of
+	// the server clock as Duration.
+	EventClockSkew
+)
+
+var eventTypeNames = map[EventType]string{
+	EventConnected:        "connected",
+	EventDisconnected:     "disconnected",
+	EventCommandStarted:   "command_started",
+	EventCommandFinished:  "command_finished",
+	EventResponseError:    "response_error",
+	EventReconnectAttempt: "reconnect_attempt",
+	EventClockSkew:        "clock_skew",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Event describes a client lifecycle event.
+type Event struct {
+	Type EventType
+	Time time.Time
+	Addr string // Server address, empty for clients created by NewClient.
+
+	Command  string        // Command name for command events, e.g. "add".
+	JobID    string        // Job ID the command refers to, if any.
+	Duration time.Duration // Round trip of a finished command, or clock skew.
+	Err      error
+}
+
+// EventBus fans out client events to subscribers. A bus may be shared by
+// many clients, e.g. all clients of a Pool, see WithEventBus.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventBus returns an EventBus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving events, buffering up to n of them.
+// Events are dropped for subscribers whose buffer is full so that a slow
+// subscriber never stalls commands. Calling the returned func unsubscribes
+// and closes the channel.
+func (b *EventBus) Subscribe(n int) (<-chan Event, func()) {
+	ch := make(chan Event, n)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *EventBus) publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Publish an event if an event bus is set.
+func (c *Client) publish(e Event) {
+	if c.opts.eventBus == nil {
+		return
+	}
+
+	e.Time = c.opts.clock.Now()
+	e.Addr = c.addr
+	c.opts.eventBus.publish(e)
+}
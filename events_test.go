@@ -0,0 +1,125 @@
+package workq
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestEventBusCommands(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n-NOT-FOUND\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(10)
+	client := NewClient(conn, WithEventBus(bus))
+
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	if err := client.Delete(id); err != nil {
+		t.Fatalf("Delete mismatch, err=%s", err)
+	}
+	if err := client.Delete(id); err == nil {
+		t.Fatalf("Delete mismatch, expected error")
+	}
+	client.Close()
+	cancel()
+
+	var act []EventType
+	for e := range events {
+		if e.Command != "" && (e.Command != "delete" || e.JobID != id) {
+			t.Fatalf("Event mismatch, e=%+v", e)
+		}
+		if e.Type == EventResponseError && !reflect.DeepEqual(annotated("delete", id, NewResponseError("NOT-FOUND", "")), e.Err) {
+			t.Fatalf("Event error mismatch, err=%v", e.Err)
+		}
+		act = append(act, e.Type)
+	}
+
+	exp := []EventType{
+		EventCommandStarted, EventCommandFinished,
+		EventCommandStarted, EventResponseError, EventCommandFinished,
+		EventDisconnected,
+	}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Events mismatch, act=%v", act)
+	}
+}
+
+func TestEventBusReconnect(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	go func() {
+		for _, resp := range []string{"+BAD\r\n", "+OK\r\n"} {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+				return
+			}
+			conn.Write([]byte(resp))
+		}
+	}()
+
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(20)
+	client, err := Connect(server.Addr().String(), WithReconnect(), WithEventBus(bus))
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	if err := client.Delete(id); err != ErrMalformed {
+		t.Fatalf("Delete mismatch, err=%v", err)
+	}
+	if err := client.Delete(id); err != nil {
+		t.Fatalf("Delete mismatch, err=%v", err)
+	}
+	cancel()
+
+	var act []EventType
+	for e := range events {
+		if e.Addr != server.Addr().String() {
+			t.Fatalf("Event addr mismatch, addr=%s", e.Addr)
+		}
+		if e.Type == EventDisconnected && e.Err != ErrMalformed {
+			t.Fatalf("Event error mismatch, err=%v", e.Err)
+		}
+		act = append(act, e.Type)
+	}
+
+	exp := []EventType{
+		EventConnected,
+		EventCommandStarted, EventDisconnected, EventCommandFinished,
+		EventReconnectAttempt, EventConnected,
+		EventCommandStarted, EventCommandFinished,
+	}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Events mismatch, act=%v", act)
+	}
+}
+
+func TestEventBusDropsWhenFull(t *testing.T) {
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(1)
+	defer cancel()
+
+	bus.publish(Event{Type: EventConnected})
+	bus.publish(Event{Type: EventDisconnected})
+	if e := <-events; e.Type != EventConnected {
+		t.Fatalf("Event mismatch, e=%+v", e)
+	}
+	if len(events) != 0 {
+		t.Fatalf("Expected dropped event, len=%d", len(events))
+	}
+}
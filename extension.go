@@ -0,0 +1,145 @@
+package workq
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrUnknownCommand is returned by Exec for a command without a
+	// registered Extension.
+	ErrUnknownCommand = errors.New("Unknown command")
+)
+
+// Extension encodes a custom command, e.g. of a Workq server fork, and
+// decodes its reply.
+type Extension struct {
+	// Encode writes the command for args, including the trailing "\r\n" of
+	// its line and any data block.
+	Encode func(w io.Writer, args []interface{}) error
+
+	// Decode reads the full reply through r, e.g. DecodeOk.
+	// Return ErrMalformed for unrecognized replies, as any other error leaves
+	// the connection in use.
+	Decode func(r *Reply) (interface{}, error)
+}
+
+// Extensions holds Extensions by command name, shared by clients through
+// WithExtensions. Safe for concurrent use.
+type Extensions struct {
+	mu   sync.RWMutex
+	cmds map[string]Extension
+}
+
+// NewExtensions returns an empty Extensions registry.
+func NewExtensions() *Extensions {
+	return &Extensions{cmds: make(map[string]Extension)}
+}
+
+// Register sets the extension executing command name, replacing any
+// previously registered one.
+func (e *Extensions) Register(name string, ext Extension) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cmds[name] = ext
+}
+
+func (e *Extensions) lookup(name string) (Extension, bool) {
+	if e == nil {
+		return Extension{}, false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ext, ok := e.cmds[name]
+	return ext, ok
+}
+
+// Reply reads the reply of a custom command in the shapes of the built in
+// commands. Valid only during Extension.Decode.
+type Reply struct {
+	p *responseParser
+}
+
+// Ok reads a "+OK" reply.
+func (r *Reply) Ok() error {
+	return r.p.parseOk()
+}
+
+// OkCount reads a "+OK <count>" reply, e.g. preceding <count> results.
+func (r *Reply) OkCount() (int, error) {
+	return r.p.parseOkWithReply()
+}
+
+// Line reads a line without its "\r\n" terminator, returning a ResponseError
+// for an error line. The line is only valid until the next read.
+func (r *Reply) Line() ([]byte, error) {
+	line, err := r.p.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) > 0 && line[0] == '-' {
+		err, _ = r.p.errorFromLine(line)
+		return nil, err
+	}
+
+	return line, nil
+}
+
+// Block reads a data block of size followed by "\r\n".
+func (r *Reply) Block(size int) ([]byte, error) {
+	return r.p.readBlock(size)
+}
+
+// Result reads a job result as replied by "result".
+func (r *Reply) Result() (*JobResult, error) {
+	return r.p.readResult()
+}
+
+// LeasedJob reads a job as replied by "lease".
+func (r *Reply) LeasedJob() (*LeasedJob, error) {
+	return r.p.readLeasedJob()
+}
+
+// DecodeOk decodes a "+OK" reply to a nil value.
+func DecodeOk(r *Reply) (interface{}, error) {
+	return nil, r.Ok()
+}
+
+// DecodeOkCount decodes a "+OK <count>" reply to an int.
+func DecodeOkCount(r *Reply) (interface{}, error) {
+	n, err := r.OkCount()
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Exec executes custom command name registered through WithExtensions,
+// returning the value decoded from its reply.
+// Returns ErrUnknownCommand if no extension is registered for name.
+// Returns ResponseError for Workq response errors.
+// Returns NetError on any network errors.
+// Returns ErrMalformed if response can't be parsed.
+func (c *Client) Exec(name string, args ...interface{}) (interface{}, error) {
+	ext, ok := c.opts.extensions.lookup(name)
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := ext.Encode(buf, args); err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err := c.do(&request{name: name, data: buf.Bytes()}, func() (err error) {
+		v, err = ext.Decode(&Reply{p: c.parser})
+		return err
+	})
+	return v, err
+}
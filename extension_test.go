@@ -0,0 +1,86 @@
+package workq
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK 2\r\n-NOT-FOUND\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	ext := NewExtensions()
+	ext.Register("purge", Extension{
+		Encode: func(w io.Writer, args []interface{}) error {
+			_, err := fmt.Fprintf(w, "purge %s"+crnl, args[0])
+			return err
+		},
+		Decode: DecodeOkCount,
+	})
+	client := NewClient(conn, WithExtensions(ext))
+
+	v, err := client.Exec("purge", "j1")
+	if err != nil || v != 2 {
+		t.Fatalf("Exec mismatch, v=%v, err=%v", v, err)
+	}
+
+	_, err = client.Exec("purge", "j2")
+	if !reflect.DeepEqual(annotated("purge", "", NewResponseError("NOT-FOUND", "")), err) {
+		t.Fatalf("Exec error mismatch, err=%v", err)
+	}
+
+	if act := conn.wrt.String(); act != "purge j1\r\npurge j2\r\n" {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
+
+func TestExecReplyShapes(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+STATS 3\r\nabc\r\n+WHAT\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	ext := NewExtensions()
+	ext.Register("stats", Extension{
+		Encode: func(w io.Writer, args []interface{}) error {
+			_, err := io.WriteString(w, "stats"+crnl)
+			return err
+		},
+		Decode: func(r *Reply) (interface{}, error) {
+			line, err := r.Line()
+			if err != nil {
+				return nil, err
+			}
+
+			var size int
+			if _, err := fmt.Sscanf(string(line), "+STATS %d", &size); err != nil {
+				return nil, ErrMalformed
+			}
+
+			return r.Block(size)
+		},
+	})
+	client := NewClient(conn, WithExtensions(ext))
+
+	v, err := client.Exec("stats")
+	if err != nil || !reflect.DeepEqual([]byte("abc"), v) {
+		t.Fatalf("Exec mismatch, v=%v, err=%v", v, err)
+	}
+
+	if _, err := client.Exec("stats"); err != ErrMalformed {
+		t.Fatalf("Exec error mismatch, err=%v", err)
+	}
+	if _, err := client.Exec("stats"); err != ErrPoisoned {
+		t.Fatalf("Expected poisoned connection, err=%v", err)
+	}
+}
+
+func TestExecUnknownCommand(t *testing.T) {
+	client := NewClient(&TestConn{})
+	if _, err := client.Exec("purge"); err != ErrUnknownCommand {
+		t.Fatalf("Exec error mismatch, err=%v", err)
+	}
+}
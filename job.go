@@ -1,5 +1,27 @@
 package workq
 
+import (
+	"time"
+)
+
+// Job is implemented by *FgJob, *BgJob and *ScheduledJob, for code handling
+// any job type alike, e.g. validation, middleware or logging.
+type Job interface {
+	JobID() string // ID, or UUID in string form if ID is empty.
+	JobName() string
+	JobTTR() int
+	JobPayload() []byte
+	Flags() JobFlags
+}
+
+// JobFlags are the optional flags of a job, zero if not set or not
+// supported by the job type.
+type JobFlags struct {
+	Priority    int
+	MaxAttempts int
+	MaxFails    int
+}
+
 // FgJob is executed by the "run" command.
 // Describes a foreground job specification.
 type FgJob struct {
@@ -8,7 +30,8 @@ type FgJob struct {
 	TTR      int
 	Timeout  int // Milliseconds to wait for job completion.
 	Payload  []byte
-	Priority int // Numeric priority
+	Priority int  // Numeric priority
+	UUID     UUID // Binary ID, sent when ID is empty.
 }
 
 // BgJob is executed by the "add" command.
@@ -19,9 +42,10 @@ type BgJob struct {
 	TTR         int // Time-to-run
 	TTL         int // Time-to-live
 	Payload     []byte
-	Priority    int // Numeric priority
-	MaxAttempts int // Absoulute max num of attempts.
-	MaxFails    int // Absolute max number of failures.
+	Priority    int  // Numeric priority
+	MaxAttempts int  // Absoulute max num of attempts.
+	MaxFails    int  // Absolute max number of failures.
+	UUID        UUID // Binary ID, sent when ID is empty.
 }
 
 // ScheduledJob is executed by the "schedule" command.
@@ -32,10 +56,12 @@ type ScheduledJob struct {
 	TTR         int
 	TTL         int
 	Payload     []byte
-	Time        string
-	Priority    int // Numeric priority
-	MaxAttempts int // Absoulute max num of attempts.
-	MaxFails    int // Absolute max number of failures.
+	Time        string    // UTC start time in TimeFormat, see WithSchedulePrecision.
+	At          time.Time // Start time, sent when Time is empty.
+	Priority    int       // Numeric priority
+	MaxAttempts int       // Absoulute max num of attempts.
+	MaxFails    int       // Absolute max number of failures.
+	UUID        UUID      // Binary ID, sent when ID is empty.
 }
 
 // LeasedJob is returned by the "lease" command.
@@ -44,10 +70,143 @@ type LeasedJob struct {
 	Name    string
 	TTR     int
 	Payload []byte
+
+	buf *[]byte // Pooled payload buffer, see WithPooledPayloads.
+}
+
+// Release returns the payload buffer to the pool for reuse by later leases
+// when enabled through WithPooledPayloads, a no-op otherwise.
+// Payload must not be used after release.
+func (j *LeasedJob) Release() {
+	if j.buf == nil {
+		return
+	}
+
+	*j.buf = j.Payload[:0]
+	payloadPool.Put(j.buf)
+	j.buf = nil
+	j.Payload = nil
+}
+
+// LeasedJobMeta is returned by LeaseTo, the payload written to its sink.
+type LeasedJobMeta struct {
+	ID   string
+	Name string
+	TTR  int
+	Size int // Payload bytes.
 }
 
 // JobResult is returned by the "run" & "result" commands.
 type JobResult struct {
+	ID      string // Job ID the result belongs to.
 	Success bool
 	Result  []byte
 }
+
+// JobID implements Job.
+func (j *FgJob) JobID() string {
+	return jobID(j.ID, j.UUID)
+}
+
+// JobName implements Job.
+func (j *FgJob) JobName() string {
+	return j.Name
+}
+
+// JobTTR implements Job.
+func (j *FgJob) JobTTR() int {
+	return j.TTR
+}
+
+// JobPayload implements Job.
+func (j *FgJob) JobPayload() []byte {
+	return j.Payload
+}
+
+// Flags implements Job, foreground jobs only have a priority.
+func (j *FgJob) Flags() JobFlags {
+	return JobFlags{Priority: j.Priority}
+}
+
+// JobID implements Job.
+func (j *BgJob) JobID() string {
+	return jobID(j.ID, j.UUID)
+}
+
+// JobName implements Job.
+func (j *BgJob) JobName() string {
+	return j.Name
+}
+
+// JobTTR implements Job.
+func (j *BgJob) JobTTR() int {
+	return j.TTR
+}
+
+// JobPayload implements Job.
+func (j *BgJob) JobPayload() []byte {
+	return j.Payload
+}
+
+// Flags implements Job.
+func (j *BgJob) Flags() JobFlags {
+	return JobFlags{Priority: j.Priority, MaxAttempts: j.MaxAttempts, MaxFails: j.MaxFails}
+}
+
+// JobID implements Job.
+func (j *ScheduledJob) JobID() string {
+	return jobID(j.ID, j.UUID)
+}
+
+// JobName implements Job.
+func (j *ScheduledJob) JobName() string {
+	return j.Name
+}
+
+// JobTTR implements Job.
+func (j *ScheduledJob) JobTTR() int {
+	return j.TTR
+}
+
+// JobPayload implements Job.
+func (j *ScheduledJob) JobPayload() []byte {
+	return j.Payload
+}
+
+// Flags implements Job.
+func (j *ScheduledJob) Flags() JobFlags {
+	return JobFlags{Priority: j.Priority, MaxAttempts: j.MaxAttempts, MaxFails: j.MaxFails}
+}
+
+// ScheduledFrom returns a ScheduledJob of the same definition as bg starting
+// at at, e.g. to schedule a job otherwise added right away. The payload is
+// shared with bg.
+func ScheduledFrom(bg *BgJob, at time.Time) *ScheduledJob {
+	return &ScheduledJob{
+		ID:          bg.ID,
+		Name:        bg.Name,
+		TTR:         bg.TTR,
+		TTL:         bg.TTL,
+		Payload:     bg.Payload,
+		At:          at,
+		Priority:    bg.Priority,
+		MaxAttempts: bg.MaxAttempts,
+		MaxFails:    bg.MaxFails,
+		UUID:        bg.UUID,
+	}
+}
+
+// ForegroundFrom returns an FgJob of the same definition as bg waiting up to
+// timeout milliseconds for its result. TTL, MaxAttempts and MaxFails do not
+// apply to foreground jobs and are dropped. The payload is shared with bg.
+func ForegroundFrom(bg *BgJob, timeout int) *FgJob {
+	return &FgJob{
+		ID:       bg.ID,
+		Name:     bg.Name,
+		TTR:      bg.TTR,
+		Timeout:  timeout,
+		Payload:  bg.Payload,
+		Priority: bg.Priority,
+		UUID:     bg.UUID,
+	}
+}
@@ -0,0 +1,80 @@
+package workq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobInterface(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	u, _ := ParseUUID(id)
+	tests := []struct {
+		job   Job
+		flags JobFlags
+	}{
+		{
+			&FgJob{ID: id, Name: "j1", TTR: 60, Payload: []byte("a"), Priority: 1},
+			JobFlags{Priority: 1},
+		},
+		{
+			&BgJob{UUID: u, Name: "j1", TTR: 60, Payload: []byte("a"), Priority: 1, MaxAttempts: 3, MaxFails: 2},
+			JobFlags{Priority: 1, MaxAttempts: 3, MaxFails: 2},
+		},
+		{
+			&ScheduledJob{ID: id, Name: "j1", TTR: 60, Payload: []byte("a"), MaxAttempts: 3},
+			JobFlags{MaxAttempts: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		j := tt.job
+		if j.JobID() != id || j.JobName() != "j1" || j.JobTTR() != 60 || string(j.JobPayload()) != "a" {
+			t.Fatalf("Job mismatch, j=%+v", j)
+		}
+		if !reflect.DeepEqual(tt.flags, j.Flags()) {
+			t.Fatalf("Flags mismatch, flags=%+v", j.Flags())
+		}
+	}
+}
+
+func TestJobConversions(t *testing.T) {
+	bg := &BgJob{
+		ID:          "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+		Name:        "j1",
+		TTR:         60,
+		TTL:         60000,
+		Payload:     []byte("a"),
+		Priority:    1,
+		MaxAttempts: 3,
+		MaxFails:    2,
+	}
+	at := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	expScheduled := &ScheduledJob{
+		ID:          bg.ID,
+		Name:        "j1",
+		TTR:         60,
+		TTL:         60000,
+		Payload:     []byte("a"),
+		At:          at,
+		Priority:    1,
+		MaxAttempts: 3,
+		MaxFails:    2,
+	}
+	if s := ScheduledFrom(bg, at); !reflect.DeepEqual(expScheduled, s) {
+		t.Fatalf("Scheduled mismatch, s=%+v", s)
+	}
+
+	expFg := &FgJob{
+		ID:       bg.ID,
+		Name:     "j1",
+		TTR:      60,
+		Timeout:  1000,
+		Payload:  []byte("a"),
+		Priority: 1,
+	}
+	if fg := ForegroundFrom(bg, 1000); !reflect.DeepEqual(expFg, fg) {
+		t.Fatalf("Foreground mismatch, fg=%+v", fg)
+	}
+}
@@ -0,0 +1,92 @@
+package workq
+
+import (
+	"strings"
+)
+
+// LintWarning is a suspicious job setting found by LintJob.
+type LintWarning struct {
+	Field   string // Job field at fault, e.g. "TTL".
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// LintError is returned by Add, Run & Schedule of clients created
+// WithStrictJobs for jobs with lint warnings.
+type LintError struct {
+	Warnings []LintWarning
+}
+
+func (e *LintError) Error() string {
+	msgs := make([]string, len(e.Warnings))
+	for i, w := range e.Warnings {
+		msgs[i] = w.String()
+	}
+
+	return "Job lint failed: " + strings.Join(msgs, "; ")
+}
+
+// LintJob returns warnings for job settings that are valid to the server but
+// likely mistakes, e.g. a TTL shorter than the TTR. TTL and Timeout are
+// checked for *BgJob, *ScheduledJob and *FgJob.
+func LintJob(j Job) []LintWarning {
+	var l linter
+	l.ttr(j.JobTTR())
+	switch j := j.(type) {
+	case *FgJob:
+		if j.Timeout > 0 && j.Timeout < j.TTR {
+			l.warn("Timeout", "shorter than TTR, run may time out while the job is still running")
+		}
+	case *BgJob:
+		l.ttl(j.TTL, j.TTR)
+	case *ScheduledJob:
+		l.ttl(j.TTL, j.TTR)
+	}
+
+	f := j.Flags()
+	l.attempts(f.MaxAttempts, f.MaxFails)
+	return l.warnings
+}
+
+type linter struct {
+	warnings []LintWarning
+}
+
+func (l *linter) warn(field string, msg string) {
+	l.warnings = append(l.warnings, LintWarning{Field: field, Message: msg})
+}
+
+func (l *linter) ttr(ttr int) {
+	if ttr <= 0 {
+		l.warn("TTR", "not positive, leases time out immediately")
+	}
+}
+
+func (l *linter) ttl(ttl int, ttr int) {
+	if ttl <= 0 {
+		l.warn("TTL", "not positive, the job expires immediately")
+	} else if ttl < ttr {
+		l.warn("TTL", "shorter than TTR, the job may expire while leased")
+	}
+}
+
+func (l *linter) attempts(maxAttempts int, maxFails int) {
+	if maxAttempts > 0 && maxFails > maxAttempts {
+		l.warn("MaxFails", "greater than MaxAttempts, never reached")
+	}
+}
+
+// Returns a LintError for jobs with lint warnings if strict.
+func (c *Client) lint(j Job) error {
+	if !c.opts.strictJobs {
+		return nil
+	}
+	if w := LintJob(j); len(w) > 0 {
+		return &LintError{Warnings: w}
+	}
+
+	return nil
+}
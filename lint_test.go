@@ -0,0 +1,61 @@
+package workq
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLintJob(t *testing.T) {
+	tests := []struct {
+		job Job
+		exp []string
+	}{
+		{&BgJob{TTR: 1000, TTL: 60000, MaxAttempts: 3, MaxFails: 1}, nil},
+		{&BgJob{TTR: 0, TTL: 60000}, []string{"TTR"}},
+		{&BgJob{TTR: 5000, TTL: 1000}, []string{"TTL"}},
+		{&BgJob{TTR: 1000, TTL: 0}, []string{"TTL"}},
+		{&BgJob{TTR: 1000, TTL: 60000, MaxAttempts: 1, MaxFails: 2}, []string{"MaxFails"}},
+		{&ScheduledJob{TTR: 5000, TTL: 1000, MaxAttempts: 1, MaxFails: 2}, []string{"TTL", "MaxFails"}},
+		{&FgJob{TTR: 5000, Timeout: 1000}, []string{"Timeout"}},
+		{&FgJob{TTR: 1000, Timeout: 5000}, nil},
+	}
+
+	for _, tt := range tests {
+		var act []string
+		for _, w := range LintJob(tt.job) {
+			act = append(act, w.Field)
+		}
+
+		if !reflect.DeepEqual(tt.exp, act) {
+			t.Fatalf("Lint mismatch, job=%+v, act=%v", tt.job, act)
+		}
+	}
+}
+
+func TestWithStrictJobs(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithStrictJobs())
+	j := &BgJob{
+		ID:   "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+		Name: "j1",
+		TTR:  5000,
+		TTL:  1000,
+	}
+
+	err := client.Add(j)
+	if err == nil || err.Error() != "Job lint failed: TTL: shorter than TTR, the job may expire while leased" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if _, ok := err.(*LintError); !ok || conn.wrt.Len() != 0 {
+		t.Fatalf("Expected LintError before write, err=%T, written=%q", err, conn.wrt.String())
+	}
+
+	j.TTL = 60000
+	if err := client.Add(j); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+}
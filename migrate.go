@@ -0,0 +1,46 @@
+package workq
+
+// Migrate moves jobs of names from src to dst, e.g. between servers during an
+// upgrade. Each job is leased from src, re-added to dst with its original ID,
+// name, TTR & payload, then deleted from src.
+//
+// Lease replies do not carry TTL, priority or attempt limits: jobs are
+// re-added with ttl milliseconds and default flags. Scheduled jobs are only
+// moved once due.
+//
+// Returns the number of jobs moved once no job is leasable within timeout
+// milliseconds. A job already on dst, e.g. re-added by an interrupted
+// migration before deleting it from src, counts as moved. A job failing to
+// be re-added otherwise stays leased on src and is released back to its
+// queue when its TTR expires. It is not failed, as failing records a result
+// and may use up the job's last attempt.
+func Migrate(src *Client, dst *Client, names []string, ttl int, timeout int) (int, error) {
+	var moved int
+	for {
+		j, err := src.Lease(names, timeout)
+		if err != nil {
+			if IsTimedOut(err) {
+				return moved, nil
+			}
+
+			return moved, err
+		}
+
+		err = dst.Add(&BgJob{
+			ID:      j.ID,
+			Name:    j.Name,
+			TTR:     j.TTR,
+			TTL:     ttl,
+			Payload: j.Payload,
+		})
+		if err != nil && !IsDuplicate(err) {
+			return moved, err
+		}
+
+		if err := src.Delete(j.ID); err != nil {
+			return moved, err
+		}
+
+		moved++
+	}
+}
@@ -0,0 +1,90 @@
+package workq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	src := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+				"a\r\n" +
+				"+OK\r\n" +
+				"-TIMED-OUT\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	dst := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+
+	moved, err := Migrate(NewClient(src), NewClient(dst), []string{"j1", "j2"}, 60000, 100)
+	if err != nil || moved != 1 {
+		t.Fatalf("Migrate mismatch, moved=%d, err=%v", moved, err)
+	}
+
+	expSrc := []byte(
+		"lease j1 j2 100\r\n" +
+			"delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n" +
+			"lease j1 j2 100\r\n",
+	)
+	if !bytes.Equal(expSrc, src.wrt.Bytes()) {
+		t.Fatalf("Source write mismatch, act=%q", src.wrt.Bytes())
+	}
+
+	expDst := []byte("add 6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 60000 1\r\na\r\n")
+	if !bytes.Equal(expDst, dst.wrt.Bytes()) {
+		t.Fatalf("Destination write mismatch, act=%q", dst.wrt.Bytes())
+	}
+}
+
+func TestMigrateAddError(t *testing.T) {
+	src := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+				"a\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	dst := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-CLIENT-ERROR Invalid name\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+
+	moved, err := Migrate(NewClient(src), NewClient(dst), []string{"j1"}, 60000, 100)
+	if err == nil || err.Error() != "add 6ba7b810-9dad-11d1-80b4-00c04fd430c4: CLIENT-ERROR Invalid name" || moved != 0 {
+		t.Fatalf("Migrate mismatch, moved=%d, err=%v", moved, err)
+	}
+	if src.wrt.String() != "lease j1 100\r\n" {
+		t.Fatalf("Source write mismatch, act=%q", src.wrt.Bytes())
+	}
+}
+
+func TestMigrateDuplicate(t *testing.T) {
+	src := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK 1\r\n" +
+				"6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 5000 1\r\n" +
+				"a\r\n" +
+				"+OK\r\n" +
+				"-TIMED-OUT\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	dst := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-CLIENT-ERROR Duplicate job ID\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+
+	moved, err := Migrate(NewClient(src), NewClient(dst), []string{"j1"}, 60000, 100)
+	if err != nil || moved != 1 {
+		t.Fatalf("Migrate mismatch, moved=%d, err=%v", moved, err)
+	}
+	if !bytes.Contains(src.wrt.Bytes(), []byte("delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n")) {
+		t.Fatalf("Expected duplicate deleted from source, act=%q", src.wrt.Bytes())
+	}
+}
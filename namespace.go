@@ -0,0 +1,67 @@
+package workq
+
+import (
+	"strings"
+)
+
+// Namespace prefixes job names of commands sent through a Client, e.g. to
+// share a server between environments as "staging.email.send" and
+// "production.email.send" without each call site prefixing names.
+type Namespace struct {
+	client *Client
+	prefix string // Namespace followed by ".".
+}
+
+// NewNamespace returns a Namespace prefixing job names with name and ".".
+func NewNamespace(c *Client, name string) *Namespace {
+	return &Namespace{client: c, prefix: name + "."}
+}
+
+// Client returns the underlying Client.
+func (n *Namespace) Client() *Client {
+	return n.client
+}
+
+// Name returns name prefixed with the namespace.
+func (n *Namespace) Name(name string) string {
+	return n.prefix + name
+}
+
+// Add calls Client.Add with the job name prefixed, leaving j unchanged.
+func (n *Namespace) Add(j *BgJob) error {
+	nj := *j
+	nj.Name = n.Name(j.Name)
+	return n.client.Add(&nj)
+}
+
+// Run calls Client.Run with the job name prefixed, leaving j unchanged.
+func (n *Namespace) Run(j *FgJob) (*JobResult, error) {
+	nj := *j
+	nj.Name = n.Name(j.Name)
+	return n.client.Run(&nj)
+}
+
+// Schedule calls Client.Schedule with the job name prefixed, leaving j
+// unchanged.
+func (n *Namespace) Schedule(j *ScheduledJob) error {
+	nj := *j
+	nj.Name = n.Name(j.Name)
+	return n.client.Schedule(&nj)
+}
+
+// Lease calls Client.Lease with names prefixed, stripping the prefix from
+// the name of the job leased.
+func (n *Namespace) Lease(names []string, timeout int) (*LeasedJob, error) {
+	prefixed := make([]string, len(names))
+	for i, name := range names {
+		prefixed[i] = n.Name(name)
+	}
+
+	j, err := n.client.Lease(prefixed, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	j.Name = strings.TrimPrefix(j.Name, n.prefix)
+	return j, nil
+}
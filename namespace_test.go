@@ -0,0 +1,44 @@
+package workq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"+OK\r\n" +
+				"+OK\r\n" +
+				"+OK 1\r\n" + id + " 1 1\r\na\r\n" +
+				"+OK 1\r\n" + id + " staging.j1 5000 1\r\nb\r\n",
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	ns := NewNamespace(NewClient(conn), "staging")
+
+	j := &BgJob{ID: id, Name: "j1", TTR: 5000, TTL: 60000}
+	if err := ns.Add(j); err != nil || j.Name != "j1" {
+		t.Fatalf("Add mismatch, name=%s, err=%v", j.Name, err)
+	}
+	if err := ns.Schedule(&ScheduledJob{ID: id, Name: "j1", TTR: 5000, TTL: 60000, Time: "2016-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("Schedule mismatch, err=%s", err)
+	}
+	if _, err := ns.Run(&FgJob{ID: id, Name: "j1", TTR: 5000, Timeout: 1000}); err != nil {
+		t.Fatalf("Run mismatch, err=%s", err)
+	}
+
+	leased, err := ns.Lease([]string{"j1", "j2"}, 1000)
+	if err != nil || leased.Name != "j1" {
+		t.Fatalf("Lease mismatch, job=%+v, err=%v", leased, err)
+	}
+
+	exp := "add " + id + " staging.j1 5000 60000 0\r\n\r\n" +
+		"schedule " + id + " staging.j1 5000 60000 2016-01-01T00:00:00Z 0\r\n\r\n" +
+		"run " + id + " staging.j1 5000 1000 0\r\n\r\n" +
+		"lease staging.j1 staging.j2 1000\r\n"
+	if act := conn.wrt.String(); act != exp {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
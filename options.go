@@ -0,0 +1,513 @@
+package workq
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Logger receives diagnostic messages, satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ErrorReporter receives failures worth alerting on, e.g. to forward them to
+// an error tracker such as Sentry, see package workqsentry.
+// Tags describe the failure, e.g. the command and job ID.
+type ErrorReporter interface {
+	Report(err error, tags map[string]string)
+}
+
+// Option configures a Client created by Connect or NewClient.
+type Option func(*options)
+
+type options struct {
+	tlsConfig      *tls.Config
+	fallbackDelay  time.Duration
+	noDelay        *bool
+	keepAlive      time.Duration
+	readBuffer     int
+	writeBuffer    int
+	control        func(network, address string, c syscall.RawConn) error
+	reconnect      bool
+	flightRecorder int
+	logger         Logger
+	slowThreshold  time.Duration
+	pooledPayloads bool
+	maxInFlight    int
+	failBusy       bool
+	dialRetry      time.Duration
+	maxPayload     int
+	redactor       Redactor
+	reporter       ErrorReporter
+	eventBus       *EventBus
+	auth           string
+	extensions     *Extensions
+	parseMode      ParseMode
+	strictJobs     bool
+	precision      time.Duration
+	clock          Clock
+	readerSize     int
+	writeTimeout   time.Duration
+	writeRate      int
+	dialTimeout    time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.clock == nil {
+		o.clock = SystemClock
+	}
+
+	return o
+}
+
+// WithTLSConfig connects over TLS using config.
+//
+// Client certificates required by servers enforcing mutual TLS are set through
+// config.Certificates, or config.GetClientCertificate to pick up rotated
+// certificates on every new connection, see ReloadingClientCertificate.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithFallbackDelay sets how long to wait for an IPv6 connection before racing
+// an IPv4 connection when the address resolves to both (RFC 6555).
+// Defaults to 300ms, a negative value disables the fallback.
+func WithFallbackDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.fallbackDelay = d
+	}
+}
+
+// WithDialTimeout bounds connecting, then the TLS handshake WithTLSConfig, at
+// timeout each. Connecting defaults to the OS limit, the handshake to 10s.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithNoDelay sets TCP_NODELAY, disabling (true) or enabling (false) Nagle's
+// algorithm. Go sockets default to true.
+func WithNoDelay(noDelay bool) Option {
+	return func(o *options) {
+		o.noDelay = &noDelay
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive period, a negative value disables
+// keep-alives.
+func WithKeepAlive(d time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = d
+	}
+}
+
+// WithSocketBuffers sets the SO_RCVBUF & SO_SNDBUF socket buffer sizes in bytes.
+// A zero size leaves the OS default. Buffers are set before connecting, as
+// the TCP window scale is fixed by the handshake.
+func WithSocketBuffers(read int, write int) Option {
+	return func(o *options) {
+		o.readBuffer = read
+		o.writeBuffer = write
+	}
+}
+
+// WithDialControl sets a function called with the raw socket after creation
+// and before connecting, for any socket options not covered by other options.
+func WithDialControl(fn func(network, address string, c syscall.RawConn) error) Option {
+	return func(o *options) {
+		o.control = fn
+	}
+}
+
+// WithReconnect transparently dials a new connection before the next command
+// once a malformed or interrupted response has left the connection out of
+// sync. Commands are never retried, the command receiving the bad response
+// still returns its error.
+func WithReconnect() Option {
+	return func(o *options) {
+		o.reconnect = true
+	}
+}
+
+// WithAuth authenticates each connection dialed by Connect, Clone, a Pool or
+// WithReconnect with "auth" as the first command, the token sent as a data
+// block:
+//
+//	auth <size>\r\n
+//	<token>\r\n
+//
+// Workq does not authenticate clients itself, the command is intended for
+// authenticating proxies in front of it. A rejected token fails Connect with
+// the ResponseError returned. Ignored by NewClient.
+func WithAuth(token string) Option {
+	return func(o *options) {
+		o.auth = token
+	}
+}
+
+// WithExtensions enables the custom commands registered in e for
+// Client.Exec.
+func WithExtensions(e *Extensions) Option {
+	return func(o *options) {
+		o.extensions = e
+	}
+}
+
+// ParseMode controls how strictly responses are parsed, see WithParseMode.
+type ParseMode int
+
+const (
+	// ParseStrict rejects any deviation from the protocol with ErrMalformed.
+	ParseStrict ParseMode = iota
+
+	// ParseLenient tolerates framing deviations of some server forks and
+	// proxies: "\n" terminators without "\r" and trailing spaces on lines.
+	// Size mismatches of data blocks are still rejected.
+	ParseLenient
+)
+
+// WithParseMode sets how strictly responses are parsed, ParseStrict by
+// default.
+func WithParseMode(m ParseMode) Option {
+	return func(o *options) {
+		o.parseMode = m
+	}
+}
+
+// WithFlightRecorder keeps the last n frames sent & received in memory for
+// inspection through Client.DebugDump, e.g. after ErrMalformed.
+func WithFlightRecorder(n int) Option {
+	return func(o *options) {
+		o.flightRecorder = n
+	}
+}
+
+// WithRedactor rewrites frames with r before the flight recorder keeps them,
+// so enabling the recorder does not leak sensitive payloads into dumps.
+// Frames are chunks of the byte stream: a value split across two frames is
+// seen by r in two parts. Messages passed to the logger carry command names
+// and job IDs only, never payloads.
+func WithRedactor(r Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// WithErrorReporter reports malformed responses to r, tagged with the
+// command, job ID and count of consecutive malformed responses, as repeated
+// reports point at an incompatible server or proxy rather than a glitch.
+func WithErrorReporter(r ErrorReporter) Option {
+	return func(o *options) {
+		o.reporter = r
+	}
+}
+
+// WithEventBus publishes client lifecycle events to b, e.g. for metrics,
+// alerting or backpressure components to consume, see EventBus.Subscribe.
+func WithEventBus(b *EventBus) Option {
+	return func(o *options) {
+		o.eventBus = b
+	}
+}
+
+// WithLogger sets the logger for diagnostic messages.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithSlowThreshold logs commands whose round trip exceeds d, including the
+// command name and job ID. Requires WithLogger.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slowThreshold = d
+	}
+}
+
+// WithPooledPayloads reads leased job payloads into pooled buffers, avoiding
+// garbage for high throughput workers. Buffers are reused only when returned
+// by LeasedJob.Release once done with the payload.
+func WithPooledPayloads() Option {
+	return func(o *options) {
+		o.pooledPayloads = true
+	}
+}
+
+// WithMaxInFlight caps the number of commands executing or waiting for the
+// connection at n. Further commands block until a slot frees up, or fail
+// with ErrBusy if fail is true. The cap applies per connection, see
+// PoolConfig.MaxActive to cap connections of a Pool.
+func WithMaxInFlight(n int, fail bool) Option {
+	return func(o *options) {
+		o.maxInFlight = n
+		o.failBusy = fail
+	}
+}
+
+// WithDialRetry retries failed dials with jittered exponential backoff for up
+// to timeout, e.g. to ride out a server restart instead of failing at once.
+// Applies to Connect, Clone and reconnecting.
+func WithDialRetry(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialRetry = timeout
+	}
+}
+
+// WithMaxPayloadSize sets the max size of job payloads & results sent, for
+// servers configured with a limit other than the default 1 MiB. Larger
+// payloads fail with ErrPayloadTooLarge before anything is written.
+func WithMaxPayloadSize(n int) Option {
+	return func(o *options) {
+		o.maxPayload = n
+	}
+}
+
+// WithStrictJobs rejects jobs with lint warnings in Add, Run & Schedule with
+// a LintError before anything is written, see LintJob.
+func WithStrictJobs() Option {
+	return func(o *options) {
+		o.strictJobs = true
+	}
+}
+
+// WithSchedulePrecision sets the precision of schedule times sent, for
+// servers accepting RFC3339 times with fractional seconds, e.g.
+// time.Millisecond sends "2016-01-02T15:04:05.123Z". Must be a power of ten
+// between time.Nanosecond and the default time.Second.
+//
+// ScheduledJob.At and Time strings with fractional seconds are rounded up to
+// the precision, so jobs never start early on servers accepting whole
+// seconds only.
+func WithSchedulePrecision(d time.Duration) Option {
+	return func(o *options) {
+		o.precision = d
+	}
+}
+
+// WithReadBufferSize sets the size in bytes of the buffer responses are read
+// through, 4 KiB by default. Larger buffers read large payloads in fewer
+// reads, smaller ones save memory for many connections exchanging small
+// messages. Lines longer than the buffer are still read.
+func WithReadBufferSize(n int) Option {
+	return func(o *options) {
+		o.readerSize = n
+	}
+}
+
+// WithWriteTimeout sets a deadline for writing each command of timeout plus
+// the time to write its data at minRate bytes per second. Large payloads
+// uploading slowly but steadily are not cut off, while a stalled write
+// fails promptly with a NetError. A minRate of 0 applies timeout regardless
+// of size. Requires a net.Conn transport.
+func WithWriteTimeout(timeout time.Duration, minRate int) Option {
+	return func(o *options) {
+		o.writeTimeout = timeout
+		o.writeRate = minRate
+	}
+}
+
+// Write deadline of a command of n bytes, 0 for none.
+func (o *options) writeDeadline(n int) time.Duration {
+	if o.writeTimeout <= 0 {
+		return 0
+	}
+	if o.writeRate <= 0 {
+		return o.writeTimeout
+	}
+
+	return o.writeTimeout + time.Duration(int64(n)*int64(time.Second)/int64(o.writeRate))
+}
+
+// WithClock sets the clock of command timings, event and frame timestamps,
+// connection ages, dial and retry backoffs and pool health checks,
+// SystemClock by default. Context deadlines are always wall clock times.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// Start time of j to send, formatting At or rounding a Time string with
+// fractional seconds to the schedule precision. Other Time strings are sent
+// as is for the server to validate.
+func (o *options) scheduleTime(j *ScheduledJob) string {
+	if j.Time == "" && !j.At.IsZero() {
+		return o.formatTime(j.At)
+	}
+	if !strings.Contains(j.Time, ".") {
+		return j.Time
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, j.Time)
+	if err != nil {
+		return j.Time
+	}
+
+	return o.formatTime(t)
+}
+
+// Format t in UTC, rounded up to the schedule precision.
+func (o *options) formatTime(t time.Time) string {
+	p := o.schedulePrecision()
+	t = o.roundTime(t)
+
+	var digits int
+	for d := p; d < time.Second; d *= 10 {
+		digits++
+	}
+	if digits == 0 {
+		return t.Format(TimeFormat)
+	}
+
+	return t.Format("2006-01-02T15:04:05." + strings.Repeat("0", digits) + "Z")
+}
+
+// Round t up to the schedule precision, in UTC.
+func (o *options) roundTime(t time.Time) time.Time {
+	p := o.schedulePrecision()
+	t = t.UTC()
+	if r := t.Truncate(p); !r.Equal(t) {
+		return r.Add(p)
+	}
+
+	return t
+}
+
+func (o *options) schedulePrecision() time.Duration {
+	if o.precision <= 0 || o.precision > time.Second {
+		return time.Second
+	}
+
+	return o.precision
+}
+
+// Dialer racing IPv6 & IPv4 connections instead of waiting for the first
+// address family to time out.
+func (o *options) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:       o.dialTimeout,
+		FallbackDelay: o.fallbackDelay,
+		KeepAlive:     o.keepAlive,
+		Control:       o.controlSocket,
+	}
+}
+
+// Apply socket options to a socket before connecting, then the custom
+// dial control if any.
+func (o *options) controlSocket(network, address string, c syscall.RawConn) error {
+	if o.readBuffer > 0 || o.writeBuffer > 0 {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = setSocketBuffers(fd, o.readBuffer, o.writeBuffer)
+		})
+		if err != nil {
+			return err
+		}
+		if serr != nil {
+			return serr
+		}
+	}
+
+	if o.control != nil {
+		return o.control(network, address, c)
+	}
+	return nil
+}
+
+// Dial addr, retrying failed dials if enabled.
+func (o *options) dial(addr string) (net.Conn, error) {
+	conn, err := o.dialOnce(addr)
+	if err == nil || o.dialRetry <= 0 {
+		return conn, err
+	}
+
+	deadline := o.clock.Now().Add(o.dialRetry)
+	for n := 0; ; n++ {
+		wait := JitteredBackoff(n, minDialBackoff, maxDialBackoff)
+		if o.clock.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+
+		Sleep(o.clock, wait)
+		conn, err = o.dialOnce(addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+}
+
+// Dial addr applying socket & TLS options.
+func (o *options) dialOnce(addr string) (net.Conn, error) {
+	conn, err := o.dialer().Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err := o.tune(tcp); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if o.tlsConfig == nil {
+		return conn, nil
+	}
+
+	config := o.tlsConfig
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	// A server accepting connections but never answering the handshake
+	// would block the dial forever.
+	timeout := o.dialTimeout
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tconn := tls.Client(conn, config)
+	if err := tconn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tconn, nil
+}
+
+// Apply socket options to an established TCP connection.
+func (o *options) tune(conn *net.TCPConn) error {
+	if o.noDelay != nil {
+		if err := conn.SetNoDelay(*o.noDelay); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
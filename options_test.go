@@ -0,0 +1,527 @@
+package workq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Resolver answering every A and AAAA query with the loopback address of
+// the family.
+func loopbackResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveLoopbackDNS(server)
+			return client, nil
+		},
+	}
+}
+
+// Serve length prefixed DNS queries as over TCP.
+func serveLoopbackDNS(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		// Question name follows the 12 byte header, then type and class.
+		end := 12
+		for end < len(query) && query[end] != 0 {
+			end += int(query[end]) + 1
+		}
+		question := query[12 : end+5]
+		var rdata []byte
+		switch binary.BigEndian.Uint16(query[end+1:]) {
+		case 1:
+			rdata = net.ParseIP("127.0.0.1").To4()
+		case 28:
+			rdata = net.ParseIP("::1")
+		}
+
+		resp := append([]byte{query[0], query[1], 0x85, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}, question...)
+		if rdata != nil {
+			resp[7] = 1
+			resp = append(resp, 0xc0, 12)
+			resp = append(resp, question[len(question)-4:]...)
+			resp = append(resp, 0, 0, 0, 60, 0, byte(len(rdata)))
+			resp = append(resp, rdata...)
+		}
+
+		binary.BigEndian.PutUint16(size[:], uint16(len(resp)))
+		if _, err := conn.Write(append(size[:], resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// Dial a name resolving to ::1 & 127.0.0.1 while the IPv6 dial hangs,
+// returning whether the IPv4 dial raced it.
+func dialRaced(t *testing.T, fallbackDelay time.Duration) bool {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	ipv4 := make(chan struct{}, 1)
+	ipv6Done := make(chan struct{})
+	var raced bool
+	d := newOptions([]Option{
+		WithFallbackDelay(fallbackDelay),
+		WithDialControl(func(network, address string, c syscall.RawConn) error {
+			if network == "tcp4" {
+				ipv4 <- struct{}{}
+				return nil
+			}
+
+			defer close(ipv6Done)
+			select {
+			case <-ipv4:
+				raced = true
+			case <-time.After(200 * time.Millisecond):
+			}
+			return errors.New("unreachable")
+		}),
+	}).dialer()
+	d.Resolver = loopbackResolver()
+
+	conn, err := d.Dial("tcp", net.JoinHostPort("workq.test.", port))
+	if err != nil {
+		t.Fatalf("Dial error, err=%s", err)
+	}
+	conn.Close()
+
+	<-ipv6Done
+	return raced
+}
+
+func TestDialerFallback(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+	ln.Close()
+
+	if !dialRaced(t, 10*time.Millisecond) {
+		t.Fatalf("Expected IPv4 dial racing the IPv6 dial")
+	}
+	if dialRaced(t, -1) {
+		t.Fatalf("Expected IPv4 dial after the IPv6 dial with fallback disabled")
+	}
+}
+
+func TestConnectSocketOptions(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	var controlled bool
+	client, err := Connect(
+		server.Addr().String(),
+		WithNoDelay(false),
+		WithKeepAlive(10*time.Second),
+		WithSocketBuffers(65536, 65536),
+		WithDialControl(func(network, address string, c syscall.RawConn) error {
+			controlled = true
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	if !controlled {
+		t.Fatalf("Expected dial control to be called")
+	}
+}
+
+func TestConnectDialControlError(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	_, err = Connect(
+		server.Addr().String(),
+		WithDialControl(func(network, address string, c syscall.RawConn) error {
+			return errors.New("denied")
+		}),
+	)
+	if err == nil {
+		t.Fatalf("Expected dial control error")
+	}
+}
+
+type TestLogger struct {
+	lines []string
+}
+
+func (l *TestLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestSlowThreshold(t *testing.T) {
+	logger := &TestLogger{}
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithLogger(logger), WithSlowThreshold(time.Nanosecond))
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if len(logger.lines) != 1 || !strings.HasPrefix(logger.lines[0], "workq: slow command delete id=6ba7b810-9dad-11d1-80b4-00c04fd430c4 took ") {
+		t.Fatalf("Log mismatch, lines=%q", logger.lines)
+	}
+
+	conn = &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client = NewClient(conn, WithLogger(logger), WithSlowThreshold(time.Hour))
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if len(logger.lines) != 1 {
+		t.Fatalf("Unexpected log, lines=%q", logger.lines)
+	}
+}
+
+func TestConnectDialRetry(t *testing.T) {
+	// Reserve a free port then release it so the first dials fail.
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	addr := server.Addr().String()
+	server.Close()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		server, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		conn, err := server.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	client, err := Connect(addr, WithDialRetry(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	client.Close()
+}
+
+func TestConnectDialRetryTimeout(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	addr := server.Addr().String()
+	server.Close()
+
+	start := time.Now()
+	_, err = Connect(addr, WithDialRetry(300*time.Millisecond))
+	if err == nil {
+		t.Fatalf("Expected dial error")
+	}
+
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("Dial retry exceeded timeout, took=%s", d)
+	}
+}
+
+type TestReporter struct {
+	errs []error
+	tags []map[string]string
+}
+
+func (r *TestReporter) Report(err error, tags map[string]string) {
+	r.errs = append(r.errs, err)
+	r.tags = append(r.tags, tags)
+}
+
+func TestErrorReporterMalformed(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	go func() {
+		// Responses per connection, each malformed one forces a reconnect.
+		conns := [][]string{{"+BAD\r\n"}, {"+BAD\r\n"}, {"-NOT-FOUND\r\n", "+BAD\r\n"}}
+		for _, resps := range conns {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			rdr := bufio.NewReader(conn)
+			for _, resp := range resps {
+				if _, err := rdr.ReadString('\n'); err != nil {
+					return
+				}
+				conn.Write([]byte(resp))
+			}
+		}
+	}()
+
+	reporter := &TestReporter{}
+	client, err := Connect(server.Addr().String(), WithReconnect(), WithErrorReporter(reporter))
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	expErrs := []error{ErrMalformed, ErrMalformed, annotated("delete", id, NewResponseError("NOT-FOUND", "")), ErrMalformed}
+	for i, expErr := range expErrs {
+		err := client.Delete(id)
+		if !reflect.DeepEqual(expErr, err) {
+			t.Fatalf("Error mismatch, i=%d, err=%v", i, err)
+		}
+	}
+
+	expTags := []map[string]string{
+		{"workq_cmd": "delete", "job_id": id, "consecutive": "1"},
+		{"workq_cmd": "delete", "job_id": id, "consecutive": "2"},
+		{"workq_cmd": "delete", "job_id": id, "consecutive": "1"},
+	}
+	if len(reporter.errs) != 3 || reporter.errs[0] != ErrMalformed || !reflect.DeepEqual(expTags, reporter.tags) {
+		t.Fatalf("Report mismatch, errs=%v, tags=%v", reporter.errs, reporter.tags)
+	}
+}
+
+func TestWithAuth(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		for _, resp := range []string{"+OK\r\n", "-UNAUTHORIZED Invalid token\r\n"} {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			rdr := bufio.NewReader(conn)
+			line, _ := rdr.ReadString('\n')
+			token, _ := rdr.ReadString('\n')
+			received <- line + token
+			conn.Write([]byte(resp))
+		}
+	}()
+
+	client, err := Connect(server.Addr().String(), WithAuth("s3cret token"))
+	if err != nil {
+		t.Fatalf("Connect mismatch, err=%s", err)
+	}
+	defer client.Close()
+	if act := <-received; act != "auth 12\r\ns3cret token\r\n" {
+		t.Fatalf("Handshake mismatch, act=%q", act)
+	}
+
+	_, err = Connect(server.Addr().String(), WithAuth("invalid"))
+	if !reflect.DeepEqual(NewResponseError("UNAUTHORIZED", "Invalid token"), err) {
+		t.Fatalf("Connect error mismatch, err=%v", err)
+	}
+}
+
+func TestWithAuthReconnect(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	received := make(chan string, 4)
+	go func() {
+		// Responses per connection, the first to the auth command.
+		conns := [][]string{{"+OK\r\n", "+BAD\r\n"}, {"-UNAUTHORIZED Expired\r\n"}, {"+OK\r\n", "+OK\r\n"}}
+		for _, resps := range conns {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			rdr := bufio.NewReader(conn)
+			line, _ := rdr.ReadString('\n')
+			token, _ := rdr.ReadString('\n')
+			received <- line + token
+			conn.Write([]byte(resps[0]))
+			for _, resp := range resps[1:] {
+				if _, err := rdr.ReadString('\n'); err != nil {
+					return
+				}
+				conn.Write([]byte(resp))
+			}
+		}
+	}()
+
+	client, err := Connect(server.Addr().String(), WithAuth("a"), WithReconnect())
+	if err != nil {
+		t.Fatalf("Connect mismatch, err=%s", err)
+	}
+	defer client.Close()
+
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	expErrs := []error{ErrMalformed, annotated("delete", id, NewResponseError("UNAUTHORIZED", "Expired")), nil}
+	for i, expErr := range expErrs {
+		err := client.Delete(id)
+		if !reflect.DeepEqual(expErr, err) {
+			t.Fatalf("Error mismatch, i=%d, err=%v", i, err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if act := <-received; act != "auth 1\r\na\r\n" {
+			t.Fatalf("Handshake mismatch, i=%d, act=%q", i, act)
+		}
+	}
+}
+
+func TestWithParseMode(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	resp := "+OK 1 \n" + id + " 1 1\na\n"
+	for _, mode := range []ParseMode{ParseStrict, ParseLenient} {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer([]byte(resp)),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		client := NewClient(conn, WithParseMode(mode))
+		result, err := client.Result(id, 1000)
+		if mode == ParseStrict {
+			if err != ErrMalformed {
+				t.Fatalf("Strict error mismatch, err=%v", err)
+			}
+			continue
+		}
+
+		exp := &JobResult{ID: id, Success: true, Result: []byte("a")}
+		if err != nil || !reflect.DeepEqual(exp, result) {
+			t.Fatalf("Lenient result mismatch, result=%+v, err=%v", result, err)
+		}
+	}
+}
+
+func TestWithReadBufferSize(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	payload := strings.Repeat("a", 100)
+	for _, size := range []int{0, 16, 64 * 1024} {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer([]byte("+OK 1\r\n" + id + " 1 100\r\n" + payload + "\r\n")),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		client := NewClient(conn, WithReadBufferSize(size))
+		exp := size
+		if exp == 0 {
+			exp = defaultReaderSize
+		}
+		if client.rdr.Size() != exp {
+			t.Fatalf("Size mismatch, size=%d, act=%d", size, client.rdr.Size())
+		}
+
+		result, err := client.Result(id, 1000)
+		if err != nil || string(result.Result) != payload {
+			t.Fatalf("Result mismatch, size=%d, result=%+v, err=%v", size, result, err)
+		}
+	}
+}
+
+func TestWithWriteTimeout(t *testing.T) {
+	o := newOptions([]Option{WithWriteTimeout(time.Second, 1024)})
+	if d := o.writeDeadline(10 * 1024); d != 11*time.Second {
+		t.Fatalf("Deadline mismatch, d=%s", d)
+	}
+	if d := newOptions([]Option{WithWriteTimeout(time.Second, 0)}).writeDeadline(10 * 1024); d != time.Second {
+		t.Fatalf("Deadline mismatch, d=%s", d)
+	}
+	if d := newOptions(nil).writeDeadline(10 * 1024); d != 0 {
+		t.Fatalf("Deadline mismatch, d=%s", d)
+	}
+
+	// Server never reading stalls the write.
+	conn, server := net.Pipe()
+	defer server.Close()
+	client := NewClient(conn, WithWriteTimeout(20*time.Millisecond, 1024))
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if _, ok := err.(*NetError); !ok {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestWithSchedulePrecision(t *testing.T) {
+	at := time.Date(2016, 1, 2, 15, 4, 5, 123456789, time.FixedZone("CET", 3600))
+	tests := []struct {
+		precision time.Duration
+		job       *ScheduledJob
+		exp       string
+	}{
+		{0, &ScheduledJob{At: at}, "2016-01-02T14:04:06Z"},
+		{0, &ScheduledJob{At: at.Truncate(time.Second)}, "2016-01-02T14:04:05Z"},
+		{0, &ScheduledJob{Time: "2016-01-02T15:04:05.5Z"}, "2016-01-02T15:04:06Z"},
+		{0, &ScheduledJob{Time: "2016-01-02T15:04:05Z", At: at}, "2016-01-02T15:04:05Z"},
+		{0, &ScheduledJob{Time: "tomorrow."}, "tomorrow."},
+		{time.Millisecond, &ScheduledJob{At: at}, "2016-01-02T14:04:05.124Z"},
+		{time.Millisecond, &ScheduledJob{Time: "2016-01-02T15:04:05.1Z"}, "2016-01-02T15:04:05.100Z"},
+		{time.Nanosecond, &ScheduledJob{At: at}, "2016-01-02T14:04:05.123456789Z"},
+	}
+
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	for _, tt := range tests {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		client := NewClient(conn, WithSchedulePrecision(tt.precision))
+		tt.job.ID = id
+		tt.job.Name = "j1"
+		if err := client.Schedule(tt.job); err != nil {
+			t.Fatalf("Schedule mismatch, err=%s", err)
+		}
+
+		exp := "schedule " + id + " j1 0 0 " + tt.exp + " 0\r\n\r\n"
+		if act := conn.wrt.String(); act != exp {
+			t.Fatalf("Write mismatch, exp=%q, act=%q", exp, act)
+		}
+	}
+}
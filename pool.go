@@ -0,0 +1,452 @@
+package workq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPoolClosed is returned when getting a Client from a closed Pool.
+	ErrPoolClosed = errors.New("Pool closed")
+)
+
+// How long an idle connection is probed for unexpected data or EOF.
+const healthProbeTimeout = time.Millisecond
+
+// PoolConfig configures a Pool, the zero value keeps idle connections
+// indefinitely without health checks.
+type PoolConfig struct {
+	MaxIdle int           // Max idle connections kept, 0 for no limit.
+	MinIdle int           // Min idle connections kept warm, see Pool.Warm.
+	MaxAge  time.Duration // Connections older than MaxAge are closed, 0 for no limit.
+
+	// Interval between health checks of idle connections, evicting dead and
+	// expired connections and dialing up to MinIdle. 0 disables checks.
+	HealthCheckInterval time.Duration
+
+	// Max Clients borrowed at once, 0 for no limit. Get waits for a Client
+	// to be returned with Put once reached, or fails with ErrBusy if
+	// FailBusy is set.
+	MaxActive int
+	FailBusy  bool
+}
+
+// Pool maintains idle connections to a Workq server for reuse by concurrent
+// callers, each borrowing a dedicated Client with Get and returning it with Put.
+type Pool struct {
+	addr   string
+	opts   *options
+	config PoolConfig
+
+	mu      sync.Mutex
+	idle    []*Client // Most recently returned last.
+	closed  bool
+	filling bool // Set while dialing up to MinIdle in the background.
+	done    chan struct{}
+
+	warmMu sync.Mutex // Serializes Warm to not dial beyond MinIdle.
+
+	// Slots of Clients borrowed, nil if unlimited.
+	active chan struct{}
+}
+
+// NewPool returns a Pool dialing addr with opts.
+// MinIdle connections are dialed in the background right away.
+func NewPool(addr string, config PoolConfig, opts ...Option) *Pool {
+	p := &Pool{
+		addr:   addr,
+		opts:   newOptions(opts),
+		config: config,
+		done:   make(chan struct{}),
+	}
+	if config.MaxActive > 0 {
+		p.active = make(chan struct{}, config.MaxActive)
+	}
+	if config.HealthCheckInterval > 0 {
+		go p.healthLoop()
+	}
+
+	p.refill()
+	return p
+}
+
+// Warm dials idle connections up to MinIdle, e.g. to wait for warm
+// connections at startup before serving requests. Returns the first dial
+// error.
+//
+// Connections are also dialed in the background by NewPool, after
+// connections were discarded as out of sync and by health checks.
+func (p *Pool) Warm() error {
+	p.warmMu.Lock()
+	defer p.warmMu.Unlock()
+
+	p.mu.Lock()
+	closed := p.closed
+	missing := p.config.MinIdle - len(p.idle)
+	p.mu.Unlock()
+	if closed {
+		return ErrPoolClosed
+	}
+
+	for i := 0; i < missing; i++ {
+		c, err := connect(p.addr, p.opts)
+		if err != nil {
+			return err
+		}
+
+		p.put(c)
+	}
+
+	return nil
+}
+
+// Warm the pool in the background unless already in progress.
+func (p *Pool) refill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.filling || len(p.idle) >= p.config.MinIdle {
+		return
+	}
+
+	p.filling = true
+	go func() {
+		p.Warm()
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+}
+
+// Get returns an idle Client or dials a new one. Clients must be returned
+// with Put, even when broken, to free their slot of MaxActive.
+func (p *Pool) Get() (*Client, error) {
+	if err := p.acquire(); err != nil {
+		return nil, err
+	}
+
+	c, err := p.get()
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (p *Pool) get() (*Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if !p.expired(c) {
+			p.mu.Unlock()
+			return c, nil
+		}
+
+		c.Close()
+	}
+	p.mu.Unlock()
+
+	return connect(p.addr, p.opts)
+}
+
+// Take a slot of MaxActive, waiting for a Client to be returned unless
+// FailBusy is set.
+func (p *Pool) acquire() error {
+	if p.active == nil {
+		return nil
+	}
+
+	if p.config.FailBusy {
+		select {
+		case p.active <- struct{}{}:
+			return nil
+		default:
+			return ErrBusy
+		}
+	}
+
+	select {
+	case p.active <- struct{}{}:
+		return nil
+	case <-p.done:
+		return ErrPoolClosed
+	}
+}
+
+// Free a slot of MaxActive.
+func (p *Pool) release() {
+	if p.active != nil {
+		<-p.active
+	}
+}
+
+// Put returns a Client to the pool. Clients out of sync or beyond MaxIdle
+// are closed instead.
+func (p *Pool) Put(c *Client) {
+	p.release()
+	p.put(c)
+}
+
+// Return c to the idle connections, without freeing a slot of MaxActive.
+func (p *Pool) put(c *Client) {
+	c.mu.Lock()
+	poisoned := c.poisoned
+	c.mu.Unlock()
+
+	if poisoned {
+		c.Close()
+		p.refill()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.expired(c) || (p.config.MaxIdle > 0 && len(p.idle) >= p.config.MaxIdle) {
+		c.Close()
+		return
+	}
+
+	p.idle = append(p.idle, c)
+}
+
+// Close c borrowed with Get, e.g. after a command was cut short, and dial
+// replacements up to MinIdle.
+func (p *Pool) discard(c *Client) {
+	c.Close()
+	p.release()
+	p.refill()
+}
+
+// WithClient borrows a Client for the duration of fn and returns it to the
+// pool afterwards. Clients are closed instead of returned when fn fails with
+// a network or protocol error. Returns the error from fn.
+//
+// ctx bounds the whole call: once done, waiting for a connection to be
+// dialed or returned under MaxActive is abandoned and commands of fn blocked on the connection are
+// interrupted, discarding the connection, and ctx.Err() is returned.
+// Commands are only interrupted over net.Conn transports.
+func (p *Pool) WithClient(ctx context.Context, fn func(c *Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c, err := p.getContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	stop := interruptOnDone(ctx, c)
+	err = fn(c)
+	if stop() || (err != nil && ctx.Err() != nil) {
+		// A deadline may have cut a command short mid-response.
+		p.discard(c)
+		if err != nil {
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	if _, ok := err.(*NetError); ok || err == ErrMalformed || err == ErrPoisoned {
+		p.discard(c)
+		return err
+	}
+
+	p.Put(c)
+	return err
+}
+
+// Get a Client until ctx is done. A Client dialed after ctx was done is
+// returned to the pool.
+func (p *Pool) getContext(ctx context.Context) (*Client, error) {
+	type got struct {
+		c   *Client
+		err error
+	}
+
+	ch := make(chan got, 1)
+	go func() {
+		c, err := p.Get()
+		ch <- got{c, err}
+	}()
+
+	select {
+	case g := <-ch:
+		return g.c, g.err
+	case <-ctx.Done():
+		go func() {
+			if g := <-ch; g.err == nil {
+				p.Put(g.c)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Interrupt commands of c blocked on its connection once ctx is done by
+// setting a deadline in the past. The returned stop func ends watching ctx,
+// returning whether c was interrupted.
+func interruptOnDone(ctx context.Context, c *Client) func() bool {
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if conn := c.Conn(); conn != nil {
+				conn.SetDeadline(time.Unix(1, 0))
+			}
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return <-interrupted
+	}
+}
+
+// Run runs foreground job j over a dedicated Client borrowed for the
+// duration of the "run" command, see Client.Run. Concurrent calls run jobs
+// in parallel over separate connections, rather than one at a time over a
+// single Client.
+//
+// The deadline of ctx is applied to the connection, and cancelling ctx
+// interrupts the command, see WithClient.
+func (p *Pool) Run(ctx context.Context, j *FgJob) (*JobResult, error) {
+	var result *JobResult
+	err := p.WithClient(ctx, func(c *Client) error {
+		deadline, ok := ctx.Deadline()
+		if ok {
+			if conn := c.Conn(); conn != nil {
+				if err := conn.SetDeadline(deadline); err != nil {
+					return err
+				}
+				defer conn.SetDeadline(time.Time{})
+			}
+		}
+
+		var err error
+		result, err = c.Run(j)
+		if err != nil && ok && !time.Now().Before(deadline) {
+			// The connection deadline may pass before ctx is marked done.
+			<-ctx.Done()
+		}
+		return err
+	})
+	return result, err
+}
+
+// Close closes all idle connections and stops health checks.
+// Clients borrowed are closed when returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+	close(p.done)
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+// Idle returns the number of idle connections.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+func (p *Pool) expired(c *Client) bool {
+	return p.config.MaxAge > 0 && p.opts.clock.Now().Sub(c.created) > p.config.MaxAge
+}
+
+func (p *Pool) healthLoop() {
+	t := p.opts.clock.NewTicker(p.config.HealthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C():
+			p.checkHealth()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Evict dead & expired idle connections then dial up to MinIdle.
+func (p *Pool) checkHealth() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var alive []*Client
+	for _, c := range idle {
+		if p.expired(c) || !c.alive() {
+			c.Close()
+			continue
+		}
+
+		alive = append(alive, c)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		// Closed while probing, the probed connections were not idle then.
+		p.mu.Unlock()
+		for _, c := range alive {
+			c.Close()
+		}
+		return
+	}
+
+	p.idle = append(alive, p.idle...)
+	p.mu.Unlock()
+
+	p.Warm()
+}
+
+// Probe an idle connection for liveness. The protocol has no ping command,
+// an idle connection is expected to have nothing to read: EOF or unsolicited
+// data means it is dead or out of sync. Transports without deadlines are
+// assumed alive.
+func (c *Client) alive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.poisoned {
+		return false
+	}
+
+	conn, ok := c.conn.(net.Conn)
+	if !ok {
+		return true
+	}
+
+	if c.rdr.Buffered() > 0 {
+		return false
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(healthProbeTimeout)); err != nil {
+		return false
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, err := c.rdr.Peek(1)
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
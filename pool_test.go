@@ -0,0 +1,604 @@
+package workq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Test server replying "+OK" to every line on any number of connections.
+type testOkServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newTestOkServer(t *testing.T) *testOkServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+
+	s := &testOkServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				rdr := bufio.NewReader(conn)
+				for {
+					if _, err := rdr.ReadString('\n'); err != nil {
+						return
+					}
+					conn.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+
+	return s
+}
+
+func (s *testOkServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close all accepted connections server side.
+func (s *testOkServer) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testOkServer) Close() {
+	s.ln.Close()
+	s.dropConns()
+}
+
+func TestPoolReuse(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MaxIdle: 1})
+	defer pool.Close()
+
+	c1, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+	c2, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+	if c1 == c2 {
+		t.Fatalf("Expected distinct clients while borrowed")
+	}
+
+	pool.Put(c1)
+	pool.Put(c2)
+	if pool.Idle() != 1 {
+		t.Fatalf("Idle mismatch, idle=%d", pool.Idle())
+	}
+
+	c3, err := pool.Get()
+	if err != nil || c3 != c1 {
+		t.Fatalf("Expected reused client, err=%v", err)
+	}
+
+	if err := c3.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+}
+
+func TestPoolPutPoisoned(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{})
+	defer pool.Close()
+
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+
+	c.poisoned = true
+	pool.Put(c)
+	if pool.Idle() != 0 {
+		t.Fatalf("Expected poisoned client to be discarded")
+	}
+}
+
+func TestPoolMaxAge(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MaxAge: time.Minute})
+	defer pool.Close()
+
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+
+	pool.Put(c)
+	c.created = time.Now().Add(-2 * time.Minute)
+	c2, err := pool.Get()
+	if err != nil || c2 == c {
+		t.Fatalf("Expected expired client to be replaced, err=%v", err)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MinIdle: 2})
+	defer pool.Close()
+
+	pool.checkHealth()
+	if pool.Idle() != 2 {
+		t.Fatalf("Expected warm connections, idle=%d", pool.Idle())
+	}
+
+	c, _ := pool.Get()
+	if !c.alive() {
+		t.Fatalf("Expected idle connection to be alive")
+	}
+	pool.Put(c)
+
+	// Dead connections are evicted then replaced.
+	server.dropConns()
+	time.Sleep(50 * time.Millisecond)
+	if c.alive() {
+		t.Fatalf("Expected dropped connection to be dead")
+	}
+
+	pool.checkHealth()
+	if pool.Idle() != 2 {
+		t.Fatalf("Idle mismatch, idle=%d", pool.Idle())
+	}
+
+	for i := 0; i < 2; i++ {
+		c, _ := pool.Get()
+		if err := c.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4"); err != nil {
+			t.Fatalf("Response mismatch, err=%s", err)
+		}
+	}
+}
+
+// Conn signalling the first health probe, blocking it until released.
+type probeConn struct {
+	net.Conn
+	probing chan struct{}
+	release chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *probeConn) SetReadDeadline(t time.Time) error {
+	c.once.Do(func() {
+		close(c.probing)
+		<-c.release
+	})
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *probeConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func TestPoolHealthCheckClosed(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &probeConn{Conn: client, probing: make(chan struct{}), release: make(chan struct{})}
+
+	pool := NewPool("127.0.0.1:0", PoolConfig{})
+	pool.Put(NewClient(conn))
+
+	done := make(chan struct{})
+	go func() {
+		pool.checkHealth()
+		close(done)
+	}()
+
+	<-conn.probing
+	pool.Close()
+	close(conn.release)
+	<-done
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if !conn.closed || pool.Idle() != 0 {
+		t.Fatalf("Expected probed connection closed, closed=%t, idle=%d", conn.closed, pool.Idle())
+	}
+}
+
+func TestPoolHealthLoop(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MinIdle: 1, HealthCheckInterval: 10 * time.Millisecond})
+	defer pool.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for pool.Idle() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected health loop to warm a connection")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{})
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+
+	pool.Close()
+	if _, err := pool.Get(); err != ErrPoolClosed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	pool.Put(c)
+	if pool.Idle() != 0 {
+		t.Fatalf("Expected client returned to closed pool to be closed")
+	}
+}
+
+func TestPoolMaxActive(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MaxActive: 1})
+	defer pool.Close()
+
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+
+	got := make(chan *Client)
+	go func() {
+		c, _ := pool.Get()
+		got <- c
+	}()
+
+	select {
+	case <-got:
+		t.Fatalf("Expected Get to wait for a returned client")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = pool.WithClient(ctx, func(c *Client) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	pool.Put(c)
+	if c2 := <-got; c2 != c {
+		t.Fatalf("Expected returned client, c=%p, c2=%p", c, c2)
+	}
+}
+
+func TestPoolMaxActiveFailBusy(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MaxActive: 1, FailBusy: true})
+	defer pool.Close()
+
+	err := pool.WithClient(context.Background(), func(c *Client) error {
+		if _, err := pool.Get(); err != ErrBusy {
+			t.Fatalf("Error mismatch, err=%v", err)
+		}
+
+		return NewNetError("bad")
+	})
+	if _, ok := err.(*NetError); !ok {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	c, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Expected slot freed by discarded client, err=%v", err)
+	}
+	pool.Put(c)
+}
+
+func TestPoolMaxActiveClosed(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MaxActive: 1})
+	if _, err := pool.Get(); err != nil {
+		t.Fatalf("Unable to get client, err=%s", err)
+	}
+
+	errc := make(chan error)
+	go func() {
+		_, err := pool.Get()
+		errc <- err
+	}()
+
+	pool.Close()
+	if err := <-errc; err != ErrPoolClosed {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestPoolWithClient(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{})
+	defer pool.Close()
+
+	err := pool.WithClient(context.Background(), func(c *Client) error {
+		return c.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	})
+	if err != nil || pool.Idle() != 1 {
+		t.Fatalf("Expected client returned, idle=%d, err=%v", pool.Idle(), err)
+	}
+
+	appErr := errors.New("app")
+	err = pool.WithClient(context.Background(), func(c *Client) error {
+		return appErr
+	})
+	if err != appErr || pool.Idle() != 1 {
+		t.Fatalf("Expected client returned on app error, idle=%d, err=%v", pool.Idle(), err)
+	}
+
+	err = pool.WithClient(context.Background(), func(c *Client) error {
+		return NewNetError("bad")
+	})
+	if _, ok := err.(*NetError); !ok || pool.Idle() != 0 {
+		t.Fatalf("Expected client discarded on net error, idle=%d, err=%v", pool.Idle(), err)
+	}
+}
+
+func TestPoolWithClientCanceled(t *testing.T) {
+	pool := NewPool("127.0.0.1:0", PoolConfig{})
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := pool.WithClient(ctx, func(c *Client) error {
+		t.Fatalf("Unexpected call with canceled context")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+// Listen for connections never replied to.
+func newTestSilentServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	return ln
+}
+
+func TestPoolWithClientInterrupted(t *testing.T) {
+	server := newTestSilentServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.Addr().String(), PoolConfig{})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := pool.WithClient(ctx, func(c *Client) error {
+		_, err := c.Result("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 60000)
+		return err
+	})
+	if err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("Expected interrupted command, err=%v, took=%s", err, time.Since(start))
+	}
+	if pool.Idle() != 0 {
+		t.Fatalf("Expected interrupted client discarded, idle=%d", pool.Idle())
+	}
+}
+
+func TestPoolRunDeadline(t *testing.T) {
+	server := newTestSilentServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.Addr().String(), PoolConfig{})
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	j := &FgJob{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c4", Name: "j1", TTR: 1000, Timeout: 60000}
+	if _, err := pool.Run(ctx, j); err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("Expected run cut short, err=%v, took=%s", err, time.Since(start))
+	}
+	if pool.Idle() != 0 {
+		t.Fatalf("Expected interrupted client discarded, idle=%d", pool.Idle())
+	}
+}
+
+func TestPoolWithClientDialCanceled(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	release := make(chan struct{})
+	pool := NewPool(server.addr(), PoolConfig{}, WithDialControl(func(network, address string, c syscall.RawConn) error {
+		<-release
+		return nil
+	}))
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := pool.WithClient(ctx, func(c *Client) error {
+		t.Fatalf("Unexpected call with canceled context")
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	// The connection dialed meanwhile is kept for reuse.
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for pool.Idle() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected dialed client returned to the pool")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolRunConcurrent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer ln.Close()
+
+	// Reply only once all jobs are running, deadlocking unless each runs
+	// over its own connection.
+	const n = 3
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	var running sync.WaitGroup
+	running.Add(n)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				rdr := bufio.NewReader(conn)
+				rdr.ReadString('\n')
+				rdr.ReadString('\n')
+				running.Done()
+				running.Wait()
+				conn.Write([]byte("+OK 1\r\n" + id + " 1 1\r\na\r\n"))
+			}()
+		}
+	}()
+
+	pool := NewPool(ln.Addr().String(), PoolConfig{})
+	defer pool.Close()
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := pool.Run(context.Background(), &FgJob{ID: id, Name: "j1", TTR: 1, Timeout: 1000})
+			if err == nil && !result.Success {
+				err = errors.New("unexpected failure")
+			}
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("Run mismatch, err=%s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for concurrent runs")
+		}
+	}
+
+	if pool.Idle() != n {
+		t.Fatalf("Idle mismatch, idle=%d", pool.Idle())
+	}
+}
+
+func TestPoolWarm(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MinIdle: 2})
+	defer pool.Close()
+
+	if err := pool.Warm(); err != nil || pool.Idle() != 2 {
+		t.Fatalf("Warm mismatch, idle=%d, err=%v", pool.Idle(), err)
+	}
+
+	// Connections discarded as out of sync are replaced in the background.
+	c, _ := pool.Get()
+	c.poisoned = true
+	pool.Put(c)
+	deadline := time.Now().Add(time.Second)
+	for pool.Idle() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected discarded connection replaced, idle=%d", pool.Idle())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	pool.Close()
+	if err := pool.Warm(); err != ErrPoolClosed {
+		t.Fatalf("Warm error mismatch, err=%v", err)
+	}
+}
+
+func TestPoolPrefill(t *testing.T) {
+	server := newTestOkServer(t)
+	defer server.Close()
+
+	pool := NewPool(server.addr(), PoolConfig{MinIdle: 3})
+	defer pool.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for pool.Idle() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected pool prefilled, idle=%d", pool.Idle())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package workq
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Max bytes kept from the start of each recorded frame.
+const frameHeadLen = 64
+
+// Frame describes a chunk of bytes sent or received over the connection.
+type Frame struct {
+	Time time.Time
+	Sent bool   // Sent to the server, received otherwise.
+	Size int    // Total size of the frame.
+	Head []byte // First bytes of the frame, up to 64 bytes.
+}
+
+func (f Frame) String() string {
+	dir := "recv"
+	if f.Sent {
+		dir = "sent"
+	}
+
+	return fmt.Sprintf("%s %s %d %q", f.Time.Format(time.RFC3339Nano), dir, f.Size, f.Head)
+}
+
+// Ring buffer of the most recent frames.
+type flightRecorder struct {
+	mu     sync.Mutex
+	ring   []Frame
+	next   int
+	full   bool
+	redact Redactor // Applied to frames before keeping them, may be nil.
+	clock  Clock
+}
+
+func newFlightRecorder(n int, clock Clock) *flightRecorder {
+	return &flightRecorder{ring: make([]Frame, n), clock: clock}
+}
+
+func (r *flightRecorder) record(sent bool, b []byte) {
+	size := len(b)
+	if r.redact != nil {
+		b = r.redact(b)
+	}
+
+	head := b
+	if len(head) > frameHeadLen {
+		head = head[:frameHeadLen]
+	}
+
+	f := Frame{
+		Time: r.clock.Now(),
+		Sent: sent,
+		Size: size,
+		Head: append([]byte(nil), head...),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ring[r.next] = f
+	r.next = (r.next + 1) % len(r.ring)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Return recorded frames, oldest first.
+func (r *flightRecorder) frames() []Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Frame(nil), r.ring[:r.next]...)
+	}
+
+	return append(append([]Frame(nil), r.ring[r.next:]...), r.ring[:r.next]...)
+}
+
+// Records every chunk read from the connection as a received frame.
+type recordingReader struct {
+	rdr      io.Reader
+	recorder *flightRecorder
+}
+
+func (r *recordingReader) Read(b []byte) (int, error) {
+	n, err := r.rdr.Read(b)
+	if n > 0 {
+		r.recorder.record(false, b[:n])
+	}
+
+	return n, err
+}
@@ -0,0 +1,56 @@
+package workq
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithFlightRecorder(4))
+	err := client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	frames := client.DebugDump()
+	if len(frames) != 2 {
+		t.Fatalf("Frame count mismatch, frames=%v", frames)
+	}
+
+	sent := []byte("delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n")
+	if !frames[0].Sent || frames[0].Size != len(sent) || !bytes.Equal(frames[0].Head, sent) {
+		t.Fatalf("Sent frame mismatch, frame=%s", frames[0])
+	}
+
+	if frames[1].Sent || frames[1].Size != 5 || string(frames[1].Head) != "+OK\r\n" {
+		t.Fatalf("Received frame mismatch, frame=%s", frames[1])
+	}
+
+	if !strings.Contains(frames[1].String(), `recv 5 "+OK\r\n"`) {
+		t.Fatalf("Frame string mismatch, act=%s", frames[1])
+	}
+}
+
+func TestDebugDumpDisabled(t *testing.T) {
+	client := NewClient(&TestConn{})
+	if client.DebugDump() != nil {
+		t.Fatalf("Expected no frames when disabled")
+	}
+}
+
+func TestFlightRecorderWraps(t *testing.T) {
+	r := newFlightRecorder(2, SystemClock)
+	r.record(true, []byte("a"))
+	r.record(false, []byte("b"))
+	r.record(true, bytes.Repeat([]byte("c"), 100))
+
+	frames := r.frames()
+	if len(frames) != 2 || string(frames[0].Head) != "b" || frames[1].Size != 100 || len(frames[1].Head) != frameHeadLen {
+		t.Fatalf("Frames mismatch, frames=%v", frames)
+	}
+}
@@ -0,0 +1,40 @@
+package workq
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Replacement for redacted values.
+const redacted = "[REDACTED]"
+
+// Redactor returns b with sensitive data masked, see WithRedactor.
+// It must not modify b, which is still in use, but return a copy instead.
+type Redactor func(b []byte) []byte
+
+// RedactPattern returns a Redactor replacing every match of re.
+func RedactPattern(re *regexp.Regexp) Redactor {
+	repl := []byte(redacted)
+	return func(b []byte) []byte {
+		return re.ReplaceAll(b, repl)
+	}
+}
+
+// RedactJSONFields returns a Redactor replacing the string and scalar values
+// of the named fields within JSON payloads, at any depth. Strings cut short
+// at the end of a frame are replaced as well.
+func RedactJSONFields(fields ...string) Redactor {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = regexp.QuoteMeta(f)
+	}
+
+	re := regexp.MustCompile(
+		`("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)` +
+			`(?:"(?:[^"\\]|\\.)*(?:"|\\?$)|[^,}\]\s]+)`,
+	)
+	repl := []byte(`${1}"` + redacted + `"`)
+	return func(b []byte) []byte {
+		return re.ReplaceAll(b, repl)
+	}
+}
@@ -0,0 +1,82 @@
+package workq
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestRedactPattern(t *testing.T) {
+	r := RedactPattern(regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`))
+	in := []byte("card 4111-1111-1111-1111 ok")
+	if act := r(in); string(act) != "card [REDACTED] ok" {
+		t.Fatalf("Redact mismatch, act=%q", act)
+	}
+	if string(in) != "card 4111-1111-1111-1111 ok" {
+		t.Fatalf("Input modified, in=%q", in)
+	}
+}
+
+func TestRedactJSONFields(t *testing.T) {
+	r := RedactJSONFields("email", "ssn")
+	tests := []struct {
+		in  string
+		exp string
+	}{
+		{
+			`{"email":"a@b.c","name":"x"}`,
+			`{"email":"[REDACTED]","name":"x"}`,
+		},
+		{
+			`{"user": {"ssn" : 123456789, "email": "a\"b@c"}}`,
+			`{"user": {"ssn" : "[REDACTED]", "email": "[REDACTED]"}}`,
+		},
+		{
+			"add 6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 1 1 30\r\n{\"email\":\"trunc",
+			"add 6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 1 1 30\r\n{\"email\":\"[REDACTED]\"",
+		},
+		{
+			`{"emails":["a@b.c"]}`,
+			`{"emails":["a@b.c"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		if act := r([]byte(tt.in)); string(act) != tt.exp {
+			t.Fatalf("Redact mismatch, in=%q, act=%q", tt.in, act)
+		}
+	}
+}
+
+func TestFlightRecorderRedacts(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK 1\r\n6ba7b810-9dad-11d1-80b4-00c04fd430c4 1 17\r\n{\"email\":\"a@b.c\"}\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn, WithFlightRecorder(4), WithRedactor(RedactJSONFields("email")))
+	j := &FgJob{
+		ID:      "6ba7b810-9dad-11d1-80b4-00c04fd430c4",
+		Name:    "j1",
+		Payload: []byte(`{"email":"a@b.c"}`),
+	}
+	if _, err := client.Run(j); err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if !bytes.Contains(conn.wrt.Bytes(), []byte("a@b.c")) {
+		t.Fatalf("Expected unredacted write, act=%q", conn.wrt.Bytes())
+	}
+
+	frames := client.DebugDump()
+	if len(frames) != 2 {
+		t.Fatalf("Frame count mismatch, frames=%v", frames)
+	}
+	for _, f := range frames {
+		if bytes.Contains(f.Head, []byte("a@b.c")) || !bytes.Contains(f.Head, []byte(`"email":"[R`)) {
+			t.Fatalf("Expected redacted frame, frame=%s", f)
+		}
+	}
+	if frames[0].Size != conn.wrt.Len() {
+		t.Fatalf("Size mismatch, size=%d", frames[0].Size)
+	}
+}
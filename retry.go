@@ -0,0 +1,143 @@
+package workq
+
+import (
+	"time"
+)
+
+// RetryPolicy configures how a RetryingClient retries a command.
+type RetryPolicy struct {
+	MaxAttempts int // Attempts including the first, 1 or less disables retries.
+
+	// Bounds of the jittered exponential backoff between attempts, default
+	// to 50ms and 2s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Decides whether an error is retried, defaults to IsRetryable.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicies returns policies retrying the only idempotent
+// command, "result", up to 3 attempts.
+//
+// "complete", "fail" and "delete" are not retried by default: a retry
+// returns NOT-FOUND when the server applied the attempt interrupted by a
+// NetError, turning a success into a failure.
+func DefaultRetryPolicies() map[string]RetryPolicy {
+	return map[string]RetryPolicy{
+		"result": {MaxAttempts: 3},
+	}
+}
+
+// RetryingClient executes commands through a Client, retrying failed
+// commands by the policy of their command name. Commands without a policy
+// are not retried.
+//
+// Retrying after a NetError requires WithReconnect, the connection is
+// otherwise left out of sync and the retry returns ErrPoisoned.
+type RetryingClient struct {
+	client   *Client
+	policies map[string]RetryPolicy
+}
+
+// NewRetryingClient returns a RetryingClient for c retrying commands by
+// policies keyed by command name, DefaultRetryPolicies if nil.
+func NewRetryingClient(c *Client, policies map[string]RetryPolicy) *RetryingClient {
+	if policies == nil {
+		policies = DefaultRetryPolicies()
+	}
+
+	return &RetryingClient{client: c, policies: policies}
+}
+
+// Client returns the underlying Client.
+func (r *RetryingClient) Client() *Client {
+	return r.client
+}
+
+// Add calls Client.Add, retrying by the "add" policy.
+func (r *RetryingClient) Add(j *BgJob) error {
+	return r.retry("add", func() error {
+		return r.client.Add(j)
+	})
+}
+
+// Run calls Client.Run, retrying by the "run" policy.
+func (r *RetryingClient) Run(j *FgJob) (*JobResult, error) {
+	var result *JobResult
+	err := r.retry("run", func() (err error) {
+		result, err = r.client.Run(j)
+		return err
+	})
+	return result, err
+}
+
+// Schedule calls Client.Schedule, retrying by the "schedule" policy.
+func (r *RetryingClient) Schedule(j *ScheduledJob) error {
+	return r.retry("schedule", func() error {
+		return r.client.Schedule(j)
+	})
+}
+
+// Result calls Client.Result, retrying by the "result" policy.
+func (r *RetryingClient) Result(id string, timeout int) (*JobResult, error) {
+	var result *JobResult
+	err := r.retry("result", func() (err error) {
+		result, err = r.client.Result(id, timeout)
+		return err
+	})
+	return result, err
+}
+
+// Lease calls Client.Lease, retrying by the "lease" policy.
+func (r *RetryingClient) Lease(names []string, timeout int) (*LeasedJob, error) {
+	var j *LeasedJob
+	err := r.retry("lease", func() (err error) {
+		j, err = r.client.Lease(names, timeout)
+		return err
+	})
+	return j, err
+}
+
+// Complete calls Client.Complete, retrying by the "complete" policy.
+func (r *RetryingClient) Complete(id string, result []byte) error {
+	return r.retry("complete", func() error {
+		return r.client.Complete(id, result)
+	})
+}
+
+// Fail calls Client.Fail, retrying by the "fail" policy.
+func (r *RetryingClient) Fail(id string, result []byte) error {
+	return r.retry("fail", func() error {
+		return r.client.Fail(id, result)
+	})
+}
+
+// Delete calls Client.Delete, retrying by the "delete" policy.
+func (r *RetryingClient) Delete(id string) error {
+	return r.retry("delete", func() error {
+		return r.client.Delete(id)
+	})
+}
+
+func (r *RetryingClient) retry(cmd string, fn func() error) error {
+	p := r.policies[cmd]
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = minRetryBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = maxRetryBackoff
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+
+	for n := 0; ; n++ {
+		err := fn()
+		if err == nil || n+1 >= p.MaxAttempts || !p.Retryable(err) {
+			return err
+		}
+
+		Sleep(r.client.opts.clock, JitteredBackoff(n, p.MinBackoff, p.MaxBackoff))
+	}
+}
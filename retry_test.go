@@ -0,0 +1,61 @@
+package workq
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRetryingClient(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte(
+			"-SERVER-ERROR a\r\n+OK 1\r\n" + id + " 1 1\r\na\r\n" + // result, retried
+				"-SERVER-ERROR a\r\n" + // add, not retried by default
+				"-SERVER-ERROR a\r\n", // delete, not idempotent
+		)),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	policies := DefaultRetryPolicies()
+	for cmd, p := range policies {
+		p.MinBackoff = time.Millisecond
+		policies[cmd] = p
+	}
+	client := NewRetryingClient(NewClient(conn), policies)
+
+	if result, err := client.Result(id, 1000); err != nil || string(result.Result) != "a" {
+		t.Fatalf("Result mismatch, result=%+v, err=%v", result, err)
+	}
+	if err := client.Add(&BgJob{ID: id, Name: "j1"}); !IsServerError(err) {
+		t.Fatalf("Add mismatch, err=%v", err)
+	}
+	if err := client.Delete(id); !IsServerError(err) {
+		t.Fatalf("Delete mismatch, err=%v", err)
+	}
+
+	exp := "result " + id + " 1000\r\n" + "result " + id + " 1000\r\n" +
+		"add " + id + " j1 0 0 0\r\n\r\n" +
+		"delete " + id + "\r\n"
+	if act := conn.wrt.String(); act != exp {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
+
+func TestRetryingClientMaxAttempts(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-CLIENT-ERROR a\r\n-CLIENT-ERROR b\r\n-CLIENT-ERROR c\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewRetryingClient(NewClient(conn), map[string]RetryPolicy{
+		"add": {
+			MaxAttempts: 2,
+			MinBackoff:  time.Millisecond,
+			Retryable:   IsClientError,
+		},
+	})
+
+	err := client.Add(&BgJob{ID: "6ba7b810-9dad-11d1-80b4-00c04fd430c4", Name: "j1"})
+	if rerr, ok := err.(*ResponseError); !ok || rerr.Text() != "b" {
+		t.Fatalf("Add mismatch, err=%v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package workq
+
+import (
+	"context"
+	"time"
+)
+
+// Skew beyond which ProbeSkew logs a warning, above the error of whole second
+// schedule times.
+var maxClockSkew = 2 * time.Second
+
+// ProbeSkew estimates how far the server clock lags behind the client clock
+// by scheduling a probe job delay ahead and timing when it becomes
+// leasable, negative if the server clock runs ahead. Skew silently shifts
+// all scheduled jobs.
+//
+// The estimate is published as EventClockSkew and logged when beyond 2s.
+// It includes the lag of the server scheduler and the lease round trip.
+//
+// name must be leased by no one else, e.g. "skew-probe.<hostname>". The
+// probe job is deleted once leased or when ctx is done.
+func (c *Client) ProbeSkew(ctx context.Context, name string, delay time.Duration) (time.Duration, error) {
+	id := NewUUID().String()
+	clock := c.opts.clock
+	at := c.opts.roundTime(clock.Now().Add(delay))
+	err := c.Schedule(&ScheduledJob{
+		ID:   id,
+		Name: name,
+		TTR:  1000,
+		TTL:  int((delay + time.Minute) / time.Millisecond),
+		At:   at,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer c.Delete(id)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		wait := at.Sub(clock.Now()) + time.Second
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := time.Until(deadline); left < wait {
+				wait = left
+			}
+		}
+		timeout := int(wait / time.Millisecond)
+		if timeout < 1 {
+			timeout = 1
+		}
+
+		j, err := c.Lease([]string{name}, timeout)
+		if IsTimedOut(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if j.ID != id {
+			// Left over from an earlier probe.
+			c.Delete(j.ID)
+			continue
+		}
+
+		skew := clock.Now().Sub(at)
+		c.publish(Event{Type: EventClockSkew, Duration: skew})
+		if (skew > maxClockSkew || skew < -maxClockSkew) && c.opts.logger != nil {
+			c.opts.logger.Printf("workq: server clock skew of %s", skew)
+		}
+
+		return skew, nil
+	}
+}
@@ -0,0 +1,69 @@
+package workq
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves a probe job leasable at once, after a timed out lease and a job
+// left over from an earlier probe.
+type skewConn struct {
+	TestConn
+}
+
+func (c *skewConn) Write(b []byte) (int, error) {
+	if strings.HasPrefix(string(b), "schedule ") {
+		id := strings.Fields(string(b))[1]
+		c.rdr.WriteString(
+			"+OK\r\n" +
+				"-TIMED-OUT\r\n" +
+				"+OK 1\r\n6ba7b810-9dad-11d1-80b4-00c04fd430c4 probe 1000 0\r\n\r\n" +
+				"+OK\r\n" +
+				"+OK 1\r\n" + id + " probe 1000 0\r\n\r\n" +
+				"+OK\r\n",
+		)
+	}
+
+	return c.TestConn.Write(b)
+}
+
+func TestProbeSkew(t *testing.T) {
+	conn := &skewConn{TestConn{
+		rdr: bytes.NewBuffer([]byte("")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}}
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(20)
+	client := NewClient(conn, WithEventBus(bus))
+
+	skew, err := client.ProbeSkew(context.Background(), "probe", 0)
+	if err != nil {
+		t.Fatalf("ProbeSkew mismatch, err=%s", err)
+	}
+	if skew > 0 || skew < -time.Second {
+		t.Fatalf("Skew mismatch, skew=%s", skew)
+	}
+
+	cmds := strings.Split(strings.TrimSpace(conn.wrt.String()), "\r\n")
+	var names []string
+	for _, cmd := range cmds {
+		if cmd != "" {
+			names = append(names, strings.Fields(cmd)[0])
+		}
+	}
+	exp := "schedule lease lease delete lease delete"
+	if act := strings.Join(names, " "); act != exp {
+		t.Fatalf("Commands mismatch, act=%q", act)
+	}
+
+	cancel()
+	for e := range events {
+		if e.Type == EventClockSkew && e.Duration == skew {
+			return
+		}
+	}
+	t.Fatalf("Expected clock skew event")
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package workq
+
+import (
+	"errors"
+)
+
+func setSocketBuffers(fd uintptr, read int, write int) error {
+	return errors.New("Socket buffers not supported")
+}
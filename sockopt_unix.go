@@ -0,0 +1,21 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package workq
+
+import (
+	"syscall"
+)
+
+func setSocketBuffers(fd uintptr, read int, write int) error {
+	if read > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, read); err != nil {
+			return err
+		}
+	}
+	if write > 0 {
+		return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, write)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package workq
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestSocketBuffersBeforeConnect(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	// Custom dial controls run after the buffers were set, still before
+	// connecting.
+	var rcvbuf, sndbuf int
+	client, err := Connect(
+		server.Addr().String(),
+		WithSocketBuffers(4096, 4096),
+		WithDialControl(func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				rcvbuf, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+				sndbuf, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	// Linux doubles the requested sizes for bookkeeping.
+	if rcvbuf < 4096 || rcvbuf > 2*4096 || sndbuf < 4096 || sndbuf > 2*4096 {
+		t.Fatalf("Socket buffers mismatch, rcvbuf=%d, sndbuf=%d", rcvbuf, sndbuf)
+	}
+}
@@ -0,0 +1,20 @@
+package workq
+
+import (
+	"crypto/tls"
+)
+
+// ReloadingClientCertificate returns a tls.Config.GetClientCertificate
+// function loading the PEM encoded key pair from disk on every TLS handshake.
+// Certificates rotated on disk are used by the next connection without
+// restarting the process.
+func ReloadingClientCertificate(certFile string, keyFile string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cert, nil
+	}
+}
@@ -0,0 +1,153 @@
+package workq
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write a self-signed certificate valid for both server and client auth
+// returning the cert & key file paths.
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key, err=%s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create cert, err=%s", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key, err=%s", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatalf("Unable to write cert, err=%s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatalf("Unable to write key, err=%s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestConnectMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workq-tls")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir, err=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeTestCert(t, dir)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Unable to load cert, err=%s", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(mustParseCert(t, cert))
+
+	server, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer server.Close()
+
+	peerCerts := make(chan int, 1)
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rdr := bufio.NewReader(conn)
+		if _, err := rdr.ReadString('\n'); err != nil {
+			peerCerts <- 0
+			return
+		}
+
+		peerCerts <- len(conn.(*tls.Conn).ConnectionState().PeerCertificates)
+		conn.Write([]byte("+OK\r\n"))
+	}()
+
+	client, err := Connect(server.Addr().String(), WithTLSConfig(&tls.Config{
+		RootCAs:              pool,
+		GetClientCertificate: ReloadingClientCertificate(certFile, keyFile),
+	}))
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if n := <-peerCerts; n != 1 {
+		t.Fatalf("Peer certificate mismatch, count=%d", n)
+	}
+}
+
+func TestReloadingClientCertificateMissing(t *testing.T) {
+	get := ReloadingClientCertificate("/nonexistent/cert.pem", "/nonexistent/key.pem")
+	if _, err := get(&tls.CertificateRequestInfo{}); err == nil {
+		t.Fatalf("Expected error loading missing key pair")
+	}
+}
+
+func mustParseCert(t *testing.T, cert tls.Certificate) *x509.Certificate {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Unable to parse cert, err=%s", err)
+	}
+
+	return c
+}
+
+func TestConnectTLSHandshakeTimeout(t *testing.T) {
+	server := newTestSilentServer(t)
+	defer server.Close()
+
+	start := time.Now()
+	_, err := Connect(server.Addr().String(), WithDialTimeout(50*time.Millisecond), WithTLSConfig(&tls.Config{}))
+	nerr, ok := err.(net.Error)
+	if !ok || !nerr.Timeout() || time.Since(start) > time.Second {
+		t.Fatalf("Expected handshake timeout, err=%v, took=%s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,60 @@
+package workq
+
+import (
+	"encoding/hex"
+
+	"github.com/satori/go.uuid"
+)
+
+// UUID is a job ID in binary form, 16 bytes instead of the 36 of its string
+// form, for systems keeping large numbers of job IDs around.
+//
+// Set as the UUID of a job in place of its ID, it is only formatted when the
+// command is written.
+type UUID [16]byte
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() UUID {
+	return UUID(uuid.NewV4())
+}
+
+// ParseUUID parses a job ID, e.g. of a leased job, into binary form.
+// Returns ErrInvalidID if s is not a UUID.
+func ParseUUID(s string) (UUID, error) {
+	u, err := uuid.FromString(s)
+	if err != nil {
+		return UUID{}, ErrInvalidID
+	}
+
+	return UUID(u), nil
+}
+
+// IsZero returns whether u is unset.
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// String returns the canonical form of u,
+// e.g. "6ba7b810-9dad-11d1-80b4-00c04fd430c4".
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// ID sent for a job, formatting its binary UUID if no string ID is set.
+func jobID(id string, u UUID) string {
+	if id == "" && !u.IsZero() {
+		return u.String()
+	}
+
+	return id
+}
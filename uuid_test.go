@@ -0,0 +1,45 @@
+package workq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	u, err := ParseUUID(id)
+	if err != nil {
+		t.Fatalf("Parse mismatch, err=%s", err)
+	}
+	if u.String() != id || u.IsZero() {
+		t.Fatalf("UUID mismatch, act=%s", u)
+	}
+
+	if _, err := ParseUUID("a"); err != ErrInvalidID {
+		t.Fatalf("Parse error mismatch, err=%v", err)
+	}
+
+	if n := NewUUID(); n.IsZero() || ValidateID(n.String()) != nil {
+		t.Fatalf("New UUID mismatch, act=%s", n)
+	}
+}
+
+func TestAddUUID(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	u, _ := ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err := client.Add(&BgJob{UUID: u, Name: "j1", TTR: 1, TTL: 2}); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+	if err := client.Add(&BgJob{ID: "a", UUID: u, Name: "j1", TTR: 1, TTL: 2}); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+
+	exp := "add 6ba7b810-9dad-11d1-80b4-00c04fd430c4 j1 1 2 0\r\n\r\n" + "add a j1 1 2 0\r\n\r\n"
+	if act := conn.wrt.String(); act != exp {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
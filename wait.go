@@ -0,0 +1,58 @@
+package workq
+
+import (
+	"context"
+	"time"
+)
+
+// Shortest server side wait of a poll of WaitResult.
+const minPollInterval = 50 * time.Millisecond
+
+// AddAndWait adds background job j, then waits for its result until ctx is
+// done, for callers wanting the durability of a background job yet still
+// needing its result. See WaitResult for polling.
+func (c *Client) AddAndWait(ctx context.Context, j *BgJob, pollInterval time.Duration) (*JobResult, error) {
+	if err := c.Add(j); err != nil {
+		return nil, err
+	}
+
+	return c.WaitResult(ctx, jobID(j.ID, j.UUID), pollInterval)
+}
+
+// WaitResult waits for the result of job id until ctx is done, absorbing
+// TIMED-OUT replies. Returns ctx.Err() once ctx is done.
+//
+// Each poll is a "result" command waiting up to pollInterval server side, or
+// up to the deadline of ctx if sooner, holding the connection meanwhile.
+// Intervals below 50ms, including non-positive ones, are raised to 50ms to
+// not flood the server. ctx is checked between polls.
+func (c *Client) WaitResult(ctx context.Context, id string, pollInterval time.Duration) (*JobResult, error) {
+	if pollInterval < minPollInterval {
+		pollInterval = minPollInterval
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		wait := pollInterval
+		if deadline, ok := ctx.Deadline(); ok {
+			// Context deadlines are wall clock times, unlike the client clock.
+			if left := time.Until(deadline); left < wait {
+				wait = left
+			}
+		}
+		timeout := int(wait / time.Millisecond)
+		if timeout < 1 {
+			timeout = 1
+		}
+
+		result, err := c.Result(id, timeout)
+		if IsTimedOut(err) {
+			continue
+		}
+
+		return result, err
+	}
+}
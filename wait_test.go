@@ -0,0 +1,114 @@
+package workq
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddAndWait(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n-TIMED-OUT\r\n+OK 1\r\n" + id + " 1 1\r\na\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	result, err := client.AddAndWait(context.Background(), &BgJob{ID: id, Name: "j1", TTR: 1, TTL: 2}, 50*time.Millisecond)
+	if err != nil || !reflect.DeepEqual(&JobResult{ID: id, Success: true, Result: []byte("a")}, result) {
+		t.Fatalf("Result mismatch, result=%+v, err=%v", result, err)
+	}
+
+	exp := "add " + id + " j1 1 2 0\r\n\r\n" + "result " + id + " 50\r\n" + "result " + id + " 50\r\n"
+	if act := conn.wrt.String(); act != exp {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
+
+func TestWaitResultMinPollInterval(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	for _, interval := range []time.Duration{0, -time.Second, time.Nanosecond} {
+		conn := &TestConn{
+			rdr: bytes.NewBuffer([]byte("-TIMED-OUT\r\n+OK 1\r\n" + id + " 1 1\r\na\r\n")),
+			wrt: bytes.NewBuffer([]byte("")),
+		}
+		if _, err := NewClient(conn).WaitResult(context.Background(), id, interval); err != nil {
+			t.Fatalf("Result mismatch, interval=%s, err=%v", interval, err)
+		}
+
+		exp := "result " + id + " 50\r\n" + "result " + id + " 50\r\n"
+		if act := conn.wrt.String(); act != exp {
+			t.Fatalf("Write mismatch, interval=%s, act=%q", interval, act)
+		}
+	}
+}
+
+func TestAddAndWaitCancel(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("+OK\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.AddAndWait(ctx, &BgJob{ID: id, Name: "j1", TTR: 1, TTL: 2}, time.Millisecond)
+	if err != context.Canceled {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if act := conn.wrt.String(); act != "add "+id+" j1 1 2 0\r\n\r\n" {
+		t.Fatalf("Write mismatch, act=%q", act)
+	}
+}
+
+func TestAddAndWaitAddError(t *testing.T) {
+	conn := &TestConn{
+		rdr: bytes.NewBuffer([]byte("-CLIENT-ERROR Invalid\r\n")),
+		wrt: bytes.NewBuffer([]byte("")),
+	}
+	client := NewClient(conn)
+	_, err := client.AddAndWait(context.Background(), &BgJob{ID: "a", Name: "j1"}, time.Millisecond)
+	if !reflect.DeepEqual(annotated("add", "a", NewResponseError("CLIENT-ERROR", "Invalid")), err) {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+// Conn replying TIMED-OUT to every read after a delay.
+type timedOutConn struct {
+	wrt bytes.Buffer
+}
+
+func (c *timedOutConn) Read(b []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return copy(b, "-TIMED-OUT\r\n"), nil
+}
+
+func (c *timedOutConn) Write(b []byte) (int, error) {
+	return c.wrt.Write(b)
+}
+
+func (c *timedOutConn) Close() error {
+	return nil
+}
+
+func TestWaitResultDeadline(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	conn := &timedOutConn{}
+	client := NewClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitResult(ctx, id, time.Hour)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	// Polls are cut short to the deadline rather than waiting an hour.
+	line, _ := conn.wrt.ReadString('\n')
+	if !strings.HasPrefix(line, "result "+id+" ") || len(line) > len("result "+id+" 50\r\n") {
+		t.Fatalf("Expected poll clamped to deadline, act=%q", line)
+	}
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Sliding windows are tracked in this many buckets, expiring a bucket at a
+// time.
+const budgetBuckets = 10
+
+// ErrorBudget tracks job outcomes per job name over a sliding window, e.g.
+// for SLO based alerting or pausing job names failing too often, see
+// Config.PauseOverBudget. Safe for concurrent use.
+type ErrorBudget struct {
+	Window         time.Duration // Defaults to 1 minute.
+	MaxFailureRate float64       // Failure rate over which a name exceeds its budget, e.g. 0.05.
+	MinJobs        int           // Jobs within the window before the budget applies, defaults to 10.
+
+	// Called when a job name exceeds its budget, once until it is within
+	// budget again. Must not block.
+	OnExceeded func(s BudgetStats)
+
+	Clock workq.Clock // Clock of the window, defaults to workq.SystemClock.
+
+	mu    sync.Mutex
+	names map[string]*budgetWindow
+}
+
+// BudgetStats are the outcomes of a job name within the window.
+type BudgetStats struct {
+	Name        string
+	Succeeded   int
+	Failed      int
+	FailureRate float64
+	Exceeded    bool
+}
+
+type budgetBucket struct {
+	slot      int64 // Window slot counted, expired once past the window.
+	succeeded int
+	failed    int
+}
+
+type budgetWindow struct {
+	buckets  [budgetBuckets]budgetBucket
+	exceeded bool
+}
+
+// Record the outcome of a job of name.
+func (b *ErrorBudget) record(name string, failed bool) {
+	b.mu.Lock()
+	if b.names == nil {
+		b.names = make(map[string]*budgetWindow)
+	}
+	w := b.names[name]
+	if w == nil {
+		w = &budgetWindow{}
+		b.names[name] = w
+	}
+
+	slot := b.slot(b.now())
+	bucket := &w.buckets[slot%budgetBuckets]
+	if bucket.slot != slot {
+		*bucket = budgetBucket{slot: slot}
+	}
+	if failed {
+		bucket.failed++
+	} else {
+		bucket.succeeded++
+	}
+
+	s := b.stats(name, w, slot)
+	notify := s.Exceeded && !w.exceeded
+	w.exceeded = s.Exceeded
+	b.mu.Unlock()
+
+	if notify && b.OnExceeded != nil {
+		b.OnExceeded(s)
+	}
+}
+
+// Stats returns the outcomes within the window of each job name recorded,
+// ordered by name.
+func (b *ErrorBudget) Stats() []BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slot := b.slot(b.now())
+	stats := make([]BudgetStats, 0, len(b.names))
+	for name, w := range b.names {
+		stats = append(stats, b.stats(name, w, slot))
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// Exceeded returns whether job name is currently over budget.
+func (b *ErrorBudget) Exceeded(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := b.names[name]
+	if w == nil {
+		return false
+	}
+
+	s := b.stats(name, w, b.slot(b.now()))
+	w.exceeded = s.Exceeded
+	return s.Exceeded
+}
+
+func (b *ErrorBudget) stats(name string, w *budgetWindow, slot int64) BudgetStats {
+	s := BudgetStats{Name: name}
+	for _, bucket := range w.buckets {
+		if slot-bucket.slot < budgetBuckets {
+			s.Succeeded += bucket.succeeded
+			s.Failed += bucket.failed
+		}
+	}
+
+	total := s.Succeeded + s.Failed
+	if total > 0 {
+		s.FailureRate = float64(s.Failed) / float64(total)
+	}
+
+	minJobs := b.MinJobs
+	if minJobs <= 0 {
+		minJobs = 10
+	}
+	s.Exceeded = total >= minJobs && s.FailureRate > b.MaxFailureRate
+	return s
+}
+
+func (b *ErrorBudget) now() time.Time {
+	if b.Clock == nil {
+		return workq.SystemClock.Now()
+	}
+
+	return b.Clock.Now()
+}
+
+// Window slot of t, each a bucket wide.
+func (b *ErrorBudget) slot(t time.Time) int64 {
+	window := b.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	return t.UnixNano() / int64(window/budgetBuckets)
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestErrorBudget(t *testing.T) {
+	var exceeded []BudgetStats
+	b := &ErrorBudget{
+		MaxFailureRate: 0.5,
+		MinJobs:        4,
+		OnExceeded: func(s BudgetStats) {
+			exceeded = append(exceeded, s)
+		},
+	}
+
+	b.record("j1", true)
+	b.record("j1", true)
+	b.record("j1", true)
+	if b.Exceeded("j1") || len(exceeded) != 0 {
+		t.Fatalf("Expected budget not applied below min jobs")
+	}
+
+	b.record("j1", false)
+	b.record("j1", true)
+	b.record("j2", false)
+	if !b.Exceeded("j1") || b.Exceeded("j2") || b.Exceeded("j3") {
+		t.Fatalf("Exceeded mismatch, stats=%+v", b.Stats())
+	}
+
+	exp := []BudgetStats{
+		{Name: "j1", Succeeded: 1, Failed: 4, FailureRate: 0.8, Exceeded: true},
+		{Name: "j2", Succeeded: 1},
+	}
+	if act := b.Stats(); !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Stats mismatch, act=%+v", act)
+	}
+	crossed := BudgetStats{Name: "j1", Succeeded: 1, Failed: 3, FailureRate: 0.75, Exceeded: true}
+	if len(exceeded) != 1 || exceeded[0] != crossed {
+		t.Fatalf("Exceeded events mismatch, act=%+v", exceeded)
+	}
+}
+
+func TestErrorBudgetWindow(t *testing.T) {
+	clock := workqtest.NewFakeClock(time.Now())
+	b := &ErrorBudget{Window: 20 * time.Millisecond, MinJobs: 1, Clock: clock}
+	b.record("j1", true)
+	if !b.Exceeded("j1") {
+		t.Fatalf("Expected budget exceeded")
+	}
+
+	clock.Advance(30 * time.Millisecond)
+	if b.Exceeded("j1") {
+		t.Fatalf("Expected failures aged out, stats=%+v", b.Stats())
+	}
+}
+
+func TestWorkerPausesOverBudget(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "err"}, testJob{id2, "j1", "err"})
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		return nil, errors.New("bad payload")
+	})
+	budget := &ErrorBudget{MinJobs: 2}
+	w := New(&testPool{s}, h, Config{
+		Names:           []string{"j1", "j2"},
+		LeaseTimeout:    1,
+		Budget:          budget,
+		PauseOverBudget: true,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+	s.waitDone(t, 2)
+	cancel()
+	<-errc
+
+	if act := w.leasable(); !reflect.DeepEqual([]string{"j2"}, act) {
+		t.Fatalf("Leasable mismatch, act=%v", act)
+	}
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// JobInfo describes the job a handler context belongs to. Attempt and
+// failure counts are not included as leases do not carry them.
+type JobInfo struct {
+	ID     string
+	Name   string
+	TTR    int       // Milliseconds.
+	Leased time.Time // When the lease command returned the job.
+}
+
+// Deadline returns when the lease expires by the client clock, after which
+// the job may be leased again.
+func (i JobInfo) Deadline() time.Time {
+	return i.Leased.Add(time.Duration(i.TTR) * time.Millisecond)
+}
+
+type jobInfoKey struct{}
+
+type clockKey struct{}
+
+// Add info of j leased at leased to ctx.
+func withJobInfo(ctx context.Context, j *workq.LeasedJob, leased time.Time) context.Context {
+	return context.WithValue(ctx, jobInfoKey{}, JobInfo{
+		ID:     j.ID,
+		Name:   j.Name,
+		TTR:    j.TTR,
+		Leased: leased,
+	})
+}
+
+// JobInfoFromContext returns the info of the job a Worker passed ctx to a
+// handler for, false for other contexts.
+func JobInfoFromContext(ctx context.Context) (JobInfo, bool) {
+	info, ok := ctx.Value(jobInfoKey{}).(JobInfo)
+	return info, ok
+}
+
+// Clock of the Worker of a handler context, workq.SystemClock for other
+// contexts.
+func clockFromContext(ctx context.Context) workq.Clock {
+	if clock, ok := ctx.Value(clockKey{}).(workq.Clock); ok {
+		return clock
+	}
+
+	return workq.SystemClock
+}
+
+// JobID returns the ID of the job of a handler context, empty for other
+// contexts.
+func JobID(ctx context.Context) string {
+	info, _ := JobInfoFromContext(ctx)
+	return info.ID
+}
+
+// JobName returns the name of the job of a handler context, empty for other
+// contexts.
+func JobName(ctx context.Context) string {
+	info, _ := JobInfoFromContext(ctx)
+	return info.Name
+}
+
+type completeHooksKey struct{}
+
+// Funcs to run once the job of a handler context was acknowledged.
+type completeHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// AfterComplete registers fn to run once the job of handler context ctx was
+// acknowledged to the server, e.g. to clean up what a redelivery of the job
+// would still need. fn does not run when the handler fails or acknowledging
+// fails. Returns false without registering fn outside of Worker handlers.
+func AfterComplete(ctx context.Context, fn func()) bool {
+	hooks, ok := ctx.Value(completeHooksKey{}).(*completeHooks)
+	if !ok {
+		return false
+	}
+
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, fn)
+	hooks.mu.Unlock()
+
+	return true
+}
+
+// Run the registered funcs in registration order.
+func (h *completeHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestJobInfoFromContext(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	infos := make(chan JobInfo, 1)
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		info, ok := JobInfoFromContext(ctx)
+		if !ok || JobID(ctx) != id1 || JobName(ctx) != "j1" {
+			t.Errorf("Context mismatch, info=%+v", info)
+		}
+
+		infos <- info
+		return nil, nil
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}})
+
+	start := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+	s.waitDone(t, 1)
+	cancel()
+	<-errc
+
+	info := <-infos
+	if info.TTR != 1000 || info.Leased.Before(start) || !info.Deadline().Equal(info.Leased.Add(time.Second)) {
+		t.Fatalf("Info mismatch, info=%+v", info)
+	}
+
+	if _, ok := JobInfoFromContext(context.Background()); ok || JobID(context.Background()) != "" {
+		t.Fatalf("Expected no info")
+	}
+}
+
+func TestAfterComplete(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "ok"}, testJob{id2, "j1", "err"})
+	var mu sync.Mutex
+	completed := make(map[string]bool)
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		id := j.ID
+		AfterComplete(ctx, func() {
+			s.mu.Lock()
+			_, ok := s.completed[id]
+			s.mu.Unlock()
+			mu.Lock()
+			completed[id] = ok
+			mu.Unlock()
+		})
+		if string(j.Payload) == "err" {
+			return nil, errors.New("bad payload")
+		}
+
+		return nil, nil
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+	s.waitDone(t, 2)
+	cancel()
+	<-errc
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(completed) != 1 || !completed[id1] {
+		t.Fatalf("Expected hook run after complete only, completed=%v", completed)
+	}
+
+	if AfterComplete(context.Background(), func() {}) {
+		t.Fatalf("Expected no hook outside of handlers")
+	}
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// DedupeStore records processed job IDs for Dedupe, e.g. backed by an
+// in-memory LRU, Redis or a SQL table. Implementations must be safe for
+// concurrent use.
+type DedupeStore interface {
+	// Reserve marks id for ttl unless it is marked and has not yet expired,
+	// returning whether it marked id. Must be atomic, e.g. SET NX in Redis.
+	Reserve(ctx context.Context, id string, ttl time.Duration) (bool, error)
+
+	// Mark records id as processed for ttl.
+	Mark(ctx context.Context, id string, ttl time.Duration) error
+
+	// Release removes the mark of id.
+	Release(ctx context.Context, id string) error
+}
+
+// Dedupe returns middleware skipping jobs whose IDs were processed within
+// window, guarding non-idempotent handlers against jobs redelivered after
+// their TTR expired, e.g. when completing a job failed.
+//
+// A job's ID is reserved until its lease expires before running the handler,
+// so only one of concurrent deliveries runs it. A skipped job is completed
+// with an empty result. IDs are marked for window once the handler succeeds
+// and released when it fails, failed jobs run again when redelivered. An
+// error from Reserve fails the job without running the handler, errors from
+// Mark and Release are ignored.
+func Dedupe(store DedupeStore, window time.Duration) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+			ttl := window
+			if info, ok := JobInfoFromContext(ctx); ok {
+				ttl = info.Deadline().Sub(clockFromContext(ctx).Now())
+			}
+
+			reserved, err := store.Reserve(ctx, j.ID, ttl)
+			if err != nil {
+				return nil, err
+			}
+			if !reserved {
+				return nil, nil
+			}
+
+			result, err := h.Handle(ctx, j)
+			if err != nil {
+				store.Release(ctx, j.ID)
+				return nil, err
+			}
+
+			store.Mark(ctx, j.ID, window)
+			return result, nil
+		})
+	}
+}
+
+// MemoryDedupeStore is a DedupeStore holding up to a fixed number of IDs in
+// memory, evicting the least recently marked first.
+type MemoryDedupeStore struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // Of *dedupeEntry, most recently marked first.
+	ids   map[string]*list.Element
+}
+
+type dedupeEntry struct {
+	id      string
+	expires time.Time
+}
+
+// NewMemoryDedupeStore returns a MemoryDedupeStore holding up to size IDs.
+func NewMemoryDedupeStore(size int) *MemoryDedupeStore {
+	return &MemoryDedupeStore{
+		size:  size,
+		order: list.New(),
+		ids:   make(map[string]*list.Element),
+	}
+}
+
+// Seen returns whether id was marked and has not yet expired.
+func (s *MemoryDedupeStore) Seen(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen(ctx, id), nil
+}
+
+// Reserve implements DedupeStore.
+func (s *MemoryDedupeStore) Reserve(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen(ctx, id) {
+		return false, nil
+	}
+
+	s.mark(ctx, id, ttl)
+	return true, nil
+}
+
+// Mark implements DedupeStore.
+func (s *MemoryDedupeStore) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mark(ctx, id, ttl)
+	return nil
+}
+
+// Release implements DedupeStore.
+func (s *MemoryDedupeStore) Release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.ids[id]; ok {
+		s.order.Remove(e)
+		delete(s.ids, id)
+	}
+
+	return nil
+}
+
+// Whether id is marked and not expired, removing an expired mark. Must be
+// called with s.mu held.
+func (s *MemoryDedupeStore) seen(ctx context.Context, id string) bool {
+	e, ok := s.ids[id]
+	if !ok {
+		return false
+	}
+
+	if clockFromContext(ctx).Now().After(e.Value.(*dedupeEntry).expires) {
+		s.order.Remove(e)
+		delete(s.ids, id)
+		return false
+	}
+
+	return true
+}
+
+// Mark id for ttl, evicting the least recently marked IDs over size. Must be
+// called with s.mu held.
+func (s *MemoryDedupeStore) mark(ctx context.Context, id string, ttl time.Duration) {
+	expires := clockFromContext(ctx).Now().Add(ttl)
+	if e, ok := s.ids[id]; ok {
+		e.Value.(*dedupeEntry).expires = expires
+		s.order.MoveToFront(e)
+		return
+	}
+
+	s.ids[id] = s.order.PushFront(&dedupeEntry{id: id, expires: expires})
+	for s.order.Len() > s.size {
+		e := s.order.Back()
+		s.order.Remove(e)
+		delete(s.ids, e.Value.(*dedupeEntry).id)
+	}
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestDedupe(t *testing.T) {
+	var runs int
+	h := Chain(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		runs++
+		if string(j.Payload) == "err" {
+			return nil, errors.New("bad payload")
+		}
+
+		return []byte("done"), nil
+	}), Dedupe(NewMemoryDedupeStore(10), time.Minute))
+
+	ctx := context.Background()
+	ok := &workq.LeasedJob{ID: id1, Payload: []byte("ok")}
+	if result, err := h.Handle(ctx, ok); err != nil || string(result) != "done" {
+		t.Fatalf("Handle mismatch, result=%q, err=%v", result, err)
+	}
+	if result, err := h.Handle(ctx, ok); err != nil || result != nil || runs != 1 {
+		t.Fatalf("Expected duplicate skipped, runs=%d, result=%q, err=%v", runs, result, err)
+	}
+
+	failed := &workq.LeasedJob{ID: id2, Payload: []byte("err")}
+	h.Handle(ctx, failed)
+	h.Handle(ctx, failed)
+	if runs != 3 {
+		t.Fatalf("Expected failed job run again, runs=%d", runs)
+	}
+}
+
+func TestDedupeConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := Dedupe(NewMemoryDedupeStore(10), time.Minute)(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("done"), nil
+	}))
+
+	ctx := context.Background()
+	j := &workq.LeasedJob{ID: id1}
+	errc := make(chan error)
+	go func() {
+		_, err := h.Handle(ctx, j)
+		errc <- err
+	}()
+
+	<-started
+	if result, err := h.Handle(ctx, j); err != nil || result != nil {
+		t.Fatalf("Expected reserved job skipped, result=%q, err=%v", result, err)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("Handle error, err=%s", err)
+	}
+}
+
+type errDedupeStore struct{}
+
+func (errDedupeStore) Reserve(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func (errDedupeStore) Mark(ctx context.Context, id string, ttl time.Duration) error {
+	return nil
+}
+
+func (errDedupeStore) Release(ctx context.Context, id string) error {
+	return nil
+}
+
+func TestDedupeStoreError(t *testing.T) {
+	h := Dedupe(errDedupeStore{}, time.Minute)(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		t.Fatalf("Expected handler not run")
+		return nil, nil
+	}))
+
+	_, err := h.Handle(context.Background(), &workq.LeasedJob{ID: id1})
+	if err == nil || err.Error() != "store unavailable" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestMemoryDedupeStore(t *testing.T) {
+	clock := workqtest.NewFakeClock(time.Now())
+	ctx := context.WithValue(context.Background(), clockKey{}, workq.Clock(clock))
+	s := NewMemoryDedupeStore(2)
+	s.Mark(ctx, id1, time.Millisecond)
+	clock.Advance(5 * time.Millisecond)
+	if seen, err := s.Seen(ctx, id1); err != nil || seen {
+		t.Fatalf("Expected expired ID, seen=%t, err=%v", seen, err)
+	}
+
+	s.Mark(ctx, id1, time.Minute)
+	s.Mark(ctx, id2, time.Minute)
+	s.Mark(ctx, id1, time.Minute)
+	s.Mark(ctx, id3, time.Minute)
+	for id, exp := range map[string]bool{id1: true, id2: false, id3: true} {
+		if seen, err := s.Seen(ctx, id); err != nil || seen != exp {
+			t.Fatalf("Seen mismatch, id=%s, seen=%t, err=%v", id, seen, err)
+		}
+	}
+
+	if ok, err := s.Reserve(ctx, id1, time.Minute); err != nil || ok {
+		t.Fatalf("Expected marked ID not reserved, ok=%t, err=%v", ok, err)
+	}
+	s.Release(ctx, id1)
+	if ok, err := s.Reserve(ctx, id1, time.Minute); err != nil || !ok {
+		t.Fatalf("Expected released ID reserved, ok=%t, err=%v", ok, err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+				order = append(order, name)
+				return h.Handle(ctx, j)
+			})
+		}
+	}
+
+	h := Chain(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		order = append(order, "handler")
+		return nil, nil
+	}), mw("a"), mw("b"))
+	h.Handle(context.Background(), &workq.LeasedJob{})
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "handler" {
+		t.Fatalf("Order mismatch, order=%v", order)
+	}
+}
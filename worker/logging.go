@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Logging returns middleware logging a line per job handled through l, e.g.
+//
+//	workq: job id=<id> name=email.send duration=1.2s outcome=failed error="smtp: timeout"
+//
+// Outcomes are "completed", "failed" and "panic". The attempt number is not
+// logged as leases do not carry it.
+func Logging(l workq.Logger) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) (result []byte, err error) {
+			clock := clockFromContext(ctx)
+			start := clock.Now()
+			defer func() {
+				d := clock.Now().Sub(start)
+				if p := recover(); p != nil {
+					l.Printf("workq: job id=%s name=%s duration=%s outcome=panic error=%q", j.ID, j.Name, d, fmt.Sprint(p))
+					panic(p)
+				}
+				if err != nil {
+					l.Printf("workq: job id=%s name=%s duration=%s outcome=failed error=%q", j.ID, j.Name, d, err.Error())
+					return
+				}
+
+				l.Printf("workq: job id=%s name=%s duration=%s outcome=completed", j.ID, j.Name, d)
+			}()
+
+			return h.Handle(ctx, j)
+		})
+	}
+}
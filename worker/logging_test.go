@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	h := Logging(log.New(&buf, "", 0))(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		switch string(j.Payload) {
+		case "err":
+			return nil, errors.New("bad payload")
+		case "panic":
+			panic(`boom "now"`)
+		}
+
+		return nil, nil
+	}))
+
+	ctx := context.Background()
+	h.Handle(ctx, &workq.LeasedJob{ID: id1, Name: "j1", Payload: []byte("ok")})
+	h.Handle(ctx, &workq.LeasedJob{ID: id2, Name: "j1", Payload: []byte("err")})
+	func() {
+		defer func() {
+			if p := recover(); p != `boom "now"` {
+				t.Fatalf("Expected panic passed on, p=%v", p)
+			}
+		}()
+		h.Handle(ctx, &workq.LeasedJob{ID: id3, Name: "j1", Payload: []byte("panic")})
+	}()
+
+	exp := regexp.MustCompile(`^workq: job id=` + id1 + ` name=j1 duration=\S+ outcome=completed
+workq: job id=` + id2 + ` name=j1 duration=\S+ outcome=failed error="bad payload"
+workq: job id=` + id3 + ` name=j1 duration=\S+ outcome=panic error="boom \\"now\\""
+$`)
+	if !exp.MatchString(buf.String()) {
+		t.Fatalf("Log mismatch, act=%q", buf.String())
+	}
+}
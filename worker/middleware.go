@@ -0,0 +1,13 @@
+package worker
+
+// Middleware wraps a Handler, e.g. to skip, time or retry jobs.
+type Middleware func(h Handler) Handler
+
+// Chain wraps h in middleware, the first being outermost.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
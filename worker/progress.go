@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/iamduo/go-workq"
+)
+
+// ProgressSink receives progress reported by handlers through Progress,
+// e.g. to log it, export it as a metric or store it keyed by job ID for
+// operators to look up. Must be safe for concurrent use.
+type ProgressSink interface {
+	Progress(info JobInfo, pct float64, note string)
+}
+
+// ProgressSinkFunc adapts a function to a ProgressSink.
+type ProgressSinkFunc func(info JobInfo, pct float64, note string)
+
+// Progress calls f(info, pct, note).
+func (f ProgressSinkFunc) Progress(info JobInfo, pct float64, note string) {
+	f(info, pct, note)
+}
+
+// LogProgress returns a ProgressSink logging progress through l.
+func LogProgress(l workq.Logger) ProgressSink {
+	return ProgressSinkFunc(func(info JobInfo, pct float64, note string) {
+		l.Printf("workq: job id=%s name=%s progress=%.1f%% note=%q", info.ID, info.Name, pct, note)
+	})
+}
+
+type progressSinkKey struct{}
+
+// Progress reports progress of the job of a handler context as pct percent
+// done with a note, e.g. Progress(ctx, 40, "resized 4 of 10 images"), to
+// Config.Progress. A no-op without a sink or outside of handlers.
+func Progress(ctx context.Context, pct float64, note string) {
+	sink, ok := ctx.Value(progressSinkKey{}).(ProgressSink)
+	if !ok {
+		return
+	}
+	info, ok := JobInfoFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	sink.Progress(info, pct, note)
+}
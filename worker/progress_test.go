@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestProgress(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		Progress(ctx, 50, "half way")
+		Progress(ctx, 100, "done")
+		return nil, nil
+	})
+
+	var mu sync.Mutex
+	var act []string
+	sink := ProgressSinkFunc(func(info JobInfo, pct float64, note string) {
+		mu.Lock()
+		defer mu.Unlock()
+		act = append(act, info.ID+" "+note)
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}, Progress: sink})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+	s.waitDone(t, 1)
+	cancel()
+	<-errc
+
+	mu.Lock()
+	defer mu.Unlock()
+	exp := []string{id1 + " half way", id1 + " done"}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Progress mismatch, act=%q", act)
+	}
+
+	// No-op outside of handlers.
+	Progress(context.Background(), 1, "")
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// RateLimit returns middleware limiting how many jobs of each name listed in
+// perSecond start per second across all slots sharing the middleware, e.g.
+// to never call a partner API more than 10 times a second from a process.
+// Names not listed are not limited.
+//
+// Jobs wait for their turn after being leased, so waiting counts against
+// their TTR. Jobs whose context is done while waiting return its error.
+func RateLimit(perSecond map[string]float64) Middleware {
+	l := &rateLimiter{
+		intervals: make(map[string]time.Duration),
+		next:      make(map[string]time.Time),
+	}
+	for name, n := range perSecond {
+		if n > 0 {
+			l.intervals[name] = time.Duration(float64(time.Second) / n)
+		}
+	}
+
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+			if err := l.wait(ctx, j.Name); err != nil {
+				return nil, err
+			}
+
+			return h.Handle(ctx, j)
+		})
+	}
+}
+
+// Spaces the start of jobs of each name evenly.
+type rateLimiter struct {
+	intervals map[string]time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time // Earliest start of the next job by name.
+}
+
+func (l *rateLimiter) wait(ctx context.Context, name string) error {
+	interval, ok := l.intervals[name]
+	if !ok {
+		return nil
+	}
+
+	clock := clockFromContext(ctx)
+	l.mu.Lock()
+	now := clock.Now()
+	start := l.next[name]
+	if start.Before(now) {
+		start = now
+	}
+	l.next[name] = start.Add(interval)
+	l.mu.Unlock()
+
+	d := start.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(map[string]float64{"j1": 100})(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		return nil, nil
+	}))
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		h.Handle(ctx, &workq.LeasedJob{Name: "j2"})
+	}
+	if d := time.Since(start); d > 10*time.Millisecond {
+		t.Fatalf("Expected unlisted name not limited, took=%s", d)
+	}
+
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		h.Handle(ctx, &workq.LeasedJob{Name: "j1"})
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Fatalf("Expected jobs spaced by 10ms, took=%s", d)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	h := RateLimit(map[string]float64{"j1": 0.001})(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		return nil, nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := h.Handle(ctx, &workq.LeasedJob{Name: "j1"}); err != nil {
+		t.Fatalf("Handle mismatch, err=%s", err)
+	}
+	if _, err := h.Handle(ctx, &workq.LeasedJob{Name: "j1"}); err != context.DeadlineExceeded {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// RetryConfig configures Retry.
+type RetryConfig struct {
+	Attempts int // Handler runs including the first, defaults to 3.
+
+	// Bounds of the jittered exponential backoff between runs, default to
+	// 100ms and 5s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Decides whether an error is retried, defaults to any error not marked
+	// by Permanent.
+	Retryable func(err error) bool
+}
+
+// Retry returns middleware running handlers again on transient errors
+// before the job is failed, for flaky downstream calls where spending a
+// server side attempt and waiting for redelivery is wasteful.
+//
+// Retries stop once the handler context is done. Keep attempts and backoff
+// well within the job TTR, the job is leased again otherwise.
+func Retry(config RetryConfig) Middleware {
+	if config.Attempts <= 0 {
+		config.Attempts = 3
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 100 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 5 * time.Second
+	}
+	if config.Retryable == nil {
+		config.Retryable = func(err error) bool {
+			return !IsPermanent(err)
+		}
+	}
+
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+			for n := 0; ; n++ {
+				result, err := h.Handle(ctx, j)
+				if err == nil || n+1 >= config.Attempts || !config.Retryable(err) {
+					return result, err
+				}
+
+				timer := clockFromContext(ctx).NewTimer(workq.JitteredBackoff(n, config.MinBackoff, config.MaxBackoff))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return result, err
+				case <-timer.C():
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestRetry(t *testing.T) {
+	var runs int
+	h := Retry(RetryConfig{MinBackoff: time.Millisecond})(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		runs++
+		switch string(j.Payload) {
+		case "flaky":
+			if runs < 3 {
+				return nil, errors.New("unavailable")
+			}
+		case "down":
+			return nil, errors.New("unavailable")
+		case "invalid":
+			return nil, Permanent(errors.New("invalid payload"))
+		}
+
+		return []byte("done"), nil
+	}))
+
+	ctx := context.Background()
+	tests := []struct {
+		payload string
+		runs    int
+		err     string
+	}{
+		{"flaky", 3, ""},
+		{"down", 3, "unavailable"},
+		{"invalid", 1, "invalid payload"},
+	}
+
+	for _, tt := range tests {
+		runs = 0
+		_, err := h.Handle(ctx, &workq.LeasedJob{Payload: []byte(tt.payload)})
+		if runs != tt.runs || (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Fatalf("Retry mismatch, payload=%s, runs=%d, err=%v", tt.payload, runs, err)
+		}
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	var runs int
+	h := Retry(RetryConfig{Attempts: 5, MinBackoff: time.Hour})(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		runs++
+		return nil, errors.New("unavailable")
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := h.Handle(ctx, &workq.LeasedJob{}); err == nil || runs != 1 {
+		t.Fatalf("Retry mismatch, runs=%d, err=%v", runs, err)
+	}
+}
+
+func TestRetryBackoffClock(t *testing.T) {
+	var runs int32
+	h := Retry(RetryConfig{MinBackoff: time.Hour, MaxBackoff: time.Hour})(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		atomic.AddInt32(&runs, 1)
+		return nil, errors.New("unavailable")
+	}))
+
+	clock := workqtest.NewFakeClock(time.Now())
+	ctx := context.WithValue(context.Background(), clockKey{}, workq.Clock(clock))
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.Handle(ctx, &workq.LeasedJob{})
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}
+	if err := <-done; err == nil || atomic.LoadInt32(&runs) != 3 {
+		t.Fatalf("Retry mismatch, runs=%d, err=%v", runs, err)
+	}
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// RunUntilSignal runs w until SIGINT or SIGTERM is received, then stops
+// leasing and drains in-flight jobs as described by Worker.Run.
+//
+// Returns ErrDrainTimeout when the drain did not complete within the grace
+// period, so exiting non-zero on error follows the usual process manager
+// contract:
+//
+//	if err := worker.RunUntilSignal(w); err != nil {
+//		log.Fatal(err)
+//	}
+func RunUntilSignal(w *Worker) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	return runUntil(w, sigs)
+}
+
+func runUntil(w *Worker, sigs <-chan os.Signal) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return w.Run(ctx)
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestRunUntilSignal(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("b"), nil
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}})
+
+	sigs := make(chan os.Signal, 1)
+	errc := make(chan error)
+	go func() {
+		errc <- runUntil(w, sigs)
+	}()
+
+	<-started
+	sigs <- syscall.SIGTERM
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error, err=%s", err)
+	}
+
+	if s.completed[id1] != "b" {
+		t.Fatalf("Result mismatch, completed=%v", s.completed)
+	}
+}
@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+var (
+	// ErrStarted is returned by Supervisor.Start when already started.
+	ErrStarted = errors.New("Supervisor already started")
+
+	// Group error of a Runner returning before the supervisor was stopped.
+	errReturned = errors.New("Returned before stop")
+)
+
+// Runner runs until ctx is cancelled, implemented by *Worker.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// RestartPolicy decides whether a Supervisor restarts a group whose Runner
+// returned or panicked before the supervisor was stopped.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts a group after a panic or error, the default.
+	RestartOnFailure RestartPolicy = iota
+
+	// RestartAlways also restarts a group returning without error.
+	RestartAlways
+
+	// RestartNever stops the supervisor on any return of the group.
+	RestartNever
+)
+
+// Group is a Runner managed by a Supervisor, e.g. a Worker with its own
+// job names, concurrency and pool.
+type Group struct {
+	Name    string // Identifies the group in logs and errors.
+	Runner  Runner
+	Restart RestartPolicy
+
+	// Max consecutive restarts before the supervisor is stopped with the
+	// last error, 0 for no limit. The count is reset once the group ran for
+	// a minute.
+	MaxRestarts int
+
+	// Delay before restarting, defaults to 1s.
+	RestartDelay time.Duration
+}
+
+// SupervisorConfig configures a Supervisor.
+type SupervisorConfig struct {
+	Groups []Group
+	Logger workq.Logger // Logs restarts, nil to discard.
+	Clock  workq.Clock  // Clock of restart delays, defaults to workq.SystemClock.
+}
+
+// How long a group must run for its restarts to no longer count as
+// consecutive.
+var restartReset = time.Minute
+
+// Supervisor runs groups of workers together, restarting crashed groups by
+// their RestartPolicy. A group failing for good stops all others, similar
+// to an errgroup.
+type Supervisor struct {
+	config SupervisorConfig
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error // First group error.
+}
+
+// NewSupervisor returns a Supervisor for config.Groups.
+func NewSupervisor(config SupervisorConfig) *Supervisor {
+	for i := range config.Groups {
+		if config.Groups[i].RestartDelay <= 0 {
+			config.Groups[i].RestartDelay = time.Second
+		}
+	}
+	if config.Clock == nil {
+		config.Clock = workq.SystemClock
+	}
+
+	return &Supervisor{config: config}
+}
+
+// Start runs all groups in the background until ctx is cancelled, Stop is
+// called or a group fails for good.
+// Returns ErrStarted if already started.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return ErrStarted
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, g := range s.config.Groups {
+		wg.Add(1)
+		go func(g Group) {
+			defer wg.Done()
+			if err := s.supervise(ctx, g); err != nil {
+				s.fail(fmt.Errorf("group %s: %s", g.Name, err))
+			}
+		}(g)
+	}
+
+	go func() {
+		wg.Wait()
+		s.cancel()
+		close(s.done)
+	}()
+
+	return nil
+}
+
+// Stop cancels all groups and waits for them to return.
+// Returns the first group error, as Wait.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	return s.Wait()
+}
+
+// Wait waits for all groups to return, returning the first group error
+// including errors returned while stopping, e.g. ErrDrainTimeout.
+// Returns immediately if not started.
+func (s *Supervisor) Wait() error {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	<-done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Run starts the supervisor and waits for it, see Start and Wait.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+
+	return s.Wait()
+}
+
+// Run a group, restarting it by policy until ctx is cancelled.
+func (s *Supervisor) supervise(ctx context.Context, g Group) error {
+	var restarts int
+	for {
+		start := s.config.Clock.Now()
+		err := run(ctx, g.Runner)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		if s.config.Clock.Now().Sub(start) >= restartReset {
+			restarts = 0
+		}
+		returned := err == nil
+		if returned {
+			err = errReturned
+		}
+		if g.Restart == RestartNever || (returned && g.Restart != RestartAlways) {
+			return err
+		}
+		if g.MaxRestarts > 0 && restarts >= g.MaxRestarts {
+			return fmt.Errorf("%s, restarted %d times", err, restarts)
+		}
+
+		restarts++
+		s.logf("workq: supervisor restarting group %s: %s", g.Name, err)
+		timer := s.config.Clock.NewTimer(g.RestartDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// Run r, converting a panic into an error.
+func run(ctx context.Context, r Runner) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return r.Run(ctx)
+}
+
+// Record the first error and stop all groups.
+func (s *Supervisor) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+
+	s.cancel()
+}
+
+func (s *Supervisor) logf(format string, v ...interface{}) {
+	if s.config.Logger != nil {
+		s.config.Logger.Printf(format, v...)
+	}
+}
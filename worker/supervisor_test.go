@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+type runnerFunc func(ctx context.Context) error
+
+func (f runnerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Runner blocking until cancelled.
+var blockingRunner = runnerFunc(func(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+})
+
+func TestSupervisorRestartsCrashedGroup(t *testing.T) {
+	var runs int32
+	logger := &testLogger{}
+	s := NewSupervisor(SupervisorConfig{
+		Groups: []Group{
+			{
+				Name: "a",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					if atomic.AddInt32(&runs, 1) == 1 {
+						panic("boom")
+					}
+
+					<-ctx.Done()
+					return nil
+				}),
+				RestartDelay: time.Millisecond,
+			},
+			{Name: "b", Runner: blockingRunner},
+		},
+		Logger: logger,
+	})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start mismatch, err=%s", err)
+	}
+	if err := s.Start(context.Background()); err != ErrStarted {
+		t.Fatalf("Start twice mismatch, err=%v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&runs) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for restart")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop mismatch, err=%s", err)
+	}
+	if len(logger.lines) != 1 {
+		t.Fatalf("Log mismatch, lines=%v", logger.lines)
+	}
+}
+
+func TestSupervisorStopsOnFailure(t *testing.T) {
+	var stopped int32
+	s := NewSupervisor(SupervisorConfig{
+		Groups: []Group{
+			{
+				Name: "a",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					return errors.New("boom")
+				}),
+				Restart: RestartNever,
+			},
+			{
+				Name: "b",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					<-ctx.Done()
+					atomic.StoreInt32(&stopped, 1)
+					return nil
+				}),
+			},
+		},
+	})
+
+	err := s.Run(context.Background())
+	if err == nil || err.Error() != "group a: boom" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if atomic.LoadInt32(&stopped) != 1 {
+		t.Fatalf("Expected other groups stopped")
+	}
+}
+
+func TestSupervisorMaxRestarts(t *testing.T) {
+	var runs int32
+	s := NewSupervisor(SupervisorConfig{
+		Groups: []Group{
+			{
+				Name: "a",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					atomic.AddInt32(&runs, 1)
+					return nil
+				}),
+				Restart:      RestartAlways,
+				MaxRestarts:  2,
+				RestartDelay: time.Millisecond,
+			},
+		},
+	})
+
+	err := s.Run(context.Background())
+	if err == nil || err.Error() != "group a: Returned before stop, restarted 2 times" || runs != 3 {
+		t.Fatalf("Error mismatch, runs=%d, err=%v", runs, err)
+	}
+}
+
+func TestSupervisorDrainError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewSupervisor(SupervisorConfig{
+		Groups: []Group{
+			{
+				Name: "a",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					<-ctx.Done()
+					return ErrDrainTimeout
+				}),
+			},
+		},
+	})
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Start mismatch, err=%s", err)
+	}
+
+	cancel()
+	if err := s.Wait(); err == nil || err.Error() != "group a: Drain timed out" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestSupervisorRestartDelayClock(t *testing.T) {
+	runs := make(chan struct{}, 10)
+	clock := workqtest.NewFakeClock(time.Now())
+	s := NewSupervisor(SupervisorConfig{
+		Groups: []Group{
+			{
+				Name: "a",
+				Runner: runnerFunc(func(ctx context.Context) error {
+					runs <- struct{}{}
+					return errors.New("boom")
+				}),
+				RestartDelay: time.Hour,
+			},
+		},
+		Clock: clock,
+	})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start mismatch, err=%s", err)
+	}
+	defer s.Stop()
+
+	<-runs
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour - time.Second)
+	select {
+	case <-runs:
+		t.Fatalf("Restarted before delay")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	<-runs
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// TimeoutError is returned by handlers wrapped by Timeout running over their
+// limit. Jobs are failed with a JSON payload, e.g.
+// {"error":"timeout","timeout_ms":5000}.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return "Handler timed out after " + e.Timeout.String()
+}
+
+// FailPayload implements FailPayloader.
+func (e *TimeoutError) FailPayload() []byte {
+	b, _ := json.Marshal(struct {
+		Error     string `json:"error"`
+		TimeoutMs int64  `json:"timeout_ms"`
+	}{"timeout", int64(e.Timeout / time.Millisecond)})
+	return b
+}
+
+// Timeout returns middleware limiting handlers to d regardless of the job
+// TTR, cancelling their context once over and returning a *TimeoutError.
+//
+// Handlers are run in a goroutine, so a handler ignoring its context no
+// longer holds a worker slot once timed out, but keeps running in the
+// background until it returns.
+func Timeout(d time.Duration) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			type reply struct {
+				result []byte
+				err    error
+			}
+			done := make(chan reply, 1)
+			go func() {
+				// Recovered here as panics escape the worker's recovery
+				// in another goroutine.
+				defer func() {
+					if p := recover(); p != nil {
+						done <- reply{err: fmt.Errorf("panic: %v", p)}
+					}
+				}()
+
+				result, err := h.Handle(ctx, j)
+				done <- reply{result, err}
+			}()
+
+			select {
+			case r := <-done:
+				if r.err != nil && ctx.Err() == context.DeadlineExceeded {
+					return nil, &TimeoutError{Timeout: d}
+				}
+
+				return r.result, r.err
+			case <-ctx.Done():
+			}
+
+			// Cancelled from outside, e.g. the drain grace period expired.
+			if ctx.Err() != context.DeadlineExceeded {
+				return nil, ctx.Err()
+			}
+
+			return nil, &TimeoutError{Timeout: d}
+		})
+	}
+}
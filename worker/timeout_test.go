@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	h := Timeout(10 * time.Millisecond)(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		switch string(j.Payload) {
+		case "stuck":
+			<-release
+		case "ctx":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case "panic":
+			panic("boom")
+		case "err":
+			return nil, errors.New("bad payload")
+		}
+
+		return []byte("done"), nil
+	}))
+
+	ctx := context.Background()
+	for _, payload := range []string{"stuck", "ctx"} {
+		_, err := h.Handle(ctx, &workq.LeasedJob{Payload: []byte(payload)})
+		terr, ok := err.(*TimeoutError)
+		if !ok || terr.Timeout != 10*time.Millisecond {
+			t.Fatalf("Error mismatch, payload=%s, err=%v", payload, err)
+		}
+	}
+
+	if result, err := h.Handle(ctx, &workq.LeasedJob{Payload: []byte("ok")}); err != nil || string(result) != "done" {
+		t.Fatalf("Handle mismatch, result=%q, err=%v", result, err)
+	}
+	if _, err := h.Handle(ctx, &workq.LeasedJob{Payload: []byte("err")}); err == nil || err.Error() != "bad payload" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if _, err := h.Handle(ctx, &workq.LeasedJob{Payload: []byte("panic")}); err == nil || err.Error() != "panic: boom" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestTimeoutFailPayload(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	h := Timeout(time.Millisecond)(HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+	s.waitDone(t, 1)
+	cancel()
+	<-errc
+
+	if exp := `{"error":"timeout","timeout_ms":1}`; s.failed[id1] != exp {
+		t.Fatalf("Fail payload mismatch, failed=%v", s.failed)
+	}
+}
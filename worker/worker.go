@@ -0,0 +1,435 @@
+// Package worker runs handlers for jobs leased from a Workq server.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+var (
+	// ErrDrainTimeout is returned by Run when in-flight jobs did not finish
+	// within the grace period.
+	ErrDrainTimeout = errors.New("Drain timed out")
+)
+
+// How long a slot waits before leasing again after a failed command.
+var errorPause = time.Second
+
+// Handler processes a leased job, returning the result to complete it with,
+// or an error to fail it with the error text as result, or the FailPayload
+// of errors implementing FailPayloader.
+type Handler interface {
+	Handle(ctx context.Context, j *workq.LeasedJob) ([]byte, error)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, j *workq.LeasedJob) ([]byte, error)
+
+// Handle calls f(ctx, j).
+func (f HandlerFunc) Handle(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+	return f(ctx, j)
+}
+
+// Permanent marks err as a permanent job failure, e.g. an invalid payload
+// no retry can fix, reported to the Config.Reporter. The job is failed with
+// the text of err either way.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// IsPermanent returns whether err was marked by Permanent.
+func IsPermanent(err error) bool {
+	_, ok := err.(*permanentError)
+	return ok
+}
+
+// Delivery decides when a Worker acknowledges a leased job.
+type Delivery int
+
+const (
+	// AtLeastOnce completes or fails a job after its handler returns, the
+	// default. A job is leased again if the worker dies mid-handler.
+	AtLeastOnce Delivery = iota
+
+	// AtMostOnce deletes a job before running its handler, for workloads
+	// where a duplicate run is worse than an occasional lost job, e.g.
+	// sending SMS. Handler results and errors are discarded.
+	AtMostOnce
+
+	// AtMostOnceComplete is AtMostOnce but completes the job with an empty
+	// result instead of deleting it, unblocking foreground clients.
+	AtMostOnceComplete
+)
+
+// FailPayloader is implemented by errors failing jobs with a structured
+// result rather than their text, e.g. *TimeoutError.
+type FailPayloader interface {
+	FailPayload() []byte
+}
+
+// Result to fail a job with for err.
+func failPayload(err error) []byte {
+	if p, ok := err.(FailPayloader); ok {
+		return p.FailPayload()
+	}
+
+	return []byte(err.Error())
+}
+
+// Pool lends connections to worker slots, implemented by *workq.Pool.
+type Pool interface {
+	Get() (*workq.Client, error)
+	Put(c *workq.Client)
+}
+
+// Config configures a Worker.
+type Config struct {
+	Names       []string // Job names to lease, in order of preference.
+	Concurrency int      // Jobs processed concurrently, defaults to 1.
+
+	// Milliseconds a single lease command waits for a job, defaults to 1000.
+	// Bounds how long Run takes to stop leasing once cancelled.
+	LeaseTimeout int
+
+	// Max time Run waits for in-flight jobs once cancelled before cancelling
+	// their contexts, 0 waits indefinitely.
+	GracePeriod time.Duration
+
+	Logger workq.Logger // Logs command failures, nil to discard.
+
+	// Reports handler panics and permanent job failures, nil to discard.
+	Reporter workq.ErrorReporter
+
+	Delivery Delivery // Defaults to AtLeastOnce.
+
+	// Tracks job outcomes per job name, nil to disable.
+	Budget *ErrorBudget
+
+	// Stop leasing job names over budget until their failures age out of
+	// the budget window. Requires Budget.
+	PauseOverBudget bool
+
+	// Rotate the order of Names across consecutive leases, so that names
+	// listed first do not starve later ones. The server serves the first
+	// listed name with jobs ready.
+	RotateNames bool
+
+	// Relative weights of Names, e.g. 5 for "critical" and 1 for "bulk"
+	// lists "critical" first on 5 of 6 leases. Names without a weight
+	// weigh 1, names weighing 0 are never listed first. The name listed
+	// first is picked by smooth weighted round-robin, the others follow in
+	// configured order. Takes precedence over RotateNames.
+	Weights map[string]int
+
+	// Receives progress reported by handlers through Progress, nil to
+	// discard.
+	Progress ProgressSink
+
+	// Clock of the grace period, pauses after errors and lease times,
+	// passed to handler contexts for the backoffs of Retry and RateLimit.
+	// Defaults to workq.SystemClock.
+	Clock workq.Clock
+}
+
+// Worker leases jobs of configured names over connections borrowed from a
+// Pool, one per concurrent slot, completing or failing each by the result
+// of its Handler.
+type Worker struct {
+	pool    Pool
+	handler Handler
+	config  Config
+
+	leases uint64 // Leases attempted, rotating names.
+
+	weightMu sync.Mutex
+	current  map[string]int // Current weights of smooth weighted round-robin.
+}
+
+// New returns a Worker running handler for jobs leased through pool.
+func New(pool Pool, handler Handler, config Config) *Worker {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.LeaseTimeout <= 0 {
+		config.LeaseTimeout = 1000
+	}
+	if config.Clock == nil {
+		config.Clock = workq.SystemClock
+	}
+
+	return &Worker{pool: pool, handler: handler, config: config}
+}
+
+// Run processes jobs until ctx is cancelled, then stops leasing and waits
+// for in-flight jobs to finish.
+//
+// Handler contexts are independent of ctx and only cancelled once the grace
+// period expires, in which case ErrDrainTimeout is returned. Jobs whose
+// handler fails after that are neither completed nor failed, leaving them to
+// be leased again once their TTR expires.
+func (w *Worker) Run(ctx context.Context) error {
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.slot(ctx, jobCtx)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+	if w.config.GracePeriod <= 0 {
+		<-done
+		return nil
+	}
+
+	timer := w.config.Clock.NewTimer(w.config.GracePeriod)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C():
+		cancelJobs()
+		<-done
+		return ErrDrainTimeout
+	}
+}
+
+// Lease and process jobs one at a time until ctx is cancelled.
+// The connection is returned to the pool and replaced after any error.
+func (w *Worker) slot(ctx context.Context, jobCtx context.Context) {
+	var c *workq.Client
+	defer func() {
+		if c != nil {
+			w.pool.Put(c)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		if c == nil {
+			var err error
+			if c, err = w.pool.Get(); err != nil {
+				w.logf("workq: worker connection failed: %s", err)
+				w.pause(ctx)
+				continue
+			}
+		}
+
+		names := w.leasable()
+		if len(names) == 0 {
+			w.pause(ctx)
+			continue
+		}
+
+		if err := w.process(jobCtx, c, names); err != nil {
+			w.logf("workq: worker %s", err)
+			w.pool.Put(c)
+			c = nil
+			w.pause(ctx)
+		}
+	}
+}
+
+// Lease a single job and complete or fail it by its handler result.
+// A lease timing out is not an error.
+func (w *Worker) process(ctx context.Context, c *workq.Client, names []string) error {
+	j, err := c.Lease(names, w.config.LeaseTimeout)
+	if err != nil {
+		if workq.IsTimedOut(err) {
+			return nil
+		}
+
+		return fmt.Errorf("lease failed: %s", err)
+	}
+
+	ctx = withJobInfo(ctx, j, w.config.Clock.Now())
+	ctx = context.WithValue(ctx, clockKey{}, w.config.Clock)
+	if w.config.Progress != nil {
+		ctx = context.WithValue(ctx, progressSinkKey{}, w.config.Progress)
+	}
+	hooks := &completeHooks{}
+	ctx = context.WithValue(ctx, completeHooksKey{}, hooks)
+	if w.config.Delivery != AtLeastOnce {
+		return w.processOnce(ctx, c, j, hooks)
+	}
+
+	result, err := w.handle(ctx, j)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	if w.config.Budget != nil {
+		w.config.Budget.record(j.Name, err != nil)
+	}
+
+	if err != nil {
+		if IsPermanent(err) {
+			w.report(err, j, "permanent")
+		}
+
+		if ferr := c.Fail(j.ID, failPayload(err)); ferr != nil {
+			return fmt.Errorf("fail id=%s failed: %s", j.ID, ferr)
+		}
+
+		return nil
+	}
+
+	if err := c.Complete(j.ID, result); err != nil {
+		return fmt.Errorf("complete id=%s failed: %s", j.ID, err)
+	}
+	hooks.run()
+
+	return nil
+}
+
+// Acknowledge a job before running its handler, leaving it to be leased
+// again on failure without running the handler.
+func (w *Worker) processOnce(ctx context.Context, c *workq.Client, j *workq.LeasedJob, hooks *completeHooks) error {
+	if w.config.Delivery == AtMostOnceComplete {
+		if err := c.Complete(j.ID, nil); err != nil {
+			return fmt.Errorf("complete id=%s failed: %s", j.ID, err)
+		}
+	} else if err := c.Delete(j.ID); err != nil {
+		return fmt.Errorf("delete id=%s failed: %s", j.ID, err)
+	}
+
+	_, err := w.handle(ctx, j)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	if w.config.Budget != nil {
+		w.config.Budget.record(j.Name, err != nil)
+	}
+
+	if err != nil {
+		if IsPermanent(err) {
+			w.report(err, j, "permanent")
+		}
+
+		w.logf("workq: worker job id=%s failed: %s", j.ID, err)
+
+		return nil
+	}
+	hooks.run()
+
+	return nil
+}
+
+// Job names to lease, leaving out names over budget if paused, in rotated
+// order if configured.
+func (w *Worker) leasable() []string {
+	names := w.config.Names
+	if w.config.PauseOverBudget && w.config.Budget != nil {
+		names = nil
+		for _, name := range w.config.Names {
+			if !w.config.Budget.Exceeded(name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(w.config.Weights) > 0 && len(names) > 1 {
+		return w.weighted(names)
+	}
+	if w.config.RotateNames && len(names) > 1 {
+		n := int((atomic.AddUint64(&w.leases, 1) - 1) % uint64(len(names)))
+		rotated := make([]string, 0, len(names))
+		rotated = append(rotated, names[n:]...)
+		names = append(rotated, names[:n]...)
+	}
+
+	return names
+}
+
+// Move the name picked by smooth weighted round-robin to the front of names.
+func (w *Worker) weighted(names []string) []string {
+	w.weightMu.Lock()
+	if w.current == nil {
+		w.current = make(map[string]int)
+	}
+
+	var total int
+	pick := 0
+	for i, name := range names {
+		weight, ok := w.config.Weights[name]
+		if !ok {
+			weight = 1
+		}
+
+		total += weight
+		w.current[name] += weight
+		if w.current[name] > w.current[names[pick]] {
+			pick = i
+		}
+	}
+	w.current[names[pick]] -= total
+	w.weightMu.Unlock()
+
+	ordered := make([]string, 0, len(names))
+	ordered = append(ordered, names[pick])
+	ordered = append(ordered, names[:pick]...)
+	return append(ordered, names[pick+1:]...)
+}
+
+// Run the handler, converting a panic into an error.
+func (w *Worker) handle(ctx context.Context, j *workq.LeasedJob) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			w.report(err, j, "panic")
+		}
+	}()
+
+	return w.handler.Handle(ctx, j)
+}
+
+func (w *Worker) pause(ctx context.Context) {
+	timer := w.config.Clock.NewTimer(errorPause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C():
+	}
+}
+
+func (w *Worker) report(err error, j *workq.LeasedJob, kind string) {
+	if w.config.Reporter == nil {
+		return
+	}
+
+	w.config.Reporter.Report(err, map[string]string{
+		"job_id":   j.ID,
+		"job_name": j.Name,
+		"failure":  kind,
+	})
+}
+
+func (w *Worker) logf(format string, v ...interface{}) {
+	if w.config.Logger != nil {
+		w.config.Logger.Printf(format, v...)
+	}
+}
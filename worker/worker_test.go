@@ -0,0 +1,416 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+// In-memory queue served over workqtest pipe clients.
+type testServer struct {
+	mu        sync.Mutex
+	ready     []testJob
+	completed map[string]string
+	failed    map[string]string
+	deleted   map[string]bool
+}
+
+type testJob struct {
+	id      string
+	name    string
+	payload string
+}
+
+func newTestServer(jobs ...testJob) *testServer {
+	return &testServer{
+		ready:     jobs,
+		completed: make(map[string]string),
+		failed:    make(map[string]string),
+		deleted:   make(map[string]bool),
+	}
+}
+
+func (s *testServer) handle(r *workqtest.Request) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Name {
+	case "lease":
+		if len(s.ready) == 0 {
+			s.mu.Unlock()
+			time.Sleep(time.Millisecond)
+			s.mu.Lock()
+			return workqtest.Error("TIMED-OUT", "")
+		}
+
+		j := s.ready[0]
+		s.ready = s.ready[1:]
+		return workqtest.LeasedJob(j.id, j.name, 1000, []byte(j.payload))
+	case "complete":
+		s.completed[r.Args[0]] = string(r.Data)
+		return workqtest.OK()
+	case "fail":
+		s.failed[r.Args[0]] = string(r.Data)
+		return workqtest.OK()
+	case "delete":
+		s.deleted[r.Args[0]] = true
+		return workqtest.OK()
+	}
+
+	return workqtest.Error("CLIENT-ERROR", "Unknown command")
+}
+
+// Wait until n jobs were completed, failed or deleted.
+func (s *testServer) waitDone(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		done := len(s.completed) + len(s.failed) + len(s.deleted)
+		s.mu.Unlock()
+		if done >= n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("Timed out waiting for %d jobs", n)
+}
+
+type testPool struct {
+	s *testServer
+}
+
+func (p *testPool) Get() (*workq.Client, error) {
+	return workqtest.PipeClient(p.s.handle), nil
+}
+
+func (p *testPool) Put(c *workq.Client) {
+	c.Close()
+}
+
+const (
+	id1 = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	id2 = "6ba7b811-9dad-11d1-80b4-00c04fd430c4"
+	id3 = "6ba7b812-9dad-11d1-80b4-00c04fd430c4"
+)
+
+func TestWorkerProcessesJobs(t *testing.T) {
+	s := newTestServer(
+		testJob{id1, "j1", "ok"},
+		testJob{id2, "j1", "err"},
+		testJob{id3, "j1", "panic"},
+	)
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		switch string(j.Payload) {
+		case "err":
+			return nil, errors.New("bad payload")
+		case "panic":
+			panic("boom")
+		}
+
+		return []byte("done:" + string(j.Payload)), nil
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}, Concurrency: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	s.waitDone(t, 3)
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error, err=%s", err)
+	}
+
+	if s.completed[id1] != "done:ok" || s.failed[id2] != "bad payload" || s.failed[id3] != "panic: boom" {
+		t.Fatalf("Result mismatch, completed=%v, failed=%v", s.completed, s.failed)
+	}
+}
+
+func TestWorkerDrainsInFlightJobs(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("b"), nil
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}, GracePeriod: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-errc:
+		t.Fatalf("Run returned before drain, err=%v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error, err=%s", err)
+	}
+
+	if s.completed[id1] != "b" {
+		t.Fatalf("Result mismatch, completed=%v", s.completed)
+	}
+}
+
+func TestWorkerDrainTimeout(t *testing.T) {
+	s := newTestServer(testJob{id1, "j1", "a"})
+	started := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}, GracePeriod: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	<-started
+	cancel()
+	if err := <-errc; err != ErrDrainTimeout {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	if len(s.completed) != 0 || len(s.failed) != 0 {
+		t.Fatalf("Expected abandoned job, completed=%v, failed=%v", s.completed, s.failed)
+	}
+}
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, format)
+}
+
+func TestWorkerLogsCommandErrors(t *testing.T) {
+	defer func(d time.Duration) { errorPause = d }(errorPause)
+	errorPause = time.Millisecond
+
+	var leases int
+	var mu sync.Mutex
+	pool := poolFunc(func() (*workq.Client, error) {
+		return workqtest.PipeClient(func(r *workqtest.Request) []byte {
+			mu.Lock()
+			defer mu.Unlock()
+			leases++
+			return workqtest.Error("SERVER-ERROR", "")
+		}), nil
+	})
+	logger := &testLogger{}
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		return nil, nil
+	})
+	w := New(pool, h, Config{Names: []string{"j1"}, Logger: logger})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("Run error, err=%s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if leases < 2 || len(logger.lines) != leases {
+		t.Fatalf("Log mismatch, leases=%d, lines=%q", leases, logger.lines)
+	}
+}
+
+type poolFunc func() (*workq.Client, error)
+
+func (f poolFunc) Get() (*workq.Client, error) {
+	return f()
+}
+
+func (f poolFunc) Put(c *workq.Client) {
+	c.Close()
+}
+
+type testReporter struct {
+	mu   sync.Mutex
+	errs []string
+	tags []map[string]string
+}
+
+func (r *testReporter) Report(err error, tags map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err.Error())
+	r.tags = append(r.tags, tags)
+}
+
+func TestWorkerReportsFailures(t *testing.T) {
+	s := newTestServer(
+		testJob{id1, "j1", "retry"},
+		testJob{id2, "j1", "permanent"},
+		testJob{id3, "j1", "panic"},
+	)
+	h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		switch string(j.Payload) {
+		case "permanent":
+			return nil, Permanent(errors.New("invalid payload"))
+		case "panic":
+			panic("boom")
+		}
+
+		return nil, errors.New("unavailable")
+	})
+	reporter := &testReporter{}
+	w := New(&testPool{s}, h, Config{Names: []string{"j1"}, Reporter: reporter})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	s.waitDone(t, 3)
+	cancel()
+	<-errc
+
+	expTags := []map[string]string{
+		{"job_id": id2, "job_name": "j1", "failure": "permanent"},
+		{"job_id": id3, "job_name": "j1", "failure": "panic"},
+	}
+	expErrs := []string{"invalid payload", "panic: boom"}
+	if !reflect.DeepEqual(expErrs, reporter.errs) || !reflect.DeepEqual(expTags, reporter.tags) {
+		t.Fatalf("Report mismatch, errs=%q, tags=%v", reporter.errs, reporter.tags)
+	}
+
+	if s.failed[id2] != "invalid payload" {
+		t.Fatalf("Expected failed job, failed=%v", s.failed)
+	}
+}
+
+func TestWorkerAtMostOnce(t *testing.T) {
+	tests := []struct {
+		delivery Delivery
+		acked    func(s *testServer, id string) bool
+	}{
+		{AtMostOnce, func(s *testServer, id string) bool { return s.deleted[id] }},
+		{AtMostOnceComplete, func(s *testServer, id string) bool {
+			result, ok := s.completed[id]
+			return ok && result == ""
+		}},
+	}
+
+	for _, tt := range tests {
+		s := newTestServer(testJob{id1, "j1", "ok"}, testJob{id2, "j1", "err"})
+		var mu sync.Mutex
+		acked := make(map[string]bool)
+		h := HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+			s.mu.Lock()
+			ok := tt.acked(s, j.ID)
+			s.mu.Unlock()
+			mu.Lock()
+			acked[j.ID] = ok
+			mu.Unlock()
+
+			if string(j.Payload) == "err" {
+				return nil, errors.New("bad payload")
+			}
+
+			return []byte("done"), nil
+		})
+		logger := &testLogger{}
+		w := New(&testPool{s}, h, Config{Names: []string{"j1"}, Delivery: tt.delivery, Logger: logger})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error)
+		go func() {
+			errc <- w.Run(ctx)
+		}()
+
+		s.waitDone(t, 2)
+		cancel()
+		<-errc
+
+		mu.Lock()
+		if !acked[id1] || !acked[id2] {
+			t.Fatalf("Expected jobs acknowledged before handler, delivery=%d, acked=%v", tt.delivery, acked)
+		}
+		mu.Unlock()
+		if len(s.failed) != 0 || s.completed[id1] == "done" {
+			t.Fatalf("Expected handler results discarded, completed=%v, failed=%v", s.completed, s.failed)
+		}
+		logger.mu.Lock()
+		if len(logger.lines) != 1 {
+			t.Fatalf("Log mismatch, lines=%q", logger.lines)
+		}
+		logger.mu.Unlock()
+	}
+}
+
+func TestWorkerRotateNames(t *testing.T) {
+	w := New(&testPool{newTestServer()}, nil, Config{
+		Names:       []string{"j1", "j2", "j3"},
+		RotateNames: true,
+	})
+
+	var act []string
+	for i := 0; i < 4; i++ {
+		act = append(act, strings.Join(w.leasable(), " "))
+	}
+
+	exp := []string{"j1 j2 j3", "j2 j3 j1", "j3 j1 j2", "j1 j2 j3"}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Rotation mismatch, act=%q", act)
+	}
+	if !reflect.DeepEqual([]string{"j1", "j2", "j3"}, w.config.Names) {
+		t.Fatalf("Expected names unchanged, names=%v", w.config.Names)
+	}
+}
+
+func TestWorkerWeights(t *testing.T) {
+	w := New(&testPool{newTestServer()}, nil, Config{
+		Names:       []string{"bulk", "critical", "default"},
+		Weights:     map[string]int{"critical": 4, "bulk": 0},
+		RotateNames: true,
+	})
+
+	first := make(map[string]int)
+	var act []string
+	for i := 0; i < 10; i++ {
+		names := w.leasable()
+		first[names[0]]++
+		if i < 2 {
+			act = append(act, strings.Join(names, " "))
+		}
+	}
+
+	if !reflect.DeepEqual(map[string]int{"critical": 8, "default": 2}, first) {
+		t.Fatalf("Ratio mismatch, first=%v", first)
+	}
+	exp := []string{"critical bulk default", "critical bulk default"}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Order mismatch, act=%q", act)
+	}
+}
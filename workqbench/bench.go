@@ -0,0 +1,290 @@
+// Package workqbench generates add, run and lease workloads against a Workq
+// server, reporting throughput and latency percentiles for capacity
+// planning.
+package workqbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Workloads accepted by Config.Workload.
+const (
+	// WorkloadAdd adds background jobs.
+	WorkloadAdd = "add"
+
+	// WorkloadRun runs foreground jobs, leased and completed by as many
+	// consumers as there are producers.
+	WorkloadRun = "run"
+
+	// WorkloadLease leases and completes jobs, e.g. those added by an
+	// earlier add workload. Leases timing out count as errors.
+	WorkloadLease = "lease"
+)
+
+// Config configures a benchmark.
+type Config struct {
+	Workload    string // Defaults to WorkloadAdd.
+	Name        string // Job name, defaults to "workqbench".
+	Concurrency int    // Connections running operations, defaults to 1.
+
+	// Operations to run in total. The benchmark stops at whichever of
+	// Requests and Duration is reached first, at least one must be set.
+	Requests int
+	Duration time.Duration
+
+	PayloadSize int           // Payload bytes of jobs added or run.
+	TTR         time.Duration // Defaults to 1 minute.
+	TTL         time.Duration // Defaults to 1 hour.
+	Timeout     time.Duration // Run & lease timeout, defaults to 10s.
+
+	// Returns a connection for each worker, e.g. Client.Clone.
+	Dial func() (*workq.Client, error)
+}
+
+// Result summarizes a benchmark.
+type Result struct {
+	Workload string
+	Ops      int // Operations succeeded.
+	Errors   int // Operations failed.
+	Elapsed  time.Duration
+
+	// Latencies of succeeded operations.
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// Throughput returns succeeded operations per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf(
+		"%s: %d ops, %d errors in %s (%.1f ops/s), latency p50=%s p90=%s p99=%s max=%s",
+		r.Workload, r.Ops, r.Errors, r.Elapsed, r.Throughput(), r.P50, r.P90, r.P99, r.Max,
+	)
+}
+
+// Run runs the benchmark described by config until done or ctx is
+// cancelled. Returns an error if a connection cannot be dialed.
+func Run(ctx context.Context, config Config) (*Result, error) {
+	if config.Workload == "" {
+		config.Workload = WorkloadAdd
+	}
+	if config.Name == "" {
+		config.Name = "workqbench"
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.TTR <= 0 {
+		config.TTR = time.Minute
+	}
+	if config.TTL <= 0 {
+		config.TTL = time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Requests <= 0 && config.Duration <= 0 {
+		return nil, errors.New("Requests or Duration required")
+	}
+	if config.Dial == nil {
+		return nil, errors.New("Dial required")
+	}
+
+	var op func(c *workq.Client) error
+	switch config.Workload {
+	case WorkloadAdd:
+		op = config.add
+	case WorkloadRun:
+		op = config.run
+	case WorkloadLease:
+		op = config.lease
+	default:
+		return nil, fmt.Errorf("Unknown workload %q", config.Workload)
+	}
+
+	clients, err := dial(config.Dial, config.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(clients)
+
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+
+	// Foreground jobs need consumers.
+	consumeCtx, stopConsumers := context.WithCancel(context.Background())
+	defer stopConsumers()
+	var consumers sync.WaitGroup
+	if config.Workload == WorkloadRun {
+		cs, err := dial(config.Dial, config.Concurrency)
+		if err != nil {
+			return nil, err
+		}
+		defer closeAll(cs)
+
+		for _, c := range cs {
+			consumers.Add(1)
+			go func(c *workq.Client) {
+				defer consumers.Done()
+				config.consume(consumeCtx, c)
+			}(c)
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		started   int64
+		errs      int
+		latencies []time.Duration
+	)
+	start := time.Now()
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *workq.Client) {
+			defer wg.Done()
+			var ls []time.Duration
+			var n int
+			for ctx.Err() == nil {
+				if config.Requests > 0 && atomic.AddInt64(&started, 1) > int64(config.Requests) {
+					break
+				}
+
+				opStart := time.Now()
+				if err := op(c); err != nil {
+					n++
+					continue
+				}
+				ls = append(ls, time.Since(opStart))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			latencies = append(latencies, ls...)
+			errs += n
+		}(c)
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+	stopConsumers()
+	consumers.Wait()
+
+	return summarize(config.Workload, latencies, errs, elapsed), nil
+}
+
+func (config *Config) add(c *workq.Client) error {
+	return c.Add(&workq.BgJob{
+		ID:      workq.NewUUID().String(),
+		Name:    config.Name,
+		TTR:     millis(config.TTR),
+		TTL:     millis(config.TTL),
+		Payload: make([]byte, config.PayloadSize),
+	})
+}
+
+func (config *Config) run(c *workq.Client) error {
+	_, err := c.Run(&workq.FgJob{
+		ID:      workq.NewUUID().String(),
+		Name:    config.Name,
+		TTR:     millis(config.TTR),
+		Timeout: millis(config.Timeout),
+		Payload: make([]byte, config.PayloadSize),
+	})
+	return err
+}
+
+func (config *Config) lease(c *workq.Client) error {
+	j, err := c.Lease([]string{config.Name}, millis(config.Timeout))
+	if err != nil {
+		return err
+	}
+
+	return c.Complete(j.ID, nil)
+}
+
+// Lease and complete jobs until ctx is cancelled.
+func (config *Config) consume(ctx context.Context, c *workq.Client) {
+	for ctx.Err() == nil {
+		j, err := c.Lease([]string{config.Name}, 100)
+		if err != nil {
+			if !workq.IsTimedOut(err) {
+				return
+			}
+			continue
+		}
+
+		c.Complete(j.ID, nil)
+	}
+}
+
+func dial(fn func() (*workq.Client, error), n int) ([]*workq.Client, error) {
+	var clients []*workq.Client
+	for i := 0; i < n; i++ {
+		c, err := fn()
+		if err != nil {
+			closeAll(clients)
+			return nil, err
+		}
+
+		clients = append(clients, c)
+	}
+
+	return clients, nil
+}
+
+func closeAll(clients []*workq.Client) {
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+func summarize(workload string, latencies []time.Duration, errs int, elapsed time.Duration) *Result {
+	r := &Result{Workload: workload, Ops: len(latencies), Errors: errs, Elapsed: elapsed}
+	if len(latencies) == 0 {
+		return r
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	r.P50 = percentile(latencies, 50)
+	r.P90 = percentile(latencies, 90)
+	r.P99 = percentile(latencies, 99)
+	r.Max = latencies[len(latencies)-1]
+	return r
+}
+
+// Nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+func millis(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
@@ -0,0 +1,102 @@
+package workqbench
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+// In-memory queue, running foreground jobs at once.
+type testServer struct {
+	mu    sync.Mutex
+	ready []string
+	done  int
+}
+
+func (s *testServer) handle(r *workqtest.Request) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Name {
+	case "add":
+		s.ready = append(s.ready, r.Args[0])
+		return workqtest.OK()
+	case "run":
+		return workqtest.Result(r.Args[0], true, nil)
+	case "lease":
+		if len(s.ready) == 0 {
+			return workqtest.Error("TIMED-OUT", "")
+		}
+
+		id := s.ready[0]
+		s.ready = s.ready[1:]
+		return workqtest.LeasedJob(id, "workqbench", 60000, nil)
+	case "complete":
+		s.done++
+		return workqtest.OK()
+	}
+
+	return workqtest.Error("CLIENT-ERROR", "Unknown command")
+}
+
+func (s *testServer) dial() (*workq.Client, error) {
+	return workqtest.PipeClient(s.handle), nil
+}
+
+func TestRun(t *testing.T) {
+	s := &testServer{}
+	ctx := context.Background()
+	r, err := Run(ctx, Config{Concurrency: 4, Requests: 100, PayloadSize: 10, Dial: s.dial})
+	if err != nil {
+		t.Fatalf("Run mismatch, err=%s", err)
+	}
+	if r.Ops != 100 || r.Errors != 0 || len(s.ready) != 100 {
+		t.Fatalf("Result mismatch, result=%s, ready=%d", r, len(s.ready))
+	}
+	if r.P50 <= 0 || r.P50 > r.P90 || r.P90 > r.P99 || r.P99 > r.Max || r.Throughput() <= 0 {
+		t.Fatalf("Latency mismatch, result=%s", r)
+	}
+
+	r, err = Run(ctx, Config{Workload: WorkloadLease, Concurrency: 2, Requests: 101, Timeout: time.Millisecond, Dial: s.dial})
+	if err != nil {
+		t.Fatalf("Run mismatch, err=%s", err)
+	}
+	if r.Ops != 100 || r.Errors != 1 || s.done != 100 {
+		t.Fatalf("Result mismatch, result=%s, done=%d", r, s.done)
+	}
+
+	r, err = Run(ctx, Config{Workload: WorkloadRun, Duration: 10 * time.Millisecond, Dial: s.dial})
+	if err != nil || r.Ops == 0 || r.Errors != 0 {
+		t.Fatalf("Result mismatch, result=%v, err=%v", r, err)
+	}
+}
+
+func TestRunConfigErrors(t *testing.T) {
+	s := &testServer{}
+	configs := []Config{
+		{Dial: s.dial},
+		{Requests: 1},
+		{Requests: 1, Workload: "unknown", Dial: s.dial},
+	}
+
+	for _, config := range configs {
+		if _, err := Run(context.Background(), config); err == nil {
+			t.Fatalf("Expected error, config=%+v", config)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 10; i++ {
+		latencies = append(latencies, time.Duration(i))
+	}
+
+	r := summarize("add", latencies, 0, time.Second)
+	if r.P50 != 5 || r.P90 != 9 || r.P99 != 10 || r.Max != 10 {
+		t.Fatalf("Percentile mismatch, result=%s", r)
+	}
+}
@@ -0,0 +1,179 @@
+// Package workqblob offloads oversized job payloads to blob storage,
+// enqueuing only a pointer to the stored payload.
+package workqblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/worker"
+)
+
+// Max payload size accepted by the server.
+const maxPayload = 1048576
+
+// Prefix of payloads pointing to a stored blob, followed by its key.
+var pointerPrefix = []byte("workq-blob:")
+
+var (
+	// ErrNotFound is returned by a Store for a missing key.
+	ErrNotFound = errors.New("Blob not found")
+)
+
+// Store persists blobs by key, e.g. in S3, GCS or a shared filesystem.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Codec replaces payloads larger than Threshold by a pointer to the payload
+// stored in Store, keyed by job ID.
+type Codec struct {
+	Store     Store
+	Threshold int // Max payload size sent inline, defaults to the 1 MiB server limit.
+}
+
+// Whether payload is stored rather than sent inline. Payloads that happen to
+// look like a pointer are stored as well to keep decoding unambiguous.
+func (c *Codec) offloads(payload []byte) bool {
+	threshold := c.Threshold
+	if threshold <= 0 || threshold > maxPayload {
+		threshold = maxPayload
+	}
+
+	return len(payload) > threshold || bytes.HasPrefix(payload, pointerPrefix)
+}
+
+// Encode returns the payload to enqueue for job id, storing payloads larger
+// than the threshold.
+func (c *Codec) Encode(ctx context.Context, id string, payload []byte) ([]byte, error) {
+	if !c.offloads(payload) {
+		return payload, nil
+	}
+
+	if err := c.Store.Put(ctx, id, payload); err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte(nil), pointerPrefix...), id...), nil
+}
+
+// Decode returns the original payload, fetching it from the store when
+// payload is a pointer. Returns the blob key, empty for inline payloads.
+func (c *Codec) Decode(ctx context.Context, payload []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(payload, pointerPrefix) {
+		return payload, "", nil
+	}
+
+	key := string(payload[len(pointerPrefix):])
+	data, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("workqblob: get %s: %s", key, err)
+	}
+
+	return data, key, nil
+}
+
+// Add adds j through client, offloading its payload when over the threshold.
+// A stored payload is deleted again only when the add was rejected, as on
+// other errors, e.g. lost connections, the job may have been added.
+func (c *Codec) Add(ctx context.Context, client *workq.Client, j *workq.BgJob) error {
+	id := jobID(j.ID, j.UUID)
+	if id == "" {
+		return workq.ErrInvalidID
+	}
+
+	payload, err := c.Encode(ctx, id, j.Payload)
+	if err != nil {
+		return err
+	}
+
+	encoded := *j
+	encoded.Payload = payload
+	if err := client.Add(&encoded); err != nil {
+		if c.offloads(j.Payload) && rejected(err) {
+			c.Store.Delete(ctx, id)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Schedule schedules j through client, offloading its payload when over the
+// threshold. A stored payload is deleted again only when scheduling was
+// rejected, as on other errors the job may have been scheduled.
+func (c *Codec) Schedule(ctx context.Context, client *workq.Client, j *workq.ScheduledJob) error {
+	id := jobID(j.ID, j.UUID)
+	if id == "" {
+		return workq.ErrInvalidID
+	}
+
+	payload, err := c.Encode(ctx, id, j.Payload)
+	if err != nil {
+		return err
+	}
+
+	encoded := *j
+	encoded.Payload = payload
+	if err := client.Schedule(&encoded); err != nil {
+		if c.offloads(j.Payload) && rejected(err) {
+			c.Store.Delete(ctx, id)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Handler wraps h to receive the original payload of offloaded jobs.
+// A job's blob is deleted once the Worker completed the job, and kept for
+// its next attempt when h fails or completing fails. Jobs whose blob cannot
+// be fetched are failed, while a failed delete leaves the blob behind.
+// Outside of Workers, blobs are never deleted and are left to a TTL or GC
+// of the store.
+func (c *Codec) Handler(h worker.Handler) worker.Handler {
+	return worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		payload, key, err := c.Decode(ctx, j.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded := *j
+		decoded.Payload = payload
+		result, err := h.Handle(ctx, &decoded)
+		if err != nil || key == "" {
+			return result, err
+		}
+
+		worker.AfterComplete(ctx, func() {
+			c.Store.Delete(context.Background(), key)
+		})
+		return result, nil
+	})
+}
+
+// Whether err is a definitive rejection of a job, which was not enqueued.
+// Duplicates are rejected as well, but their blob belongs to the queued job.
+func rejected(err error) bool {
+	if _, ok := err.(*workq.LintError); ok {
+		return true
+	}
+
+	return err == workq.ErrPayloadTooLarge || (workq.IsClientError(err) && !workq.IsDuplicate(err))
+}
+
+// Blob key of a job, its ID or else its binary UUID.
+func jobID(id string, u workq.UUID) string {
+	if id == "" && !u.IsZero() {
+		return u.String()
+	}
+
+	return id
+}
@@ -0,0 +1,240 @@
+package workqblob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/worker"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+const testID = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+
+type memStore map[string][]byte
+
+func (m memStore) Put(ctx context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m memStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return data, nil
+}
+
+func (m memStore) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	store := memStore{}
+	c := &Codec{Store: store, Threshold: 4}
+	ctx := context.Background()
+
+	tests := []struct {
+		payload []byte
+		stored  bool
+	}{
+		{[]byte("abcd"), false},
+		{[]byte("abcde"), true},
+		{[]byte("workq-blob:x"), true},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		encoded, err := c.Encode(ctx, testID, tt.payload)
+		if err != nil {
+			t.Fatalf("Encode error, err=%s", err)
+		}
+
+		_, stored := store[testID]
+		if stored != tt.stored {
+			t.Fatalf("Stored mismatch, payload=%q, stored=%t", tt.payload, stored)
+		}
+		if stored && string(encoded) != "workq-blob:"+testID {
+			t.Fatalf("Pointer mismatch, encoded=%q", encoded)
+		}
+
+		decoded, key, err := c.Decode(ctx, encoded)
+		if err != nil || !bytes.Equal(decoded, tt.payload) || (key != "") != tt.stored {
+			t.Fatalf("Decode mismatch, payload=%q, decoded=%q, key=%q, err=%v", tt.payload, decoded, key, err)
+		}
+
+		delete(store, testID)
+	}
+}
+
+func TestCodecDefaultThreshold(t *testing.T) {
+	c := &Codec{Store: memStore{}}
+	if c.offloads(make([]byte, maxPayload)) || !c.offloads(make([]byte, maxPayload+1)) {
+		t.Fatalf("Expected offloading above the server limit")
+	}
+}
+
+func TestCodecAdd(t *testing.T) {
+	store := memStore{}
+	c := &Codec{Store: store, Threshold: 1}
+	var data []byte
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		data = r.Data
+		return workqtest.OK()
+	})
+	defer client.Close()
+
+	j := &workq.BgJob{ID: testID, Name: "j1", Payload: []byte("abc")}
+	if err := c.Add(context.Background(), client, j); err != nil {
+		t.Fatalf("Add error, err=%s", err)
+	}
+
+	if string(data) != "workq-blob:"+testID || string(store[testID]) != "abc" || string(j.Payload) != "abc" {
+		t.Fatalf("Add mismatch, data=%q, store=%q, payload=%q", data, store, j.Payload)
+	}
+}
+
+func TestCodecAddErrorDeletesBlob(t *testing.T) {
+	tests := []struct {
+		reply []byte
+		kept  bool
+	}{
+		{workqtest.Error("CLIENT-ERROR", "Invalid"), false},
+		{workqtest.Error("CLIENT-ERROR", workq.TextDuplicate), true},
+		{workqtest.Error("SERVER-ERROR", "Unavailable"), true},
+		{[]byte("+OK?\r\n"), true},
+	}
+
+	for _, tt := range tests {
+		store := memStore{}
+		c := &Codec{Store: store, Threshold: 1}
+		client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+			return tt.reply
+		})
+
+		err := c.Schedule(context.Background(), client, &workq.ScheduledJob{ID: testID, Name: "j1", Payload: []byte("abc")})
+		client.Close()
+		if _, kept := store[testID]; err == nil || kept != tt.kept {
+			t.Fatalf("Blob mismatch, reply=%q, err=%v, kept=%t", tt.reply, err, kept)
+		}
+	}
+}
+
+func TestCodecAddEmptyID(t *testing.T) {
+	store := memStore{}
+	c := &Codec{Store: store, Threshold: 1}
+	client := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		return workqtest.OK()
+	})
+	defer client.Close()
+
+	err := c.Add(context.Background(), client, &workq.BgJob{Name: "j1", Payload: []byte("abc")})
+	if err != workq.ErrInvalidID || len(store) != 0 {
+		t.Fatalf("Expected ErrInvalidID, err=%v, store=%q", err, store)
+	}
+}
+
+func TestCodecHandler(t *testing.T) {
+	store := memStore{testID: []byte("abc")}
+	c := &Codec{Store: store}
+	ctx := context.Background()
+
+	var payload []byte
+	fail := true
+	h := c.Handler(worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		payload = j.Payload
+		if fail {
+			return nil, errors.New("failed")
+		}
+
+		return []byte("ok"), nil
+	}))
+
+	j := &workq.LeasedJob{ID: testID, Name: "j1", Payload: []byte("workq-blob:" + testID)}
+	if _, err := h.Handle(ctx, j); err == nil || string(payload) != "abc" || len(store) != 1 {
+		t.Fatalf("Expected kept blob on failure, err=%v, payload=%q, store=%q", err, payload, store)
+	}
+
+	fail = false
+	result, err := h.Handle(ctx, j)
+	if err != nil || string(result) != "ok" || len(store) != 1 {
+		t.Fatalf("Expected kept blob outside of workers, err=%v, result=%q, store=%q", err, result, store)
+	}
+
+	delete(store, testID)
+	_, err = h.Handle(ctx, j)
+	if err == nil || err.Error() != "workqblob: get "+testID+": Blob not found" {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+// Serves a single leased job, recording whether the blob was still stored
+// when the job was completed.
+type testPool struct {
+	mu      sync.Mutex
+	store   memStore
+	leased  bool
+	stored  bool
+	done    chan struct{}
+	payload []byte
+}
+
+func (p *testPool) Get() (*workq.Client, error) {
+	return workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		switch r.Name {
+		case "lease":
+			if p.leased {
+				return workqtest.Error("TIMED-OUT", "")
+			}
+
+			p.leased = true
+			return workqtest.LeasedJob(testID, "j1", 1000, p.payload)
+		case "complete":
+			_, p.stored = p.store[testID]
+			close(p.done)
+			return workqtest.OK()
+		}
+
+		return workqtest.Error("CLIENT-ERROR", "Unknown command")
+	}), nil
+}
+
+func (p *testPool) Put(c *workq.Client) {
+	c.Close()
+}
+
+func TestCodecHandlerDeletesAfterComplete(t *testing.T) {
+	store := memStore{testID: []byte("abc")}
+	c := &Codec{Store: store}
+	pool := &testPool{store: store, done: make(chan struct{}), payload: []byte("workq-blob:" + testID)}
+	h := c.Handler(worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		return []byte("ok"), nil
+	}))
+	w := worker.New(pool, h, worker.Config{Names: []string{"j1"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		errc <- w.Run(ctx)
+	}()
+
+	<-pool.done
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Run error, err=%s", err)
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if !pool.stored || len(store) != 0 {
+		t.Fatalf("Expected blob deleted after complete, stored=%t, store=%q", pool.stored, store)
+	}
+}
@@ -0,0 +1,58 @@
+package workqblob
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DirStore stores blobs as files in a directory, e.g. a volume shared by
+// producers and workers.
+type DirStore string
+
+// Put writes data to the file named key, replacing it atomically.
+func (d DirStore) Put(ctx context.Context, key string, data []byte) error {
+	f, err := ioutil.TempFile(string(d), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+// Get reads the file named key.
+func (d DirStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Delete removes the file named key.
+func (d DirStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Keys are job IDs, the base name guards against path traversal regardless.
+func (d DirStore) path(key string) string {
+	return filepath.Join(string(d), filepath.Base(key))
+}
@@ -0,0 +1,52 @@
+package workqblob
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workqblob")
+	if err != nil {
+		t.Fatalf("TempDir error, err=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := DirStore(dir)
+	ctx := context.Background()
+	if err := store.Put(ctx, testID, []byte("a")); err != nil {
+		t.Fatalf("Put error, err=%s", err)
+	}
+	if err := store.Put(ctx, testID, []byte("b")); err != nil {
+		t.Fatalf("Put error, err=%s", err)
+	}
+
+	data, err := store.Get(ctx, testID)
+	if err != nil || string(data) != "b" {
+		t.Fatalf("Get mismatch, data=%q, err=%v", data, err)
+	}
+
+	if err := store.Delete(ctx, testID); err != nil {
+		t.Fatalf("Delete error, err=%s", err)
+	}
+	if _, err := store.Get(ctx, testID); err != ErrNotFound {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if err := store.Delete(ctx, testID); err != ErrNotFound {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("Expected empty dir, files=%d", len(files))
+	}
+}
+
+func TestDirStorePathTraversal(t *testing.T) {
+	store := DirStore("/blobs")
+	if p := store.path("../../etc/passwd"); p != "/blobs/passwd" {
+		t.Fatalf("Path mismatch, path=%s", p)
+	}
+}
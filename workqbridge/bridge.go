@@ -0,0 +1,111 @@
+// Package workqbridge moves jobs between Workq and streaming systems such as
+// Kafka or NATS.
+//
+// The package is broker agnostic: Publisher and Source are implemented over
+// the broker client of choice, keeping this module free of their
+// dependencies.
+package workqbridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/worker"
+)
+
+// Message is a single record of a stream.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+
+	// Ack commits consumption of a received message, e.g. its Kafka offset or
+	// NATS JetStream ack. Nil when the source needs no acknowledgement.
+	Ack func() error
+}
+
+// Publisher publishes messages to a topic, returning once the broker
+// acknowledged them.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, m *Message) error
+}
+
+// Source receives messages from a stream, blocking until one is available
+// or ctx is cancelled.
+type Source interface {
+	Next(ctx context.Context) (*Message, error)
+}
+
+// Headers set on messages published by Outbound.
+const (
+	HeaderID   = "workq-id"
+	HeaderName = "workq-name"
+)
+
+// Outbound returns a worker Handler publishing each leased job to the topic
+// returned by topic, or the job name when nil. Jobs are completed once the
+// broker acknowledged the message and failed otherwise, so a job is only
+// removed from Workq after it was published.
+//
+// Messages are keyed by job ID, with the payload as value. A job leased
+// again after its TTR expired mid-publish is published again with the same
+// key.
+func Outbound(p Publisher, topic func(j *workq.LeasedJob) string) worker.Handler {
+	return worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		t := j.Name
+		if topic != nil {
+			t = topic(j)
+		}
+
+		err := p.Publish(ctx, t, &Message{
+			Key:   []byte(j.ID),
+			Value: j.Payload,
+			Headers: map[string]string{
+				HeaderID:   j.ID,
+				HeaderName: j.Name,
+			},
+		})
+		return nil, err
+	})
+}
+
+// JobMapper converts a received message to the job to add.
+// IDs should be derived from the message, e.g. its key, so a message
+// redelivered before its ack re-adds the same job.
+type JobMapper func(m *Message) (*workq.BgJob, error)
+
+// Inbound adds a job per message received from src through c until ctx is
+// cancelled. Messages are acknowledged only after their job was added, so a
+// failure leaves the message to be redelivered by the broker. A redelivered
+// message whose job the server refuses as a duplicate was added before and
+// is acknowledged.
+//
+// Returns nil once ctx is cancelled, or the first receive, mapping, add or
+// ack error.
+func Inbound(ctx context.Context, src Source, c *workq.Client, mapJob JobMapper) error {
+	for {
+		m, err := src.Next(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		j, err := mapJob(m)
+		if err != nil {
+			return fmt.Errorf("workqbridge: map message key=%q: %s", m.Key, err)
+		}
+
+		if err := c.Add(j); err != nil && !workq.IsDuplicate(err) {
+			return err
+		}
+
+		if m.Ack != nil {
+			if err := m.Ack(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package workqbridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+const (
+	testID  = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	testID2 = "6ba7b811-9dad-11d1-80b4-00c04fd430c4"
+)
+
+type publishFunc func(ctx context.Context, topic string, m *Message) error
+
+func (f publishFunc) Publish(ctx context.Context, topic string, m *Message) error {
+	return f(ctx, topic, m)
+}
+
+func TestOutbound(t *testing.T) {
+	var topic string
+	var msg *Message
+	p := publishFunc(func(ctx context.Context, t string, m *Message) error {
+		topic, msg = t, m
+		return nil
+	})
+
+	j := &workq.LeasedJob{ID: testID, Name: "j1", Payload: []byte("a")}
+	result, err := Outbound(p, nil).Handle(context.Background(), j)
+	if result != nil || err != nil {
+		t.Fatalf("Handle mismatch, result=%q, err=%v", result, err)
+	}
+
+	expMsg := &Message{
+		Key:     []byte(testID),
+		Value:   []byte("a"),
+		Headers: map[string]string{HeaderID: testID, HeaderName: "j1"},
+	}
+	if topic != "j1" || !reflect.DeepEqual(expMsg, msg) {
+		t.Fatalf("Message mismatch, topic=%s, msg=%+v", topic, msg)
+	}
+
+	_, err = Outbound(p, func(j *workq.LeasedJob) string { return "jobs." + j.Name }).Handle(context.Background(), j)
+	if err != nil || topic != "jobs.j1" {
+		t.Fatalf("Topic mismatch, topic=%s, err=%v", topic, err)
+	}
+}
+
+func TestOutboundPublishError(t *testing.T) {
+	expErr := errors.New("broker unavailable")
+	p := publishFunc(func(ctx context.Context, t string, m *Message) error {
+		return expErr
+	})
+
+	j := &workq.LeasedJob{ID: testID, Name: "j1"}
+	if _, err := Outbound(p, nil).Handle(context.Background(), j); err != expErr {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+// Source returning queued messages, then blocking until cancelled.
+type testSource struct {
+	msgs []*Message
+}
+
+func (s *testSource) Next(ctx context.Context) (*Message, error) {
+	if len(s.msgs) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	m := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return m, nil
+}
+
+func TestInbound(t *testing.T) {
+	var acked []string
+	msg := func(key string) *Message {
+		return &Message{
+			Key:   []byte(key),
+			Value: []byte("payload-" + key),
+			Ack: func() error {
+				acked = append(acked, key)
+				return nil
+			},
+		}
+	}
+	src := &testSource{msgs: []*Message{msg(testID), msg(testID2)}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var added []string
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		added = append(added, r.Args[0]+" "+string(r.Data))
+		if len(added) == 2 {
+			cancel()
+		}
+
+		return workqtest.OK()
+	})
+	defer c.Close()
+
+	mapJob := func(m *Message) (*workq.BgJob, error) {
+		return &workq.BgJob{ID: string(m.Key), Name: "j1", TTR: 1, TTL: 1, Payload: m.Value}, nil
+	}
+	if err := Inbound(ctx, src, c, mapJob); err != nil {
+		t.Fatalf("Inbound error, err=%s", err)
+	}
+
+	expAdded := []string{
+		testID + " payload-" + testID,
+		testID2 + " payload-" + testID2,
+	}
+	if !reflect.DeepEqual(expAdded, added) || len(acked) != 2 {
+		t.Fatalf("Inbound mismatch, added=%q, acked=%q", added, acked)
+	}
+}
+
+func TestInboundAddErrorSkipsAck(t *testing.T) {
+	var acked bool
+	src := &testSource{msgs: []*Message{{
+		Key: []byte(testID),
+		Ack: func() error {
+			acked = true
+			return nil
+		},
+	}}}
+
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		return workqtest.Error("SERVER-ERROR", "")
+	})
+	defer c.Close()
+
+	mapJob := func(m *Message) (*workq.BgJob, error) {
+		return &workq.BgJob{ID: string(m.Key), Name: "j1"}, nil
+	}
+	err := Inbound(context.Background(), src, c, mapJob)
+	if _, ok := err.(*workq.ResponseError); !ok || acked {
+		t.Fatalf("Inbound mismatch, err=%v, acked=%t", err, acked)
+	}
+}
+
+func TestInboundAcksDuplicate(t *testing.T) {
+	var acked bool
+	src := &testSource{msgs: []*Message{{
+		Key: []byte(testID),
+		Ack: func() error {
+			acked = true
+			return nil
+		},
+	}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		cancel()
+		return workqtest.Error("CLIENT-ERROR", "Duplicate job ID")
+	})
+	defer c.Close()
+
+	mapJob := func(m *Message) (*workq.BgJob, error) {
+		return &workq.BgJob{ID: string(m.Key), Name: "j1", TTR: 1, TTL: 1}, nil
+	}
+	if err := Inbound(ctx, src, c, mapJob); err != nil || !acked {
+		t.Fatalf("Inbound mismatch, err=%v, acked=%t", err, acked)
+	}
+}
+
+func TestInboundMapError(t *testing.T) {
+	src := &testSource{msgs: []*Message{{Key: []byte("k")}}}
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		return workqtest.OK()
+	})
+	defer c.Close()
+
+	mapJob := func(m *Message) (*workq.BgJob, error) {
+		return nil, errors.New("bad message")
+	}
+	err := Inbound(context.Background(), src, c, mapJob)
+	if err == nil || err.Error() != `workqbridge: map message key="k": bad message` {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package workqbridge
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iamduo/go-workq"
+	"github.com/satori/go.uuid"
+)
+
+// Headers read by HeaderJobs.
+const (
+	HeaderTTR      = "workq-ttr"
+	HeaderTTL      = "workq-ttl"
+	HeaderPriority = "workq-priority"
+)
+
+// HeaderJobs returns a JobMapper for sources carrying job settings as
+// message headers, e.g. AMQP queues fed by producers not yet moved off
+// RabbitMQ. The job name, TTR, TTL & priority are read from HeaderName,
+// HeaderTTR, HeaderTTL & HeaderPriority, falling back to defaults when
+// absent. The message value becomes the payload.
+//
+// The ID is read from HeaderID, then the message key, e.g. the AMQP message
+// ID, when either is a valid job ID. Otherwise it is derived from both as a
+// UUIDv5, so a message redelivered by the source is refused as a duplicate.
+// Only messages without either get a random ID, delivering them at least
+// once: a redelivered message is added again as a duplicate job.
+func HeaderJobs(defaults workq.BgJob) JobMapper {
+	return func(m *Message) (*workq.BgJob, error) {
+		j := defaults
+		j.Payload = m.Value
+		if name, ok := m.Headers[HeaderName]; ok {
+			j.Name = name
+		}
+
+		ints := []struct {
+			key string
+			dst *int
+		}{
+			{HeaderTTR, &j.TTR},
+			{HeaderTTL, &j.TTL},
+			{HeaderPriority, &j.Priority},
+		}
+		for _, h := range ints {
+			v, ok := m.Headers[h.key]
+			if !ok {
+				continue
+			}
+
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header %q", h.key, v)
+			}
+			*h.dst = n
+		}
+
+		j.ID = headerID(m)
+		return &j, nil
+	}
+}
+
+// Namespace of job IDs derived from message identifiers.
+var idNamespace = uuid.NewV5(uuid.NamespaceURL, "https://github.com/iamduo/go-workq/workqbridge")
+
+// Job ID of m, see HeaderJobs.
+func headerID(m *Message) string {
+	id, key := m.Headers[HeaderID], string(m.Key)
+	for _, v := range []string{id, key} {
+		if workq.ValidateID(v) == nil {
+			return v
+		}
+	}
+
+	if id == "" && key == "" {
+		return uuid.NewV4().String()
+	}
+
+	return uuid.NewV5(idNamespace, id+"\x00"+key).String()
+}
@@ -0,0 +1,79 @@
+package workqbridge
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestHeaderJobs(t *testing.T) {
+	defaults := workq.BgJob{ID: testID2, Name: "default", TTR: 1000, TTL: 60000, MaxAttempts: 3}
+	mapJob := HeaderJobs(defaults)
+
+	tests := []struct {
+		msg *Message
+		exp *workq.BgJob
+	}{
+		{
+			&Message{Key: []byte(testID), Value: []byte("a")},
+			&workq.BgJob{ID: testID, Name: "default", TTR: 1000, TTL: 60000, Payload: []byte("a"), MaxAttempts: 3},
+		},
+		{
+			&Message{
+				Key:   []byte("amqp-message-id"),
+				Value: []byte("a"),
+				Headers: map[string]string{
+					HeaderID:       testID,
+					HeaderName:     "j1",
+					HeaderTTR:      "5",
+					HeaderTTL:      "6",
+					HeaderPriority: "-7",
+				},
+			},
+			&workq.BgJob{ID: testID, Name: "j1", TTR: 5, TTL: 6, Payload: []byte("a"), Priority: -7, MaxAttempts: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		j, err := mapJob(tt.msg)
+		if err != nil || !reflect.DeepEqual(tt.exp, j) {
+			t.Fatalf("Job mismatch, exp=%+v, act=%+v, err=%v", tt.exp, j, err)
+		}
+	}
+}
+
+func TestHeaderJobsDerivesID(t *testing.T) {
+	mapJob := HeaderJobs(workq.BgJob{ID: testID})
+	id := func(m *Message) string {
+		j, err := mapJob(m)
+		if err != nil || workq.ValidateID(j.ID) != nil || j.ID == testID {
+			t.Fatalf("Expected generated ID, id=%q, err=%v", j.ID, err)
+		}
+
+		return j.ID
+	}
+
+	m := &Message{Key: []byte("amqp-message-id")}
+	if id(m) != id(m) {
+		t.Fatalf("Expected ID derived from key")
+	}
+	if id(m) == id(&Message{Key: []byte("amqp-message-id-2")}) {
+		t.Fatalf("Expected IDs of distinct keys to differ")
+	}
+	if id(m) == id(&Message{Key: []byte("amqp-message-id"), Headers: map[string]string{HeaderID: "1"}}) {
+		t.Fatalf("Expected ID derived from header")
+	}
+
+	if id(&Message{}) == id(&Message{}) {
+		t.Fatalf("Expected random IDs without identifiers")
+	}
+}
+
+func TestHeaderJobsInvalidHeader(t *testing.T) {
+	m := &Message{Headers: map[string]string{HeaderTTR: "5s"}}
+	_, err := HeaderJobs(workq.BgJob{})(m)
+	if err == nil || err.Error() != `invalid workq-ttr header "5s"` {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package workqenvelope versions job payloads so workers can decode payloads
+// produced by older code, e.g. scheduled jobs enqueued months ago.
+//
+// Payloads are JSON envelopes carrying a schema version, upgraded on the
+// worker side by migrations registered per job name.
+package workqenvelope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/worker"
+)
+
+// Envelope is the payload format, data encoded by schema version.
+type Envelope struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Marshal returns the payload for v encoded as JSON at schema version.
+func Marshal(version int, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&Envelope{Version: version, Data: data})
+}
+
+// Migration upgrades data from one schema version to the next.
+type Migration func(data json.RawMessage) (json.RawMessage, error)
+
+// Registry holds the migrations of each job name.
+type Registry struct {
+	mu    sync.RWMutex
+	names map[string]map[int]Migration // Migrations by version upgraded from.
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]map[int]Migration)}
+}
+
+// Register sets the migration upgrading payloads of job name from version
+// from to from+1. The latest version of a name is one past its highest
+// registered migration.
+func (r *Registry) Register(name string, from int, m Migration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] == nil {
+		r.names[name] = make(map[int]Migration)
+	}
+
+	r.names[name][from] = m
+}
+
+// Upgrade decodes an enveloped payload of job name, returning its data
+// migrated to the latest version.
+//
+// Payloads newer than the latest version are rejected, e.g. produced by a
+// newer deploy than the worker runs, so their jobs fail and are retried.
+func (r *Registry) Upgrade(name string, payload []byte) (json.RawMessage, error) {
+	var env Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return nil, fmt.Errorf("workqenvelope: invalid envelope: %s", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	migrations := r.names[name]
+	if len(migrations) == 0 {
+		return env.Data, nil
+	}
+
+	var latest int
+	for from := range migrations {
+		if from+1 > latest {
+			latest = from + 1
+		}
+	}
+	if env.Version > latest {
+		return nil, fmt.Errorf("workqenvelope: %s version %d newer than %d", name, env.Version, latest)
+	}
+
+	data := env.Data
+	for v := env.Version; v < latest; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("workqenvelope: no %s migration from version %d", name, v)
+		}
+
+		var err error
+		if data, err = m(data); err != nil {
+			return nil, fmt.Errorf("workqenvelope: %s migration from version %d: %s", name, v, err)
+		}
+	}
+
+	return data, nil
+}
+
+// Unmarshal decodes an enveloped payload of job name into v, migrating it to
+// the latest version first.
+func (r *Registry) Unmarshal(name string, payload []byte, v interface{}) error {
+	data, err := r.Upgrade(name, payload)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Handler wraps h to receive the data of each payload migrated to the latest
+// version of its job name instead of the envelope. Jobs with payloads that
+// cannot be upgraded are failed.
+func (r *Registry) Handler(h worker.Handler) worker.Handler {
+	return worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		data, err := r.Upgrade(j.Name, j.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		upgraded := *j
+		upgraded.Payload = data
+		return h.Handle(ctx, &upgraded)
+	})
+}
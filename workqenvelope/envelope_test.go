@@ -0,0 +1,116 @@
+package workqenvelope
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/worker"
+)
+
+// Version 1 had a single name field, version 2 split it and version 3
+// renamed "first" to "given".
+type user struct {
+	Given string `json:"given"`
+	Last  string `json:"last"`
+}
+
+func testRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("signup", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 struct{ Name string }
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(map[string]string{"first": v1.Name, "last": ""})
+	})
+	r.Register("signup", 2, func(data json.RawMessage) (json.RawMessage, error) {
+		var v2 map[string]string
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(&user{Given: v2["first"], Last: v2["last"]})
+	})
+	return r
+}
+
+func TestUnmarshalMigrates(t *testing.T) {
+	r := testRegistry()
+	tests := []struct {
+		version int
+		v       interface{}
+	}{
+		{1, map[string]string{"name": "Ada"}},
+		{2, map[string]string{"first": "Ada", "last": ""}},
+		{3, &user{Given: "Ada"}},
+	}
+
+	for _, tt := range tests {
+		payload, err := Marshal(tt.version, tt.v)
+		if err != nil {
+			t.Fatalf("Marshal error, err=%s", err)
+		}
+
+		var u user
+		if err := r.Unmarshal("signup", payload, &u); err != nil || u != (user{Given: "Ada"}) {
+			t.Fatalf("Unmarshal mismatch, version=%d, user=%+v, err=%v", tt.version, u, err)
+		}
+	}
+}
+
+func TestUpgradeWithoutMigrations(t *testing.T) {
+	data, err := NewRegistry().Upgrade("j1", []byte(`{"version":7,"data":{"a":1}}`))
+	if err != nil || string(data) != `{"a":1}` {
+		t.Fatalf("Upgrade mismatch, data=%s, err=%v", data, err)
+	}
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	r := testRegistry()
+	r.Register("gap", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		return data, nil
+	})
+	r.Register("gap", 3, func(data json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("unsupported")
+	})
+
+	tests := []struct {
+		name    string
+		payload string
+		expErr  string
+	}{
+		{"signup", `a`, "workqenvelope: invalid envelope: invalid character 'a' looking for beginning of value"},
+		{"signup", `{"version":4,"data":{}}`, "workqenvelope: signup version 4 newer than 3"},
+		{"gap", `{"version":1,"data":{}}`, "workqenvelope: no gap migration from version 2"},
+		{"gap", `{"version":3,"data":{}}`, "workqenvelope: gap migration from version 3: unsupported"},
+	}
+
+	for _, tt := range tests {
+		_, err := r.Upgrade(tt.name, []byte(tt.payload))
+		if err == nil || err.Error() != tt.expErr {
+			t.Fatalf("Error mismatch, payload=%s, err=%v", tt.payload, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var payload string
+	h := testRegistry().Handler(worker.HandlerFunc(func(ctx context.Context, j *workq.LeasedJob) ([]byte, error) {
+		payload = string(j.Payload)
+		return nil, nil
+	}))
+
+	j := &workq.LeasedJob{Name: "signup", Payload: []byte(`{"version":1,"data":{"name":"Ada"}}`)}
+	if _, err := h.Handle(context.Background(), j); err != nil || payload != `{"given":"Ada","last":""}` {
+		t.Fatalf("Handle mismatch, payload=%s, err=%v", payload, err)
+	}
+
+	j.Payload = []byte("not an envelope")
+	if _, err := h.Handle(context.Background(), j); err == nil {
+		t.Fatalf("Expected invalid envelope error")
+	}
+}
@@ -0,0 +1,241 @@
+// Package workqoutbox implements the transactional outbox pattern for Workq.
+//
+// Jobs are written to an outbox table inside the caller's database
+// transaction and relayed to Workq after commit, so a job is enqueued if and
+// only if the transaction that produced it commits.
+//
+// The outbox table is expected to have the following columns, with types
+// adapted to the database:
+//
+//	CREATE TABLE workq_outbox (
+//		id           CHAR(36) PRIMARY KEY,
+//		name         VARCHAR(128) NOT NULL,
+//		ttr          INTEGER NOT NULL,
+//		ttl          INTEGER NOT NULL,
+//		payload      BLOB NOT NULL,
+//		priority     INTEGER NOT NULL,
+//		max_attempts INTEGER NOT NULL,
+//		max_fails    INTEGER NOT NULL,
+//		created      BIGINT NOT NULL
+//	)
+package workqoutbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/satori/go.uuid"
+)
+
+// Max payload size accepted by the server.
+const maxPayload = 1048576
+
+const columns = "id, name, ttr, ttl, payload, priority, max_attempts, max_fails, created"
+
+// Config configures an Outbox.
+type Config struct {
+	Table string // Outbox table name, defaults to "workq_outbox".
+
+	// Returns the n-th bind parameter of a query starting at 1, defaults to
+	// "?". Use Dollar for PostgreSQL.
+	Placeholder func(n int) string
+
+	// Max payload size accepted by Add, defaults to the 1 MiB accepted by the
+	// server. Match WithMaxPayloadSize of the relaying client.
+	MaxPayloadSize int
+
+	Interval time.Duration // Relay poll interval once drained, defaults to 1s.
+	Logger   workq.Logger  // Logs relay failures, nil to discard.
+	Clock    workq.Clock   // Clock of polling & row timestamps, defaults to workq.SystemClock.
+}
+
+// Dollar returns PostgreSQL style bind parameters, e.g. "$1".
+func Dollar(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// Outbox writes jobs to an outbox table and relays them to Workq.
+type Outbox struct {
+	db     *sql.DB
+	config Config
+
+	insertQuery string
+	nextQuery   string
+	deleteQuery string
+}
+
+// New returns an Outbox stored in db.
+func New(db *sql.DB, config Config) *Outbox {
+	if config.Table == "" {
+		config.Table = "workq_outbox"
+	}
+	if config.Placeholder == nil {
+		config.Placeholder = func(n int) string { return "?" }
+	}
+	if config.MaxPayloadSize <= 0 {
+		config.MaxPayloadSize = maxPayload
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = workq.SystemClock
+	}
+
+	params := make([]string, 9)
+	for i := range params {
+		params[i] = config.Placeholder(i + 1)
+	}
+
+	return &Outbox{
+		db:     db,
+		config: config,
+		insertQuery: fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES (%s)",
+			config.Table,
+			columns,
+			strings.Join(params, ", "),
+		),
+		nextQuery: fmt.Sprintf(
+			"SELECT %s FROM %s ORDER BY created, id LIMIT 1",
+			columns,
+			config.Table,
+		),
+		deleteQuery: fmt.Sprintf(
+			"DELETE FROM %s WHERE id = %s",
+			config.Table,
+			config.Placeholder(1),
+		),
+	}
+}
+
+// Add writes j to the outbox within tx, setting j.ID from j.UUID or a
+// generated ID when empty.
+// Invalid IDs and names and oversized payloads are rejected up front rather
+// than on relay. The job is relayed once tx commits.
+func (o *Outbox) Add(tx *sql.Tx, j *workq.BgJob) error {
+	if err := workq.ValidateName(j.Name); err != nil {
+		return err
+	}
+	if len(j.Payload) > o.config.MaxPayloadSize {
+		return workq.ErrPayloadTooLarge
+	}
+	if j.ID == "" && !j.UUID.IsZero() {
+		j.ID = j.UUID.String()
+	} else if j.ID == "" {
+		j.ID = uuid.NewV4().String()
+	} else if err := workq.ValidateID(j.ID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		o.insertQuery,
+		j.ID,
+		j.Name,
+		j.TTR,
+		j.TTL,
+		j.Payload,
+		j.Priority,
+		j.MaxAttempts,
+		j.MaxFails,
+		o.config.Clock.Now().UnixNano(),
+	)
+	return err
+}
+
+// Relay adds outbox jobs to Workq through c in the order written until ctx
+// is cancelled, polling every interval once the outbox is drained.
+//
+// Each job is added and its row deleted in a single transaction, keeping its
+// outbox ID, so a job relayed again after a failure between the two carries
+// the ID of the original for the server to refuse as a duplicate, which
+// counts as relayed. Jobs failing permanently, e.g. rejected with other
+// CLIENT-ERRORs or by the client before sending, are logged and removed.
+// Retryable failures and connections out of sync are retried after the poll
+// interval.
+//
+// A single relay should run per outbox table. Use a Client created
+// WithReconnect so relaying resumes after network errors.
+func (o *Outbox) Relay(ctx context.Context, c *workq.Client) error {
+	for {
+		relayed, err := o.relayNext(ctx, c)
+		if err != nil && ctx.Err() == nil {
+			o.logf("workq: outbox relay failed: %s", err)
+		}
+		if relayed && err == nil {
+			continue
+		}
+
+		timer := o.config.Clock.NewTimer(o.config.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// Relay the oldest outbox job, returning false when the outbox is empty.
+func (o *Outbox) relayNext(ctx context.Context, c *workq.Client) (bool, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var j workq.BgJob
+	var created int64
+	err = tx.QueryRowContext(ctx, o.nextQuery).Scan(
+		&j.ID,
+		&j.Name,
+		&j.TTR,
+		&j.TTL,
+		&j.Payload,
+		&j.Priority,
+		&j.MaxAttempts,
+		&j.MaxFails,
+		&created,
+	)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := c.Add(&j); err != nil && !workq.IsDuplicate(err) {
+		if !permanent(err) {
+			return false, err
+		}
+
+		o.logf("workq: outbox job id=%s rejected: %s", j.ID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, o.deleteQuery, j.ID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Whether adding a job failed for the job itself rather than the connection,
+// failing again on every retry.
+func permanent(err error) bool {
+	if err == workq.ErrPoisoned || err == workq.ErrMalformed {
+		return false
+	}
+
+	return !workq.IsRetryable(err)
+}
+
+func (o *Outbox) logf(format string, v ...interface{}) {
+	if o.config.Logger != nil {
+		o.config.Logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,388 @@
+package workqoutbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+// In-memory outbox table behind a minimal database/sql driver, understanding
+// only the queries issued by Outbox. Writes are applied on commit.
+type testDB struct {
+	mu      sync.Mutex
+	rows    map[string][]driver.Value
+	queries []string
+}
+
+var testDBs = struct {
+	sync.Mutex
+	m map[string]*testDB
+}{m: make(map[string]*testDB)}
+
+func init() {
+	sql.Register("workqoutboxtest", testDriver{})
+}
+
+func openTestDB(t *testing.T) (*sql.DB, *testDB) {
+	tdb := &testDB{rows: make(map[string][]driver.Value)}
+	testDBs.Lock()
+	testDBs.m[t.Name()] = tdb
+	testDBs.Unlock()
+
+	db, err := sql.Open("workqoutboxtest", t.Name())
+	if err != nil {
+		t.Fatalf("Open error, err=%s", err)
+	}
+
+	return db, tdb
+}
+
+func (db *testDB) ids() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var ids []string
+	for id := range db.rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) {
+	testDBs.Lock()
+	defer testDBs.Unlock()
+	return &testConn{db: testDBs.m[name]}, nil
+}
+
+type testConn struct {
+	db      *testDB
+	pending []func()
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	c.db.queries = append(c.db.queries, query)
+	c.db.mu.Unlock()
+	return &testStmt{c: c, query: query}, nil
+}
+
+func (c *testConn) Close() error { return nil }
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	c.pending = nil
+	return c, nil
+}
+
+func (c *testConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, fn := range c.pending {
+		fn()
+	}
+	c.pending = nil
+	return nil
+}
+
+func (c *testConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+type testStmt struct {
+	c     *testConn
+	query string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.c.db
+	switch {
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.c.pending = append(s.c.pending, func() {
+			db.rows[args[0].(string)] = args
+		})
+	case strings.HasPrefix(s.query, "DELETE"):
+		s.c.pending = append(s.c.pending, func() {
+			delete(db.rows, args[0].(string))
+		})
+	default:
+		return nil, errors.New("unexpected exec")
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var oldest []driver.Value
+	for _, row := range db.rows {
+		if oldest == nil || row[8].(int64) < oldest[8].(int64) ||
+			(row[8] == oldest[8] && row[0].(string) < oldest[0].(string)) {
+			oldest = row
+		}
+	}
+
+	return &testRows{row: oldest}, nil
+}
+
+type testRows struct {
+	row []driver.Value
+}
+
+func (r *testRows) Columns() []string {
+	return strings.Split(columns, ", ")
+}
+
+func (r *testRows) Close() error { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.row == nil {
+		return io.EOF
+	}
+
+	copy(dest, r.row)
+	r.row = nil
+	return nil
+}
+
+const (
+	id1 = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	id2 = "6ba7b811-9dad-11d1-80b4-00c04fd430c4"
+)
+
+func TestAdd(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	now := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	o := New(db, Config{Table: "jobs", Placeholder: Dollar, Clock: workqtest.NewFakeClock(now)})
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin error, err=%s", err)
+	}
+
+	j := &workq.BgJob{Name: "j1", TTR: 1, TTL: 2, Payload: []byte("a"), Priority: 3, MaxAttempts: 4, MaxFails: 5}
+	if err := o.Add(tx, j); err != nil {
+		t.Fatalf("Add error, err=%s", err)
+	}
+	if len(j.ID) != 36 {
+		t.Fatalf("Expected generated ID, id=%q", j.ID)
+	}
+	if len(tdb.ids()) != 0 {
+		t.Fatalf("Expected no rows before commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit error, err=%s", err)
+	}
+
+	expQuery := "INSERT INTO jobs (" + columns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	if tdb.queries[0] != expQuery {
+		t.Fatalf("Query mismatch, query=%q", tdb.queries[0])
+	}
+
+	row := tdb.rows[j.ID]
+	if row[1] != "j1" || row[2] != int64(1) || row[3] != int64(2) || string(row[4].([]byte)) != "a" ||
+		row[5] != int64(3) || row[6] != int64(4) || row[7] != int64(5) || row[8] != now.UnixNano() {
+		t.Fatalf("Row mismatch, row=%v", row)
+	}
+}
+
+func TestAddRollback(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	o := New(db, Config{})
+
+	tx, _ := db.Begin()
+	if err := o.Add(tx, &workq.BgJob{ID: id1, Name: "j1"}); err != nil {
+		t.Fatalf("Add error, err=%s", err)
+	}
+	tx.Rollback()
+
+	if len(tdb.ids()) != 0 {
+		t.Fatalf("Expected no rows, ids=%v", tdb.ids())
+	}
+}
+
+func TestAddInvalidName(t *testing.T) {
+	db, _ := openTestDB(t)
+	defer db.Close()
+	o := New(db, Config{})
+
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	if err := o.Add(tx, &workq.BgJob{Name: "a b"}); err != workq.ErrInvalidName {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if err := o.Add(tx, &workq.BgJob{ID: "a", Name: "j1"}); err != workq.ErrInvalidID {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestAddPayloadTooLarge(t *testing.T) {
+	db, _ := openTestDB(t)
+	defer db.Close()
+
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	j := &workq.BgJob{Name: "j1", Payload: make([]byte, maxPayload+1)}
+	if err := New(db, Config{}).Add(tx, j); err != workq.ErrPayloadTooLarge {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+
+	j = &workq.BgJob{Name: "j1", Payload: []byte("ab")}
+	if err := New(db, Config{MaxPayloadSize: 1}).Add(tx, j); err != workq.ErrPayloadTooLarge {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	clock := workqtest.NewFakeClock(time.Now())
+	o := New(db, Config{Interval: time.Second, Clock: clock})
+
+	tx, _ := db.Begin()
+	o.Add(tx, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 2, Payload: []byte("a")})
+	o.Add(tx, &workq.BgJob{ID: id2, Name: "j2", TTR: 1, TTL: 2, Payload: []byte("b")})
+	tx.Commit()
+
+	var mu sync.Mutex
+	var added []string
+	var failed bool
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Args[0] == id2 && !failed {
+			failed = true
+			return workqtest.Error("SERVER-ERROR", "")
+		}
+
+		added = append(added, r.Args[0]+" "+r.Args[1]+" "+string(r.Data))
+		return workqtest.OK()
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- o.Relay(ctx, c)
+	}()
+
+	// Retried after the poll interval, then polling the drained outbox.
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Relay error, err=%s", err)
+	}
+	if len(tdb.ids()) != 0 {
+		t.Fatalf("Expected drained outbox, ids=%v", tdb.ids())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	exp := []string{id1 + " j1 a", id2 + " j2 b"}
+	if len(added) != 2 || added[0] != exp[0] || added[1] != exp[1] {
+		t.Fatalf("Added mismatch, added=%q", added)
+	}
+}
+
+func TestRelayRemovesRejectedJobs(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	var logs bytes.Buffer
+	o := New(db, Config{Logger: log.New(&logs, "", 0)})
+
+	tx, _ := db.Begin()
+	o.Add(tx, &workq.BgJob{ID: id1, Name: "j1"})
+	o.Add(tx, &workq.BgJob{ID: id2, Name: "j1"})
+	tx.Commit()
+
+	c := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		if r.Args[0] == id1 {
+			return workqtest.Error("CLIENT-ERROR", "Duplicate job ID")
+		}
+		return workqtest.Error("CLIENT-ERROR", "Invalid job")
+	})
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		relayed, err := o.relayNext(context.Background(), c)
+		if !relayed || err != nil {
+			t.Fatalf("Relay mismatch, relayed=%t, err=%v", relayed, err)
+		}
+	}
+	if len(tdb.ids()) != 0 {
+		t.Fatalf("Expected rejected jobs removed, ids=%v", tdb.ids())
+	}
+
+	relayed, err := o.relayNext(context.Background(), c)
+	if relayed || err != nil {
+		t.Fatalf("Expected drained outbox, relayed=%t, err=%v", relayed, err)
+	}
+
+	// Duplicates were relayed before, only the invalid job is logged.
+	exp := "workq: outbox job id=" + id2 + " rejected: add " + id2 + ": CLIENT-ERROR Invalid job\n"
+	if logs.String() != exp {
+		t.Fatalf("Log mismatch, act=%q", logs.String())
+	}
+}
+
+func TestRelayRemovesJobsFailingPermanently(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	o := New(db, Config{})
+
+	tx, _ := db.Begin()
+	o.Add(tx, &workq.BgJob{ID: id1, Name: "j1", Payload: []byte("ab")})
+	tx.Commit()
+
+	conn := workqtest.NewScriptedConn()
+	c := workq.NewClient(conn, workq.WithMaxPayloadSize(1))
+	defer c.Close()
+
+	relayed, err := o.relayNext(context.Background(), c)
+	if !relayed || err != nil || len(tdb.ids()) != 0 || len(conn.Written()) != 0 {
+		t.Fatalf("Relay mismatch, relayed=%t, err=%v, ids=%v", relayed, err, tdb.ids())
+	}
+}
+
+func TestRelayKeepsJobsOnDesync(t *testing.T) {
+	db, tdb := openTestDB(t)
+	defer db.Close()
+	o := New(db, Config{})
+
+	tx, _ := db.Begin()
+	o.Add(tx, &workq.BgJob{ID: id1, Name: "j1"})
+	tx.Commit()
+
+	c := workq.NewClient(workqtest.NewScriptedConn().Reply([]byte("+BAD\r\n")))
+	defer c.Close()
+
+	for _, expErr := range []error{workq.ErrMalformed, workq.ErrPoisoned} {
+		relayed, err := o.relayNext(context.Background(), c)
+		if relayed || err != expErr || len(tdb.ids()) != 1 {
+			t.Fatalf("Relay mismatch, relayed=%t, err=%v, ids=%v", relayed, err, tdb.ids())
+		}
+	}
+}
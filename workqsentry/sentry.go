@@ -0,0 +1,154 @@
+// Package workqsentry reports Workq client and worker failures to Sentry.
+//
+// Reporter implements workq.ErrorReporter over the Sentry HTTP store API
+// without depending on a Sentry SDK:
+//
+//	r, err := workqsentry.New(os.Getenv("SENTRY_DSN"))
+//	...
+//	client, err := workq.Connect(addr, workq.WithErrorReporter(r))
+//	w := worker.New(pool, h, worker.Config{Names: names, Reporter: r})
+package workqsentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Max reports being sent at once, further reports are dropped rather than
+// piling up while Sentry is slow or unreachable.
+const maxPending = 16
+
+var (
+	// ErrInvalidDSN is returned by New for a DSN without key or project.
+	ErrInvalidDSN = errors.New("Invalid DSN")
+)
+
+// Reporter sends each report as a Sentry event in the background.
+type Reporter struct {
+	Environment string       // Sent as the event environment, optional.
+	Client      *http.Client // Defaults to a client with a 10s timeout.
+
+	endpoint string
+	auth     string
+	pending  chan struct{}
+}
+
+// New returns a Reporter for a Sentry DSN, e.g.
+// "https://<key>@sentry.example.com/<project>".
+func New(dsn string) (*Reporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	project := path.Base(u.Path)
+	if u.User == nil || u.User.Username() == "" || project == "/" || project == "." {
+		return nil, ErrInvalidDSN
+	}
+
+	endpoint := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   path.Join(path.Dir(u.Path), "api", project, "store") + "/",
+	}
+
+	return &Reporter{
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: endpoint.String(),
+		auth: fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=go-workq/1.0, sentry_key=%s",
+			u.User.Username(),
+		),
+		pending: make(chan struct{}, maxPending),
+	}, nil
+}
+
+type exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+// Report sends err with tags as an error event without blocking the caller.
+// Delivery failures are dropped.
+func (r *Reporter) Report(err error, tags map[string]string) {
+	select {
+	case r.pending <- struct{}{}:
+	default:
+		return
+	}
+
+	e := &event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format("2006-01-02T15:04:05"),
+		Level:       "error",
+		Logger:      "workq",
+		Platform:    "go",
+		Message:     err.Error(),
+		Environment: r.Environment,
+		Tags:        tags,
+	}
+	e.Exception.Values = []exception{{
+		Type:  strings.TrimPrefix(fmt.Sprintf("%T", err), "*"),
+		Value: err.Error(),
+	}}
+
+	go func() {
+		defer func() { <-r.pending }()
+		r.send(e)
+	}()
+}
+
+func (r *Reporter) send(e *event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("workqsentry: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Random 32 hex character event ID.
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
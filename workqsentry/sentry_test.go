@@ -0,0 +1,114 @@
+package workqsentry
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		dsn         string
+		expEndpoint string
+		expErr      error
+	}{
+		{"https://abc@sentry.example.com/42", "https://sentry.example.com/api/42/store/", nil},
+		{"https://abc@sentry.example.com/prefix/42", "https://sentry.example.com/prefix/api/42/store/", nil},
+		{"https://sentry.example.com/42", "", ErrInvalidDSN},
+		{"https://abc@sentry.example.com/", "", ErrInvalidDSN},
+	}
+
+	for _, tt := range tests {
+		r, err := New(tt.dsn)
+		if err != tt.expErr {
+			t.Fatalf("Error mismatch, dsn=%s, err=%v", tt.dsn, err)
+		}
+		if err == nil && r.endpoint != tt.expEndpoint {
+			t.Fatalf("Endpoint mismatch, dsn=%s, endpoint=%s", tt.dsn, r.endpoint)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	type received struct {
+		path string
+		auth string
+		body map[string]interface{}
+	}
+	recv := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		var body map[string]interface{}
+		json.Unmarshal(b, &body)
+		recv <- received{req.URL.Path, req.Header.Get("X-Sentry-Auth"), body}
+	}))
+	defer server.Close()
+
+	r, err := New(strings.Replace(server.URL, "http://", "http://key@", 1) + "/7")
+	if err != nil {
+		t.Fatalf("New error, err=%s", err)
+	}
+	r.Environment = "staging"
+
+	var reporter workq.ErrorReporter = r
+	reporter.Report(workq.NewResponseError("SERVER-ERROR", "Disk full"), map[string]string{"job_id": "a"})
+
+	var got received
+	select {
+	case got = <-recv:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for report")
+	}
+
+	if got.path != "/api/7/store/" || got.auth != "Sentry sentry_version=7, sentry_client=go-workq/1.0, sentry_key=key" {
+		t.Fatalf("Request mismatch, path=%s, auth=%s", got.path, got.auth)
+	}
+
+	if len(got.body["event_id"].(string)) != 32 {
+		t.Fatalf("Event ID mismatch, body=%v", got.body)
+	}
+	exp := map[string]interface{}{
+		"level":       "error",
+		"logger":      "workq",
+		"platform":    "go",
+		"message":     "SERVER-ERROR Disk full",
+		"environment": "staging",
+		"tags":        map[string]interface{}{"job_id": "a"},
+		"exception": map[string]interface{}{
+			"values": []interface{}{
+				map[string]interface{}{"type": "workq.ResponseError", "value": "SERVER-ERROR Disk full"},
+			},
+		},
+	}
+	for k, v := range exp {
+		if !reflect.DeepEqual(v, got.body[k]) {
+			t.Fatalf("Body mismatch, key=%s, act=%v", k, got.body[k])
+		}
+	}
+}
+
+func TestReportDropsWhenBusy(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	r, _ := New(strings.Replace(server.URL, "http://", "http://key@", 1) + "/7")
+	for i := 0; i < maxPending+5; i++ {
+		r.Report(errors.New("a"), nil)
+	}
+
+	if len(r.pending) != maxPending {
+		t.Fatalf("Pending mismatch, pending=%d", len(r.pending))
+	}
+}
@@ -0,0 +1,244 @@
+package workqspool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// ErrBufferFull is returned by a Buffer with OverflowError when full.
+var ErrBufferFull = errors.New("Buffer full")
+
+// Overflow decides what a full Buffer does with another job.
+type Overflow int
+
+const (
+	// OverflowBlock blocks until Replay makes room, the default.
+	OverflowBlock Overflow = iota
+
+	// OverflowDropOldest drops the oldest buffered job to make room.
+	OverflowDropOldest
+
+	// OverflowError returns ErrBufferFull.
+	OverflowError
+)
+
+// BufferConfig configures a Buffer.
+type BufferConfig struct {
+	Size     int           // Max jobs buffered, defaults to 1000.
+	Overflow Overflow      // Defaults to OverflowBlock.
+	Interval time.Duration // Replay poll interval, defaults to 1s.
+	Logger   workq.Logger  // Logs replay failures, nil to discard.
+	Clock    workq.Clock   // Clock of replay polling, defaults to workq.SystemClock.
+}
+
+// BufferStats are counters of a Buffer since created.
+type BufferStats struct {
+	Buffered int   // Jobs currently buffered.
+	Flushed  int64 // Jobs sent by Replay.
+	Dropped  int64 // Jobs dropped by OverflowDropOldest or rejected on replay.
+	Rejected int64 // Jobs refused with ErrBufferFull.
+}
+
+// Buffer adds and schedules jobs through a Client, queueing them in memory
+// instead while the server is unreachable. Safe for concurrent use.
+type Buffer struct {
+	config BufferConfig
+
+	mu    sync.Mutex
+	room  chan struct{} // Closed & replaced when jobs are flushed.
+	jobs  []*record
+	stats BufferStats
+}
+
+// NewBuffer returns an empty Buffer.
+func NewBuffer(config BufferConfig) *Buffer {
+	if config.Size <= 0 {
+		config.Size = 1000
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = workq.SystemClock
+	}
+
+	return &Buffer{config: config, room: make(chan struct{})}
+}
+
+// Add adds j through c, or buffers it when the server is unreachable or
+// earlier jobs are still buffered, keeping jobs in order. Buffered jobs
+// return nil. A full buffer is handled by the Overflow policy, with
+// OverflowBlock waiting for room until ctx is done.
+//
+// Jobs require an ID, set from j.UUID when empty, as with Spool.Add.
+func (b *Buffer) Add(ctx context.Context, c *workq.Client, j *workq.BgJob) error {
+	if j.ID == "" && !j.UUID.IsZero() {
+		j.ID = j.UUID.String()
+	}
+
+	return b.send(ctx, c, &record{
+		Command:     "add",
+		ID:          j.ID,
+		Name:        j.Name,
+		TTR:         j.TTR,
+		TTL:         j.TTL,
+		Payload:     j.Payload,
+		Priority:    j.Priority,
+		MaxAttempts: j.MaxAttempts,
+		MaxFails:    j.MaxFails,
+	})
+}
+
+// Schedule schedules j through c, buffering it as Add does.
+func (b *Buffer) Schedule(ctx context.Context, c *workq.Client, j *workq.ScheduledJob) error {
+	if j.ID == "" && !j.UUID.IsZero() {
+		j.ID = j.UUID.String()
+	}
+
+	return b.send(ctx, c, &record{
+		Command:     "schedule",
+		ID:          j.ID,
+		Name:        j.Name,
+		TTR:         j.TTR,
+		TTL:         j.TTL,
+		Time:        scheduleTime(j),
+		Payload:     j.Payload,
+		Priority:    j.Priority,
+		MaxAttempts: j.MaxAttempts,
+		MaxFails:    j.MaxFails,
+	})
+}
+
+// Send r directly while nothing is buffered, buffering it otherwise. The lock
+// is not held while sending, so Replay and other callers are not held up by
+// a slow server.
+func (b *Buffer) send(ctx context.Context, c *workq.Client, r *record) error {
+	if err := workq.ValidateName(r.Name); err != nil {
+		return err
+	}
+	if err := workq.ValidateID(r.ID); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	direct := len(b.jobs) == 0
+	b.mu.Unlock()
+	if direct {
+		err := exec(c, r)
+		if !unreachable(err) {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.jobs) >= b.config.Size {
+		switch b.config.Overflow {
+		case OverflowDropOldest:
+			b.logf("workq: buffer full, job id=%s dropped", b.jobs[0].ID)
+			b.jobs = b.jobs[1:]
+			b.stats.Dropped++
+		case OverflowError:
+			b.stats.Rejected++
+			return ErrBufferFull
+		default:
+			room := b.room
+			b.mu.Unlock()
+			select {
+			case <-room:
+			case <-ctx.Done():
+				b.mu.Lock()
+				return ctx.Err()
+			}
+			b.mu.Lock()
+		}
+	}
+
+	b.jobs = append(b.jobs, r)
+	return nil
+}
+
+// Len returns the number of jobs buffered.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.jobs)
+}
+
+// Stats returns the buffer counters.
+func (b *Buffer) Stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats
+	s.Buffered = len(b.jobs)
+	return s
+}
+
+// Replay flushes buffered jobs through c in the order buffered until ctx is
+// cancelled, polling every interval while the buffer is empty or the server
+// unreachable. Jobs refused as duplicates were added before and count as
+// flushed, jobs rejected with other CLIENT-ERRORs are logged and dropped.
+//
+// A single replay should run per buffer. Use a Client created WithReconnect
+// so flushing resumes after network errors.
+func (b *Buffer) Replay(ctx context.Context, c *workq.Client) error {
+	for {
+		if err := b.flush(c); err != nil && ctx.Err() == nil {
+			b.logf("workq: buffer flush failed: %s", err)
+		}
+
+		timer := b.config.Clock.NewTimer(b.config.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// Flush buffered jobs until drained or a job fails.
+func (b *Buffer) flush(c *workq.Client) error {
+	for {
+		b.mu.Lock()
+		if len(b.jobs) == 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		r := b.jobs[0]
+		b.mu.Unlock()
+
+		err := exec(c, r)
+		if workq.IsDuplicate(err) {
+			err = nil
+		}
+		if err != nil && !workq.IsClientError(err) {
+			return err
+		}
+
+		b.mu.Lock()
+		if err != nil {
+			b.logf("workq: buffer job id=%s rejected: %s", r.ID, err)
+			b.stats.Dropped++
+		} else {
+			b.stats.Flushed++
+		}
+		// The job may have been dropped while in flight.
+		if len(b.jobs) > 0 && b.jobs[0] == r {
+			b.jobs = b.jobs[1:]
+		}
+		close(b.room)
+		b.room = make(chan struct{})
+		b.mu.Unlock()
+	}
+}
+
+func (b *Buffer) logf(format string, v ...interface{}) {
+	if b.config.Logger != nil {
+		b.config.Logger.Printf(format, v...)
+	}
+}
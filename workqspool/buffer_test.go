@@ -0,0 +1,157 @@
+package workqspool
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+func TestBufferWhileUnreachable(t *testing.T) {
+	clock := workqtest.NewFakeClock(time.Now())
+	b := NewBuffer(BufferConfig{Clock: clock})
+	server := &testServer{down: true, reject: id2, duplicate: id3}
+	down := workqtest.PipeClient(server.handle)
+	for _, id := range []string{id1, id2} {
+		if err := b.Add(context.Background(), down, &workq.BgJob{ID: id, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("a")}); err != nil {
+			t.Fatalf("Add mismatch, err=%s", err)
+		}
+	}
+
+	server.mu.Lock()
+	server.down = false
+	server.mu.Unlock()
+	up := workqtest.PipeClient(server.handle)
+	if err := b.Schedule(context.Background(), up, &workq.ScheduledJob{ID: id3, Name: "j1", TTR: 1, TTL: 1, Time: "2016-01-01T00:00:00Z", Payload: []byte("b")}); err != nil {
+		t.Fatalf("Schedule mismatch, err=%s", err)
+	}
+	if b.Len() != 3 {
+		t.Fatalf("Expected jobs buffered, len=%d", b.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Replay(ctx, up)
+		close(done)
+	}()
+
+	// Drained by the first flush, then polling.
+	clock.BlockUntil(1)
+	cancel()
+	<-done
+
+	exp := []string{"add " + id1 + " a"}
+	if act := server.received(); !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Flush mismatch, act=%q", act)
+	}
+	if s := b.Stats(); s != (BufferStats{Flushed: 2, Dropped: 1}) {
+		t.Fatalf("Stats mismatch, stats=%+v", s)
+	}
+}
+
+func TestBufferOverflow(t *testing.T) {
+	down := workqtest.PipeClient((&testServer{down: true}).handle)
+	j := func(id string) *workq.BgJob {
+		return &workq.BgJob{ID: id, Name: "j1", TTR: 1, TTL: 1}
+	}
+
+	b := NewBuffer(BufferConfig{Size: 1, Overflow: OverflowError})
+	b.Add(context.Background(), down, j(id1))
+	if err := b.Add(context.Background(), down, j(id2)); err != ErrBufferFull {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if s := b.Stats(); s != (BufferStats{Buffered: 1, Rejected: 1}) {
+		t.Fatalf("Stats mismatch, stats=%+v", s)
+	}
+
+	b = NewBuffer(BufferConfig{Size: 1, Overflow: OverflowDropOldest})
+	b.Add(context.Background(), down, j(id1))
+	if err := b.Add(context.Background(), down, j(id2)); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+	if b.jobs[0].ID != id2 || b.Stats() != (BufferStats{Buffered: 1, Dropped: 1}) {
+		t.Fatalf("Expected oldest dropped, jobs=%v, stats=%+v", b.jobs, b.Stats())
+	}
+}
+
+func TestBufferOverflowBlock(t *testing.T) {
+	server := &testServer{down: true}
+	down := workqtest.PipeClient(server.handle)
+	b := NewBuffer(BufferConfig{Size: 1})
+	b.Add(context.Background(), down, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1})
+
+	added := make(chan error)
+	go func() {
+		added <- b.Add(context.Background(), down, &workq.BgJob{ID: id2, Name: "j1", TTR: 1, TTL: 1})
+	}()
+
+	select {
+	case err := <-added:
+		t.Fatalf("Expected Add blocked, err=%v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	server.mu.Lock()
+	server.down = false
+	server.mu.Unlock()
+	if err := b.flush(workqtest.PipeClient(server.handle)); err != nil {
+		t.Fatalf("Flush mismatch, err=%s", err)
+	}
+	if err := <-added; err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+	if act := server.received(); len(act) == 0 || act[0] != "add "+id1+" " {
+		t.Fatalf("Flush mismatch, act=%q", act)
+	}
+}
+
+func TestBufferOverflowBlockCanceled(t *testing.T) {
+	down := workqtest.PipeClient((&testServer{down: true}).handle)
+	b := NewBuffer(BufferConfig{Size: 1})
+	b.Add(context.Background(), down, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Add(ctx, down, &workq.BgJob{ID: id2, Name: "j1", TTR: 1, TTL: 1}); err != context.DeadlineExceeded {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if b.Len() != 1 {
+		t.Fatalf("Expected job not buffered, len=%d", b.Len())
+	}
+}
+
+func TestBufferSendUnlocked(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	slow := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		close(received)
+		<-release
+		return workqtest.OK()
+	})
+
+	b := NewBuffer(BufferConfig{})
+	added := make(chan error)
+	go func() {
+		added <- b.Add(context.Background(), slow, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1})
+	}()
+
+	<-received
+	stats := make(chan BufferStats)
+	go func() {
+		stats <- b.Stats()
+	}()
+	select {
+	case <-stats:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected buffer unlocked while sending")
+	}
+
+	close(release)
+	if err := <-added; err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+}
@@ -0,0 +1,344 @@
+// Package workqspool spools jobs to a local append-only file while Workq is
+// unreachable and replays them in order once it is back, so producers survive
+// queue outages without dropping work.
+//
+// Each spooled job is a line of JSON, so a spool file can be inspected and
+// repaired with standard tools.
+//
+// Buffer is a bounded in-memory alternative for riding out brief
+// disconnects, losing buffered jobs if the process exits.
+package workqspool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Config configures a Spool.
+type Config struct {
+	Interval time.Duration // Replay poll interval, defaults to 1s.
+	Logger   workq.Logger  // Logs replay failures, nil to discard.
+	Clock    workq.Clock   // Clock of replay polling, defaults to workq.SystemClock.
+}
+
+// Spooled "add" or "schedule" command.
+type record struct {
+	Command     string `json:"command"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	TTR         int    `json:"ttr"`
+	TTL         int    `json:"ttl"`
+	Time        string `json:"time,omitempty"`
+	Payload     []byte `json:"payload"`
+	Priority    int    `json:"priority,omitempty"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+	MaxFails    int    `json:"max_fails,omitempty"`
+}
+
+// Spool adds and schedules jobs through a Client, appending them to a spool
+// file instead while the server is unreachable. Safe for concurrent use.
+type Spool struct {
+	path   string
+	config Config
+
+	mu      sync.Mutex
+	f       *os.File
+	offset  int64 // Start of the first record not yet replayed.
+	pending int   // Records not yet replayed.
+}
+
+// Open opens the spool file at path, creating it if missing. Jobs left over
+// from a previous process are replayed by Replay.
+func Open(path string, config Config) (*Spool, error) {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = workq.SystemClock
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{path: path, config: config, f: f}
+	if err := s.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Count complete records, truncating a trailing record cut short by a crash.
+func (s *Spool) recover() error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var size int64
+	rdr := bufio.NewReader(s.f)
+	for {
+		line, err := rdr.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return s.f.Truncate(size)
+			}
+
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		size += int64(len(line))
+		s.pending++
+	}
+}
+
+// Add adds j through c, or appends it to the spool when the server is
+// unreachable or earlier jobs are still spooled, keeping jobs in order.
+// Spooled jobs return nil.
+//
+// j.ID is set from j.UUID when empty. Jobs without either are rejected with
+// workq.ErrInvalidID, so a job replayed after an add whose response was lost
+// carries the ID of the original for the server to refuse as a duplicate.
+func (s *Spool) Add(c *workq.Client, j *workq.BgJob) error {
+	if j.ID == "" && !j.UUID.IsZero() {
+		j.ID = j.UUID.String()
+	}
+
+	return s.send(c, &record{
+		Command:     "add",
+		ID:          j.ID,
+		Name:        j.Name,
+		TTR:         j.TTR,
+		TTL:         j.TTL,
+		Payload:     j.Payload,
+		Priority:    j.Priority,
+		MaxAttempts: j.MaxAttempts,
+		MaxFails:    j.MaxFails,
+	})
+}
+
+// Schedule schedules j through c, spooling it as Add does.
+func (s *Spool) Schedule(c *workq.Client, j *workq.ScheduledJob) error {
+	if j.ID == "" && !j.UUID.IsZero() {
+		j.ID = j.UUID.String()
+	}
+
+	return s.send(c, &record{
+		Command:     "schedule",
+		ID:          j.ID,
+		Name:        j.Name,
+		TTR:         j.TTR,
+		TTL:         j.TTL,
+		Time:        scheduleTime(j),
+		Payload:     j.Payload,
+		Priority:    j.Priority,
+		MaxAttempts: j.MaxAttempts,
+		MaxFails:    j.MaxFails,
+	})
+}
+
+// Send r directly while nothing is spooled, spooling it otherwise. The lock is
+// not held while sending, so Replay and other callers are not held up by a
+// slow server.
+func (s *Spool) send(c *workq.Client, r *record) error {
+	if err := workq.ValidateName(r.Name); err != nil {
+		return err
+	}
+	if err := workq.ValidateID(r.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	direct := s.pending == 0
+	s.mu.Unlock()
+	if direct {
+		err := exec(c, r)
+		if !unreachable(err) {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(r)
+}
+
+// Append r to the spool file. Must be called with s.mu held.
+func (s *Spool) append(r *record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	s.pending++
+	return nil
+}
+
+// Len returns the number of jobs spooled and not yet replayed.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Replay sends spooled jobs through c in the order spooled until ctx is
+// cancelled, polling every interval while the spool is empty or the server
+// unreachable. The spool file is truncated once drained.
+//
+// Jobs refused as duplicates, added before a crash interrupted the replay,
+// are skipped. Jobs rejected with other CLIENT-ERRORs are logged and
+// dropped.
+//
+// A single replay should run per spool. Use a Client created WithReconnect
+// so replaying resumes after network errors.
+func (s *Spool) Replay(ctx context.Context, c *workq.Client) error {
+	for {
+		if err := s.replay(c); err != nil && ctx.Err() == nil {
+			s.logf("workq: spool replay failed: %s", err)
+		}
+
+		timer := s.config.Clock.NewTimer(s.config.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// Replay spooled jobs until drained or a job fails.
+func (s *Spool) replay(c *workq.Client) error {
+	s.mu.Lock()
+	offset := s.offset
+	s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	rdr := bufio.NewReader(f)
+	for {
+		line, err := rdr.ReadBytes('\n')
+		if err == io.EOF {
+			// Drained, or a record is still being appended.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var r record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &r); err != nil {
+			s.logf("workq: spool record at offset %d dropped: %s", offset, err)
+		} else if err := exec(c, &r); err != nil && !workq.IsDuplicate(err) {
+			if !workq.IsClientError(err) {
+				return err
+			}
+
+			s.logf("workq: spool job id=%s rejected: %s", r.ID, err)
+		}
+
+		offset += int64(len(line))
+		if drained, err := s.advance(offset); drained || err != nil {
+			return err
+		}
+	}
+}
+
+// Mark the records before offset replayed, truncating the spool file once
+// drained.
+func (s *Spool) advance(offset int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+	s.pending--
+	if s.pending > 0 {
+		return false, nil
+	}
+
+	s.offset = 0
+	return true, s.f.Truncate(0)
+}
+
+// Close closes the spool file. Spooled jobs are kept for the next Open.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+func (s *Spool) logf(format string, v ...interface{}) {
+	if s.config.Logger != nil {
+		s.config.Logger.Printf(format, v...)
+	}
+}
+
+func exec(c *workq.Client, r *record) error {
+	if r.Command == "schedule" {
+		return c.Schedule(&workq.ScheduledJob{
+			ID:          r.ID,
+			Name:        r.Name,
+			TTR:         r.TTR,
+			TTL:         r.TTL,
+			Time:        r.Time,
+			Payload:     r.Payload,
+			Priority:    r.Priority,
+			MaxAttempts: r.MaxAttempts,
+			MaxFails:    r.MaxFails,
+		})
+	}
+
+	return c.Add(&workq.BgJob{
+		ID:          r.ID,
+		Name:        r.Name,
+		TTR:         r.TTR,
+		TTL:         r.TTL,
+		Payload:     r.Payload,
+		Priority:    r.Priority,
+		MaxAttempts: r.MaxAttempts,
+		MaxFails:    r.MaxFails,
+	})
+}
+
+// Start time of j to record, ScheduledJob.At with fractional seconds when
+// set, rounded by the replaying client.
+func scheduleTime(j *workq.ScheduledJob) string {
+	if j.Time == "" && !j.At.IsZero() {
+		return j.At.UTC().Format(time.RFC3339Nano)
+	}
+
+	return j.Time
+}
+
+// Whether err means the server could not be reached, rather than rejecting
+// the job.
+func unreachable(err error) bool {
+	if _, ok := err.(*workq.NetError); ok {
+		return true
+	}
+
+	return err == workq.ErrPoisoned
+}
@@ -0,0 +1,218 @@
+package workqspool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+const (
+	id1 = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+	id2 = "6ba7b811-9dad-11d1-80b4-00c04fd430c4"
+	id3 = "6ba7b812-9dad-11d1-80b4-00c04fd430c4"
+)
+
+// Records commands received, closing the connection while down.
+type testServer struct {
+	mu        sync.Mutex
+	down      bool
+	reject    string // ID to reject with CLIENT-ERROR.
+	duplicate string // ID to refuse as a duplicate.
+	commands  []string
+}
+
+func (s *testServer) handle(r *workqtest.Request) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return nil
+	}
+	switch r.Args[0] {
+	case s.reject:
+		return workqtest.Error("CLIENT-ERROR", "Invalid job")
+	case s.duplicate:
+		return workqtest.Error("CLIENT-ERROR", "Duplicate job ID")
+	}
+
+	s.commands = append(s.commands, r.Name+" "+r.Args[0]+" "+string(r.Data))
+	return workqtest.OK()
+}
+
+func (s *testServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func openSpool(t *testing.T) (*Spool, string) {
+	dir, err := ioutil.TempDir("", "workqspool")
+	if err != nil {
+		t.Fatalf("TempDir error, err=%s", err)
+	}
+
+	path := filepath.Join(dir, "spool")
+	s, err := Open(path, Config{Clock: workqtest.NewFakeClock(time.Now())})
+	if err != nil {
+		t.Fatalf("Open error, err=%s", err)
+	}
+
+	return s, path
+}
+
+func TestSpoolWhileUnreachable(t *testing.T) {
+	s, path := openSpool(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+
+	server := &testServer{down: true}
+	c := workqtest.PipeClient(server.handle)
+	if err := s.Add(c, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("a")}); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+	if err := s.Schedule(c, &workq.ScheduledJob{ID: id2, Name: "j1", TTR: 1, TTL: 1, Time: "2016-01-01T00:00:00Z", Payload: []byte("b")}); err != nil {
+		t.Fatalf("Schedule mismatch, err=%s", err)
+	}
+
+	// Later jobs are spooled behind earlier ones while the server is back.
+	server.mu.Lock()
+	server.down = false
+	server.mu.Unlock()
+	up := workqtest.PipeClient(server.handle)
+	if err := s.Add(up, &workq.BgJob{ID: id3, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("c")}); err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+	if s.Len() != 3 || len(server.received()) != 0 {
+		t.Fatalf("Expected jobs spooled, len=%d, received=%v", s.Len(), server.received())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, up)
+		close(done)
+	}()
+
+	// Drained by the first replay, then polling.
+	s.config.Clock.(*workqtest.FakeClock).BlockUntil(1)
+	cancel()
+	<-done
+
+	exp := []string{"add " + id1 + " a", "schedule " + id2 + " b", "add " + id3 + " c"}
+	if act := server.received(); !reflect.DeepEqual(exp, act) {
+		t.Fatalf("Replay mismatch, act=%q", act)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Fatalf("Expected truncated spool, fi=%v, err=%v", fi, err)
+	}
+
+	// Sent directly once drained.
+	if err := s.Add(up, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("d")}); err != nil || s.Len() != 0 {
+		t.Fatalf("Add mismatch, len=%d, err=%v", s.Len(), err)
+	}
+}
+
+func TestSpoolRecover(t *testing.T) {
+	s, path := openSpool(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c := workqtest.PipeClient((&testServer{down: true}).handle)
+	s.Add(c, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("a")})
+	s.Add(c, &workq.BgJob{ID: id2, Name: "j1", TTR: 1, TTL: 1, Payload: []byte("b")})
+	s.Close()
+
+	// Simulate a crash mid-append.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Open error, err=%s", err)
+	}
+	f.WriteString(`{"command":"add"`)
+	f.Close()
+
+	s, err = Open(path, Config{})
+	if err != nil {
+		t.Fatalf("Open error, err=%s", err)
+	}
+	defer s.Close()
+	if s.Len() != 2 {
+		t.Fatalf("Len mismatch, len=%d", s.Len())
+	}
+
+	server := &testServer{duplicate: id1}
+	if err := s.replay(workqtest.PipeClient(server.handle)); err != nil {
+		t.Fatalf("Replay mismatch, err=%s", err)
+	}
+	exp := []string{"add " + id2 + " b"}
+	if act := server.received(); !reflect.DeepEqual(exp, act) || s.Len() != 0 {
+		t.Fatalf("Replay mismatch, len=%d, act=%q", s.Len(), act)
+	}
+}
+
+func TestSpoolReplayUnreachable(t *testing.T) {
+	s, path := openSpool(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+
+	down := workqtest.PipeClient((&testServer{down: true}).handle)
+	s.Add(down, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1})
+	s.Add(down, &workq.BgJob{ID: id2, Name: "j1", TTR: 1, TTL: 1})
+	if err := s.replay(down); err != workq.ErrPoisoned || s.Len() != 2 {
+		t.Fatalf("Replay mismatch, len=%d, err=%v", s.Len(), err)
+	}
+}
+
+func TestSpoolRejectsInvalidJobs(t *testing.T) {
+	s, path := openSpool(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+
+	c := workqtest.PipeClient((&testServer{down: true}).handle)
+	if err := s.Add(c, &workq.BgJob{ID: "abc", Name: "j1"}); err != workq.ErrInvalidID {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+	if s.Len() != 0 {
+		t.Fatalf("Expected invalid job not spooled")
+	}
+}
+
+func TestSpoolSendUnlocked(t *testing.T) {
+	s, path := openSpool(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer s.Close()
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	slow := workqtest.PipeClient(func(r *workqtest.Request) []byte {
+		close(received)
+		<-release
+		return workqtest.OK()
+	})
+
+	added := make(chan error)
+	go func() {
+		added <- s.Add(slow, &workq.BgJob{ID: id1, Name: "j1", TTR: 1, TTL: 1})
+	}()
+
+	<-received
+	lenc := make(chan int)
+	go func() {
+		lenc <- s.Len()
+	}()
+	select {
+	case <-lenc:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected spool unlocked while sending")
+	}
+
+	close(release)
+	if err := <-added; err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+}
@@ -0,0 +1,172 @@
+package workqtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// FakeClock is a workq.Clock whose time only moves by Advance, firing due
+// timers and tickers, for deterministic tests of backoffs, health checks and
+// grace periods without sleeping:
+//
+//	clock := workqtest.NewFakeClock(time.Now())
+//	pool := workq.NewPool(addr, config, workq.WithClock(clock))
+//	clock.BlockUntil(1) // Health check ticker started.
+//	clock.Advance(config.HealthCheckInterval)
+//
+// Safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // Signalled when timers are added.
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	c      chan time.Time
+	at     time.Time
+	period time.Duration // Ticker interval, 0 for timers.
+}
+
+// NewFakeClock returns a FakeClock starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer firing once the clock advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) workq.Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker returns a ticker ticking every d the clock advances.
+func (c *FakeClock) NewTicker(d time.Duration) workq.Ticker {
+	if d <= 0 {
+		panic("workqtest: non-positive interval for NewTicker")
+	}
+
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *FakeClock) add(d time.Duration, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{
+		clock:  c,
+		c:      make(chan time.Time, 1),
+		at:     c.now.Add(d),
+		period: period,
+	}
+	if d <= 0 && period == 0 {
+		t.c <- c.now
+		return t
+	}
+
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing due timers and tickers in
+// order of their due time. As with time.Ticker, ticks are dropped for slow
+// receivers.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		i := c.next(end)
+		if i < 0 {
+			break
+		}
+
+		t := c.timers[i]
+		c.now = t.at
+		select {
+		case t.c <- t.at:
+		default:
+		}
+
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+		} else {
+			c.remove(i)
+		}
+	}
+
+	c.now = end
+}
+
+// Index of the earliest timer due by end, -1 if none.
+func (c *FakeClock) next(end time.Time) int {
+	next := -1
+	for i, t := range c.timers {
+		if t.at.After(end) {
+			continue
+		}
+		if next < 0 || t.at.Before(c.timers[next].at) {
+			next = i
+		}
+	}
+
+	return next
+}
+
+func (c *FakeClock) remove(i int) {
+	c.timers = append(c.timers[:i], c.timers[i+1:]...)
+}
+
+// Pending returns the number of timers and tickers not fired or stopped.
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil blocks until at least n timers and tickers are pending, e.g. to
+// wait for a goroutine to start waiting on the clock before advancing it.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop stops the timer, returning false if it already fired or was stopped.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.remove(i)
+			return true
+		}
+	}
+
+	return false
+}
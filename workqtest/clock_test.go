@@ -0,0 +1,87 @@
+package workqtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(time.Second)
+	ticker := clock.NewTicker(400 * time.Millisecond)
+	if clock.Pending() != 3 {
+		t.Fatalf("Pending mismatch, n=%d", clock.Pending())
+	}
+	if !stopped.Stop() || stopped.Stop() {
+		t.Fatalf("Stop mismatch")
+	}
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatalf("Timer fired early")
+	default:
+	}
+	if at := <-ticker.C(); !at.Equal(start.Add(400 * time.Millisecond)) {
+		t.Fatalf("Tick mismatch, at=%s", at)
+	}
+
+	clock.Advance(time.Millisecond)
+	if at := <-timer.C(); !at.Equal(start.Add(time.Second)) {
+		t.Fatalf("Timer mismatch, at=%s", at)
+	}
+	if timer.Stop() {
+		t.Fatalf("Stop mismatch, expected fired")
+	}
+	if !clock.Now().Equal(start.Add(time.Second)) || clock.Pending() != 1 {
+		t.Fatalf("Clock mismatch, now=%s, pending=%d", clock.Now(), clock.Pending())
+	}
+
+	ticker.Stop()
+	if clock.Pending() != 0 {
+		t.Fatalf("Pending mismatch, n=%d", clock.Pending())
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		workq.Sleep(clock, time.Hour)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	<-done
+}
+
+func TestFakeClockPoolMaxAge(t *testing.T) {
+	server := startProxyTestServer(t)
+	defer server.Close()
+
+	clock := NewFakeClock(time.Now())
+	pool := workq.NewPool(server.Addr().String(), workq.PoolConfig{MaxAge: time.Minute}, workq.WithClock(clock))
+	defer pool.Close()
+
+	c1, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get mismatch, err=%s", err)
+	}
+	pool.Put(c1)
+	if c, _ := pool.Get(); c != c1 {
+		t.Fatalf("Expected reused connection")
+	}
+	pool.Put(c1)
+
+	clock.Advance(time.Minute + time.Second)
+	c2, err := pool.Get()
+	if err != nil || c2 == c1 {
+		t.Fatalf("Expected expired connection replaced, err=%v", err)
+	}
+	pool.Put(c2)
+}
@@ -0,0 +1,193 @@
+package workqtest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ScriptedConn is a net.Conn replaying a script of replies and read errors
+// in sequence, capturing all writes, for testing Workq interactions at the
+// wire level without a responder goroutine:
+//
+//	conn := workqtest.NewScriptedConn().
+//		Reply(workqtest.OK()).
+//		ReadError(io.ErrUnexpectedEOF)
+//	client := workq.NewClient(conn)
+//
+// Reads return io.EOF once the script is exhausted. Safe for concurrent use.
+type ScriptedConn struct {
+	mu        sync.Mutex
+	script    []scriptStep
+	writes    [][]byte
+	writeErrs map[int]error
+	closed    bool
+}
+
+// Reply or read error, in script order.
+type scriptStep struct {
+	data []byte
+	err  error
+}
+
+// NewScriptedConn returns a ScriptedConn with an empty script.
+func NewScriptedConn() *ScriptedConn {
+	return &ScriptedConn{writeErrs: make(map[int]error)}
+}
+
+// Reply appends raw replies to the script, read in order, e.g. OK() or
+// Result(...).
+func (c *ScriptedConn) Reply(replies ...[]byte) *ScriptedConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range replies {
+		c.script = append(c.script, scriptStep{data: append([]byte(nil), b...)})
+	}
+
+	return c
+}
+
+// ReadError appends err to the script, returned by the read reaching it
+// once all replies before it were read.
+func (c *ScriptedConn) ReadError(err error) *ScriptedConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.script = append(c.script, scriptStep{err: err})
+	return c
+}
+
+// WriteError fails the nth write with err, counting writes from 1.
+// The failed write is not captured.
+func (c *ScriptedConn) WriteError(n int, err error) *ScriptedConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeErrs[n] = err
+	return c
+}
+
+// Read reads the next reply in the script, or returns the next read error.
+func (c *ScriptedConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	for len(c.script) > 0 {
+		step := &c.script[0]
+		if step.err != nil {
+			err := step.err
+			c.script = c.script[1:]
+			return 0, err
+		}
+
+		if len(step.data) == 0 {
+			c.script = c.script[1:]
+			continue
+		}
+
+		n := copy(b, step.data)
+		step.data = step.data[n:]
+		return n, nil
+	}
+
+	return 0, io.EOF
+}
+
+// Write captures b, or fails if scripted by WriteError.
+func (c *ScriptedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	n := len(c.writes) + 1
+	if err, ok := c.writeErrs[n]; ok {
+		delete(c.writeErrs, n)
+		c.writes = append(c.writes, nil)
+		return 0, err
+	}
+
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// Writes returns the captured writes in order, nil for failed writes.
+func (c *ScriptedConn) Writes() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.writes...)
+}
+
+// Written returns all captured writes concatenated, e.g. to compare with the
+// expected commands.
+func (c *ScriptedConn) Written() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Join(c.writes, nil)
+}
+
+// Unread returns the number of scripted reply bytes not read yet.
+func (c *ScriptedConn) Unread() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for _, step := range c.script {
+		n += len(step.data)
+	}
+
+	return n
+}
+
+// Closed returns whether Close was called.
+func (c *ScriptedConn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Close closes the conn, failing further reads and writes.
+func (c *ScriptedConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// LocalAddr returns a placeholder address.
+func (c *ScriptedConn) LocalAddr() net.Addr {
+	return scriptedAddr{}
+}
+
+// RemoteAddr returns a placeholder address.
+func (c *ScriptedConn) RemoteAddr() net.Addr {
+	return scriptedAddr{}
+}
+
+// SetDeadline is a no-op, scripted reads never block.
+func (c *ScriptedConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is a no-op.
+func (c *ScriptedConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is a no-op.
+func (c *ScriptedConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type scriptedAddr struct{}
+
+func (scriptedAddr) Network() string {
+	return "scripted"
+}
+
+func (scriptedAddr) String() string {
+	return "scripted"
+}
@@ -0,0 +1,60 @@
+package workqtest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+func TestScriptedConn(t *testing.T) {
+	conn := NewScriptedConn().
+		Reply(OK(), Result(testID, true, []byte("b"))).
+		ReadError(io.ErrUnexpectedEOF)
+	client := workq.NewClient(conn)
+
+	if err := client.Delete(testID); err != nil {
+		t.Fatalf("Delete mismatch, err=%s", err)
+	}
+	r, err := client.Result(testID, 1000)
+	if err != nil || !r.Success || string(r.Result) != "b" {
+		t.Fatalf("Result mismatch, r=%+v, err=%v", r, err)
+	}
+	if _, err := client.Lease([]string{"q"}, 1000); err == nil || err.Error() != "lease: Net Error: unexpected EOF" {
+		t.Fatalf("Lease mismatch, err=%v", err)
+	}
+
+	exp := [][]byte{
+		[]byte("delete " + testID + "\r\n"),
+		[]byte("result " + testID + " 1000\r\n"),
+		[]byte("lease q 1000\r\n"),
+	}
+	if !reflect.DeepEqual(exp, conn.Writes()) {
+		t.Fatalf("Writes mismatch, act=%q", conn.Writes())
+	}
+	if !bytes.Equal(bytes.Join(exp, nil), conn.Written()) || conn.Unread() != 0 {
+		t.Fatalf("Written mismatch, act=%q, unread=%d", conn.Written(), conn.Unread())
+	}
+
+	client.Close()
+	if !conn.Closed() {
+		t.Fatalf("Expected conn closed")
+	}
+}
+
+func TestScriptedConnWriteError(t *testing.T) {
+	conn := NewScriptedConn().Reply(OK()).WriteError(1, errors.New("broken pipe"))
+	client := workq.NewClient(conn)
+	if err := client.Delete(testID); err == nil || err.Error() != "delete "+testID+": Net Error: broken pipe" {
+		t.Fatalf("Delete mismatch, err=%v", err)
+	}
+	if w := conn.Writes(); len(w) != 1 || w[0] != nil {
+		t.Fatalf("Writes mismatch, act=%q", w)
+	}
+	if conn.Unread() != len(OK()) {
+		t.Fatalf("Unread mismatch, n=%d", conn.Unread())
+	}
+}
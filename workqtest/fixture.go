@@ -0,0 +1,134 @@
+package workqtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Fixture is a golden request and response frame of a single command,
+// loaded from a testdata file by LoadFixture.
+//
+// A fixture file holds a "-- request --" and a "-- response --" section,
+// optionally preceded by a comment. Every line of a section is terminated by
+// "\r\n" as sent on the wire:
+//
+//	Add a background job.
+//	-- request --
+//	add 6ba7b810-9dad-11d1-80b4-00c04fd430c4 ping 5000 60000 4
+//	pong
+//	-- response --
+//	+OK
+type Fixture struct {
+	Name     string // File name without extension.
+	Comment  string
+	Request  []byte
+	Response []byte
+}
+
+// LoadFixture loads the fixture file at path, failing t if the file can't
+// be read or parsed.
+func LoadFixture(t testing.TB, path string) *Fixture {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("workqtest: %s", err)
+	}
+
+	f, err := parseFixture(b)
+	if err != nil {
+		t.Fatalf("workqtest: %s: %s", path, err)
+	}
+
+	f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return f
+}
+
+// LoadFixtures loads all fixture files matching pattern, e.g.
+// "testdata/protocol/*.txt", ordered by file name.
+func LoadFixtures(t testing.TB, pattern string) []*Fixture {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("workqtest: %s", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("workqtest: No fixtures match %q", pattern)
+	}
+
+	fixtures := make([]*Fixture, 0, len(paths))
+	for _, path := range paths {
+		fixtures = append(fixtures, LoadFixture(t, path))
+	}
+
+	return fixtures
+}
+
+// AssertRoundTrip calls fn with a Client replying with f.Response, failing t
+// unless fn succeeds, the client writes exactly f.Request and reads all of
+// f.Response. fn decodes the response by calling the command and asserts the
+// decoded values.
+func AssertRoundTrip(t testing.TB, f *Fixture, fn func(c *workq.Client) error) {
+	t.Helper()
+	conn := NewScriptedConn().Reply(f.Response)
+	client := workq.NewClient(conn)
+	if err := fn(client); err != nil {
+		t.Fatalf("Fixture %s mismatch, err=%s", f.Name, err)
+	}
+	client.Close()
+
+	if !bytes.Equal(f.Request, conn.Written()) {
+		t.Fatalf("Fixture %s request mismatch, act=%q, exp=%q", f.Name, conn.Written(), f.Request)
+	}
+	if n := conn.Unread(); n != 0 {
+		t.Fatalf("Fixture %s response not fully read, unread=%q", f.Name, f.Response[len(f.Response)-n:])
+	}
+}
+
+// Parse the sections of a fixture file.
+func parseFixture(b []byte) (*Fixture, error) {
+	f := &Fixture{}
+	var comment []string
+	var section *[]byte
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		switch line {
+		case "-- request --":
+			if f.Request != nil {
+				return nil, fmt.Errorf("Duplicate request section")
+			}
+
+			f.Request = []byte{}
+			section = &f.Request
+			continue
+		case "-- response --":
+			if f.Response != nil {
+				return nil, fmt.Errorf("Duplicate response section")
+			}
+
+			f.Response = []byte{}
+			section = &f.Response
+			continue
+		}
+
+		if section == nil {
+			comment = append(comment, line)
+			continue
+		}
+
+		*section = append(*section, line+"\r\n"...)
+	}
+
+	if f.Request == nil || f.Response == nil {
+		return nil, fmt.Errorf("Missing request or response section")
+	}
+
+	f.Comment = strings.TrimSpace(strings.Join(comment, "\n"))
+	return f, nil
+}
@@ -0,0 +1,120 @@
+package workqtest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Command calls decoding each fixture in testdata/protocol.
+var fixtureCalls = map[string]func(c *workq.Client) error{
+	"add": func(c *workq.Client) error {
+		return c.Add(&workq.BgJob{ID: testID, Name: "j1", TTR: 60, TTL: 60000, Payload: []byte("a")})
+	},
+	"add-flags": func(c *workq.Client) error {
+		return c.Add(&workq.BgJob{
+			ID:          testID,
+			Name:        "j1",
+			TTR:         60,
+			TTL:         60000,
+			Payload:     []byte("a"),
+			Priority:    10,
+			MaxAttempts: 3,
+		})
+	},
+	"run": func(c *workq.Client) error {
+		r, err := c.Run(&workq.FgJob{ID: testID, Name: "j1", TTR: 60, Timeout: 1000, Payload: []byte("a")})
+		if err != nil {
+			return err
+		}
+
+		return expectResult(r, true, "b")
+	},
+	"schedule": func(c *workq.Client) error {
+		return c.Schedule(&workq.ScheduledJob{
+			ID:      testID,
+			Name:    "j1",
+			TTR:     5000,
+			TTL:     60000,
+			Time:    "2016-01-02T15:04:05Z",
+			Payload: []byte("a"),
+		})
+	},
+	"result": func(c *workq.Client) error {
+		r, err := c.Result(testID, 1000)
+		if err != nil {
+			return err
+		}
+
+		return expectResult(r, false, "fail")
+	},
+	"lease": func(c *workq.Client) error {
+		j, err := c.Lease([]string{"j1", "j2"}, 1000)
+		if err != nil {
+			return err
+		}
+
+		if j.ID != testID || j.Name != "j2" || j.TTR != 60 || string(j.Payload) != "a" {
+			return fmt.Errorf("Leased job mismatch, j=%+v", j)
+		}
+		return nil
+	},
+	"complete": func(c *workq.Client) error {
+		return c.Complete(testID, []byte("b"))
+	},
+	"fail": func(c *workq.Client) error {
+		return c.Fail(testID, []byte{})
+	},
+	"delete-not-found": func(c *workq.Client) error {
+		err := c.Delete(testID)
+		if rerr, ok := err.(*workq.ResponseError); !ok || rerr.Code() != "NOT-FOUND" {
+			return fmt.Errorf("Error mismatch, err=%v", err)
+		}
+		return nil
+	},
+}
+
+func expectResult(r *workq.JobResult, success bool, result string) error {
+	if r.ID != testID || r.Success != success || string(r.Result) != result {
+		return fmt.Errorf("Result mismatch, r=%+v", r)
+	}
+
+	return nil
+}
+
+func TestProtocolFixtures(t *testing.T) {
+	fixtures := LoadFixtures(t, "testdata/protocol/*.txt")
+	if len(fixtures) != len(fixtureCalls) {
+		t.Fatalf("Fixtures mismatch, len=%d", len(fixtures))
+	}
+
+	for _, f := range fixtures {
+		fn, ok := fixtureCalls[f.Name]
+		if !ok {
+			t.Fatalf("No call for fixture %s", f.Name)
+		}
+
+		AssertRoundTrip(t, f, fn)
+	}
+}
+
+func TestParseFixture(t *testing.T) {
+	f, err := parseFixture([]byte("A comment.\n-- request --\ndelete x\n-- response --\n+OK\n"))
+	if err != nil {
+		t.Fatalf("Parse mismatch, err=%s", err)
+	}
+	if f.Comment != "A comment." || !bytes.Equal(f.Request, []byte("delete x\r\n")) || !bytes.Equal(f.Response, OK()) {
+		t.Fatalf("Fixture mismatch, f=%+v", f)
+	}
+
+	for _, b := range []string{
+		"-- request --\ndelete x\n",
+		"-- request --\n-- response --\n-- request --\n",
+	} {
+		if _, err := parseFixture([]byte(b)); err == nil {
+			t.Fatalf("Parse mismatch, expected error for %q", b)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package workqtest
+
+import (
+	"fmt"
+
+	"github.com/iamduo/go-workq"
+)
+
+const testResultID = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+
+// CheckResponse replies to each command of a Client with data, in strict and
+// lenient parse mode, returning an error describing the first reply parsed
+// without error but not valid, e.g. with an invalid job ID. Panics of the
+// parser are not recovered.
+//
+// Call from a fuzz test to fuzz the parser, see FuzzParseResponse in the
+// tests of this package:
+//
+//	f.Fuzz(func(t *testing.T, data []byte) {
+//		if err := workqtest.CheckResponse(data); err != nil {
+//			t.Fatal(err)
+//		}
+//	})
+func CheckResponse(data []byte) error {
+	for _, mode := range []workq.ParseMode{workq.ParseStrict, workq.ParseLenient} {
+		for _, cmd := range responseChecks {
+			c := workq.NewClient(NewScriptedConn().Reply(data), workq.WithParseMode(mode))
+			err := cmd.check(c)
+			c.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %s, data=%q", cmd.name, err, data)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Commands checked by CheckResponse.
+var responseChecks = []struct {
+	name  string
+	check func(c *workq.Client) error
+}{
+	{"add", func(c *workq.Client) error {
+		return checkError(c.Add(&workq.BgJob{ID: testResultID, Name: "q", TTR: 1, TTL: 1}))
+	}},
+	{"run", func(c *workq.Client) error {
+		r, err := c.Run(&workq.FgJob{ID: testResultID, Name: "q", TTR: 1, Timeout: 1})
+		if err != nil {
+			return checkError(err)
+		}
+
+		return checkResult(r)
+	}},
+	{"run-results", func(c *workq.Client) error {
+		rs, err := c.RunResults(&workq.FgJob{ID: testResultID, Name: "q", TTR: 1, Timeout: 1})
+		if err != nil {
+			return checkError(err)
+		}
+
+		for _, r := range rs {
+			if err := checkResult(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"result", func(c *workq.Client) error {
+		r, err := c.Result(testResultID, 1)
+		if err != nil {
+			return checkError(err)
+		}
+
+		return checkResult(r)
+	}},
+	{"lease", func(c *workq.Client) error {
+		j, err := c.Lease([]string{"q"}, 1)
+		if err != nil {
+			return checkError(err)
+		}
+
+		if workq.ValidateID(j.ID) != nil {
+			return fmt.Errorf("Invalid job ID %q", j.ID)
+		}
+		if workq.ValidateName(j.Name) != nil {
+			return fmt.Errorf("Invalid job name %q", j.Name)
+		}
+		return nil
+	}},
+	{"delete", func(c *workq.Client) error {
+		return checkError(c.Delete(testResultID))
+	}},
+}
+
+func checkResult(r *workq.JobResult) error {
+	if workq.ValidateID(r.ID) != nil {
+		return fmt.Errorf("Invalid result ID %q", r.ID)
+	}
+
+	return nil
+}
+
+// Response errors must be printable, the code non empty.
+func checkError(err error) error {
+	resp, ok := err.(*workq.ResponseError)
+	if !ok {
+		return nil
+	}
+
+	if resp.Code() == "" {
+		return fmt.Errorf("Empty error code")
+	}
+	if !printable(resp.Code()) || !printable(resp.Text()) {
+		return fmt.Errorf("Unprintable error %q", resp.Error())
+	}
+	return nil
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
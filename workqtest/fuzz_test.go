@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package workqtest_test
+
+import (
+	"testing"
+
+	"github.com/iamduo/go-workq/workqtest"
+)
+
+const testResultID = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+
+// Seed responses, the corpus in testdata/fuzz extends these with inputs found
+// by fuzzing.
+var responseSeeds = []string{
+	"+OK\r\n",
+	"-NOT-FOUND\r\n",
+	"-CLIENT-ERROR Invalid job name\r\n",
+	"+OK 1\r\n" + testResultID + " 1 1\r\na\r\n",
+	"+OK 1\r\n" + testResultID + " 0 0\r\n\r\n",
+	"+OK 2\r\n" + testResultID + " 1 1\r\na\r\n" + testResultID + " 0 1\r\nb\r\n",
+	"+OK 1\r\n" + testResultID + " ping 5000 4\r\npong\r\n",
+	"+OK 999999999999999999\r\n",
+	"+OK 1\r\n" + testResultID + " 1 1048577\r\n",
+	"+OK 1\n" + testResultID + " 1 1\na\n",
+	"+OK 1\r\n" + testResultID + " q\x00 1 1\r\na\r\n",
+	"-TIMEOUT\x00\r\n",
+	"+OK 1\r\n" + testResultID + " 1 3\r\na",
+}
+
+// FuzzParseResponse fuzzes the response parsing of a Client by replying to
+// each command with the fuzzed input, in strict and lenient parse mode.
+func FuzzParseResponse(f *testing.F) {
+	for _, seed := range responseSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := workqtest.CheckResponse(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+// Package workqtest provides utilities for testing code that depends on a
+// workq.Client without a running Workq server.
+package workqtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Position of the <size> argument for commands carrying a data block.
+var blockSizeArg = map[string]int{
+	"add":      4,
+	"run":      4,
+	"schedule": 5,
+	"complete": 1,
+	"fail":     1,
+}
+
+// Request is a single command received from a client.
+type Request struct {
+	Name string   // Command name, e.g. "add".
+	Args []string // Space separated arguments following the command name.
+	Data []byte   // Data block, nil for commands without one.
+}
+
+// Handler returns the raw response to write back for a request.
+// Returning nil closes the connection.
+type Handler func(*Request) []byte
+
+// PipeClient returns a Client connected over net.Pipe to an in-memory
+// responder calling handler for each command received.
+// The responder exits when the client is closed.
+func PipeClient(handler Handler) *workq.Client {
+	client, server := net.Pipe()
+	go serve(server, handler)
+	return workq.NewClient(client)
+}
+
+func serve(conn net.Conn, handler Handler) {
+	defer conn.Close()
+	rdr := bufio.NewReader(conn)
+	for {
+		req, err := readRequest(rdr)
+		if err != nil {
+			return
+		}
+
+		resp := handler(req)
+		if resp == nil {
+			return
+		}
+
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Read a command line and its data block if any.
+func readRequest(rdr *bufio.Reader) (*Request, error) {
+	line, err := rdr.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	split := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	req := &Request{Name: split[0], Args: split[1:]}
+	i, ok := blockSizeArg[req.Name]
+	if !ok {
+		return req, nil
+	}
+
+	if i >= len(req.Args) {
+		return nil, fmt.Errorf("workqtest: missing data block size in %q", line)
+	}
+
+	size, err := strconv.Atoi(req.Args[i])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("workqtest: invalid data block size in %q", line)
+	}
+
+	block := make([]byte, size+2)
+	if _, err := io.ReadFull(rdr, block); err != nil {
+		return nil, err
+	}
+
+	req.Data = block[:size]
+	return req, nil
+}
+
+// OK returns a "+OK" response.
+func OK() []byte {
+	return []byte("+OK\r\n")
+}
+
+// Error returns an error response, e.g. "-NOT-FOUND".
+func Error(code string, text string) []byte {
+	if text != "" {
+		return []byte("-" + code + " " + text + "\r\n")
+	}
+
+	return []byte("-" + code + "\r\n")
+}
+
+// Result returns a single job result response as replied by "run" and "result".
+func Result(id string, success bool, result []byte) []byte {
+	var s int
+	if success {
+		s = 1
+	}
+
+	return []byte(fmt.Sprintf(
+		"+OK 1\r\n%s %d %d\r\n%s\r\n",
+		id,
+		s,
+		len(result),
+		result,
+	))
+}
+
+// LeasedJob returns a single leased job response as replied by "lease".
+func LeasedJob(id string, name string, ttr int, payload []byte) []byte {
+	return []byte(fmt.Sprintf(
+		"+OK 1\r\n%s %s %d %d\r\n%s\r\n",
+		id,
+		name,
+		ttr,
+		len(payload),
+		payload,
+	))
+}
@@ -0,0 +1,83 @@
+package workqtest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+const testID = "6ba7b810-9dad-11d1-80b4-00c04fd430c4"
+
+func TestPipeClient(t *testing.T) {
+	var reqs []*Request
+	client := PipeClient(func(req *Request) []byte {
+		reqs = append(reqs, req)
+		switch req.Name {
+		case "add":
+			return OK()
+		case "lease":
+			return LeasedJob(testID, "j1", 5000, []byte("a"))
+		case "result":
+			return Result(testID, true, []byte("b"))
+		}
+
+		return Error("CLIENT-ERROR", "Unknown command")
+	})
+	defer client.Close()
+
+	err := client.Add(&workq.BgJob{
+		ID:      testID,
+		Name:    "j1",
+		TTR:     5000,
+		TTL:     60000,
+		Payload: []byte("a"),
+	})
+	if err != nil {
+		t.Fatalf("Add mismatch, err=%s", err)
+	}
+
+	j, err := client.Lease([]string{"j1"}, 1000)
+	if err != nil || j.ID != testID || j.Name != "j1" || j.TTR != 5000 || !bytes.Equal(j.Payload, []byte("a")) {
+		t.Fatalf("Lease mismatch, job=%+v, err=%s", j, err)
+	}
+
+	r, err := client.Result(testID, 1000)
+	if err != nil || !r.Success || !bytes.Equal(r.Result, []byte("b")) {
+		t.Fatalf("Result mismatch, result=%+v, err=%s", r, err)
+	}
+
+	err = client.Delete(testID)
+	if err == nil || err.Error() != "delete "+testID+": CLIENT-ERROR Unknown command" {
+		t.Fatalf("Delete mismatch, err=%v", err)
+	}
+
+	expReqs := []*Request{
+		{Name: "add", Args: []string{testID, "j1", "5000", "60000", "1"}, Data: []byte("a")},
+		{Name: "lease", Args: []string{"j1", "1000"}},
+		{Name: "result", Args: []string{testID, "1000"}},
+		{Name: "delete", Args: []string{testID}},
+	}
+	if !reflect.DeepEqual(expReqs, reqs) {
+		t.Fatalf("Request mismatch, act=%+v", reqs)
+	}
+}
+
+func TestPipeClientClosedByHandler(t *testing.T) {
+	client := PipeClient(func(req *Request) []byte {
+		return nil
+	})
+	defer client.Close()
+
+	err := client.Delete(testID)
+	if _, ok := err.(*workq.NetError); !ok {
+		t.Fatalf("Error mismatch, err=%+v", err)
+	}
+}
+
+func TestError(t *testing.T) {
+	if string(Error("NOT-FOUND", "")) != "-NOT-FOUND\r\n" {
+		t.Fatalf("Error mismatch, act=%q", Error("NOT-FOUND", ""))
+	}
+}
@@ -0,0 +1,194 @@
+package workqtest
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Proxy is a TCP proxy between clients and a Workq server injecting faults
+// into responses on demand, e.g. for integration tests of WithReconnect and
+// the recovery from malformed responses:
+//
+//	proxy, err := workqtest.NewProxy("localhost:9922")
+//	...
+//	client, err := workq.Connect(proxy.Addr(), workq.WithReconnect())
+//	proxy.CorruptNext()
+//
+// Faults apply to the next response data forwarded on any connection.
+type Proxy struct {
+	target string
+	ln     net.Listener
+
+	mu      sync.Mutex
+	latency time.Duration
+	corrupt bool
+	drop    int // Bytes forwarded before dropping, -1 for none.
+	conns   map[net.Conn]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewProxy returns a Proxy listening on a random local port, forwarding
+// connections to the server at target.
+func NewProxy(target string) (*Proxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		target: target,
+		ln:     ln,
+		drop:   -1,
+		conns:  make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr returns the address clients connect to.
+func (p *Proxy) Addr() string {
+	return p.ln.Addr().String()
+}
+
+// SetLatency delays all response data by d, 0 to disable.
+func (p *Proxy) SetLatency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latency = d
+}
+
+// CorruptNext flips the bits of the first byte of the next response data,
+// desyncing the client from the server.
+func (p *Proxy) CorruptNext() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.corrupt = true
+}
+
+// DropNext closes the connection forwarding the next response data after
+// forwarding its first n bytes, e.g. to cut a response mid-frame.
+func (p *Proxy) DropNext(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drop = n
+}
+
+// DropAll closes all proxied connections, leaving the proxy accepting new
+// ones.
+func (p *Proxy) DropAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+}
+
+// Close stops accepting connections, closes all proxied connections and
+// waits for them to finish.
+func (p *Proxy) Close() error {
+	err := p.ln.Close()
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.DropAll()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		p.track(client, server)
+		p.wg.Add(2)
+		go func() {
+			defer p.wg.Done()
+			io.Copy(server, client)
+			p.untrack(client, server)
+		}()
+		go func() {
+			defer p.wg.Done()
+			p.forward(client, server)
+			p.untrack(client, server)
+		}()
+	}
+}
+
+// Forward response data from src to dst, injecting faults.
+func (p *Proxy) forward(dst net.Conn, src net.Conn) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			b := buf[:n]
+			latency, corrupt, drop := p.faults()
+			if latency > 0 {
+				time.Sleep(latency)
+			}
+			if corrupt {
+				b[0] ^= 0xff
+			}
+			if drop >= 0 {
+				if drop < len(b) {
+					b = b[:drop]
+				}
+
+				dst.Write(b)
+				return
+			}
+
+			if _, err := dst.Write(b); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Take the faults to inject into the next response data.
+func (p *Proxy) faults() (time.Duration, bool, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	corrupt, drop := p.corrupt, p.drop
+	p.corrupt, p.drop = false, -1
+	return p.latency, corrupt, drop
+}
+
+func (p *Proxy) track(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		if p.closed {
+			conn.Close()
+			continue
+		}
+
+		p.conns[conn] = struct{}{}
+	}
+}
+
+// Close and forget conns, unblocking the other direction.
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+		delete(p.conns, conn)
+	}
+}
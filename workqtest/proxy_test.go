@@ -0,0 +1,112 @@
+package workqtest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Serve OK to "delete" and a result to "result" commands.
+func startProxyTestServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go serve(conn, func(req *Request) []byte {
+				if req.Name == "result" {
+					return Result(testID, true, []byte("abcdef"))
+				}
+
+				return OK()
+			})
+		}
+	}()
+	return ln
+}
+
+func TestProxyFaults(t *testing.T) {
+	server := startProxyTestServer(t)
+	defer server.Close()
+	proxy, err := NewProxy(server.Addr().String())
+	if err != nil {
+		t.Fatalf("NewProxy mismatch, err=%s", err)
+	}
+	defer proxy.Close()
+
+	client, err := workq.Connect(proxy.Addr(), workq.WithReconnect())
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	if err := client.Delete(testID); err != nil {
+		t.Fatalf("Delete mismatch, err=%s", err)
+	}
+
+	proxy.CorruptNext()
+	if err := client.Delete(testID); err != workq.ErrMalformed {
+		t.Fatalf("Corrupt mismatch, err=%v", err)
+	}
+	if err := client.Delete(testID); err != nil {
+		t.Fatalf("Delete after corrupt mismatch, err=%s", err)
+	}
+
+	proxy.DropNext(10)
+	if _, err := client.Result(testID, 1000); err == nil {
+		t.Fatalf("Drop mismatch, expected error")
+	} else if _, ok := err.(*workq.NetError); !ok {
+		t.Fatalf("Drop mismatch, err=%v", err)
+	}
+	if r, err := client.Result(testID, 1000); err != nil || string(r.Result) != "abcdef" {
+		t.Fatalf("Result after drop mismatch, r=%+v, err=%v", r, err)
+	}
+
+	proxy.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	if err := client.Delete(testID); err != nil {
+		t.Fatalf("Delete mismatch, err=%s", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("Latency mismatch, d=%s", d)
+	}
+}
+
+func TestProxyDropAll(t *testing.T) {
+	server := startProxyTestServer(t)
+	defer server.Close()
+	proxy, err := NewProxy(server.Addr().String())
+	if err != nil {
+		t.Fatalf("NewProxy mismatch, err=%s", err)
+	}
+
+	client, err := workq.Connect(proxy.Addr(), workq.WithReconnect())
+	if err != nil {
+		t.Fatalf("Unable to connect, err=%s", err)
+	}
+	defer client.Close()
+
+	proxy.DropAll()
+	if err := client.Delete(testID); err == nil {
+		t.Fatalf("Delete mismatch, expected error")
+	}
+	if err := client.Delete(testID); err != nil {
+		t.Fatalf("Delete after drop mismatch, err=%s", err)
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close mismatch, err=%s", err)
+	}
+	if err := client.Delete(testID); err == nil {
+		t.Fatalf("Delete mismatch, expected error after close")
+	}
+}
@@ -0,0 +1,296 @@
+// Package workqws tunnels the Workq protocol over WebSocket frames so clients
+// can reach a server behind HTTP-only ingress or load balancers.
+//
+// The server side is expected to be a WebSocket to TCP bridge forwarding
+// binary frames as-is to a Workq server. Connections are passed to
+// workq.NewClient:
+//
+//	conn, err := workqws.Dial("wss://example.com/workq", nil)
+//	if err != nil {
+//		// ...
+//	}
+//	client := workq.NewClient(conn)
+package workqws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	// Max control frame payload as defined by RFC 6455.
+	maxControlPayload = 125
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	// ErrBadHandshake is returned when the server does not accept the
+	// WebSocket upgrade.
+	ErrBadHandshake = errors.New("Bad WebSocket handshake")
+
+	// ErrProtocol is returned when a frame violates the WebSocket protocol.
+	ErrProtocol = errors.New("WebSocket protocol error")
+)
+
+// Conn is a client side WebSocket connection implementing io.ReadWriteCloser.
+// Writes are sent as single binary frames, reads return data frame payloads
+// as a continuous stream.
+type Conn struct {
+	conn net.Conn
+	rdr  *bufio.Reader
+
+	wmu sync.Mutex // Guards writes, pongs are written from Read.
+
+	remaining uint64 // Unread payload bytes of the current data frame.
+	mask      [4]byte
+	masked    bool
+	maskPos   int
+}
+
+// Dial opens a WebSocket connection to a "ws" or "wss" URL with optional extra
+// HTTP headers sent in the upgrade request.
+func Dial(rawurl string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = net.Dial("tcp", hostPort(u, "80"))
+	case "wss":
+		conn, err = tls.Dial("tcp", hostPort(u, "443"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("workqws: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewConn(conn, u, header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewConn performs the WebSocket handshake for u over an established conn.
+func NewConn(conn net.Conn, u *url.URL, header http.Header) (*Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	rdr := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(rdr, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, ErrBadHandshake
+	}
+
+	return &Conn{conn: conn, rdr: rdr}, nil
+}
+
+// Read reads payload bytes from data frames, answering pings in between.
+// Returns io.EOF once the server closes the connection.
+func (c *Conn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextDataFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+
+	n, err := c.rdr.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos%4]
+			c.maskPos++
+		}
+	}
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// Write sends b as a single binary frame.
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(opBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// Read frame headers until a data frame with a payload is reached.
+func (c *Conn) nextDataFrame() error {
+	var h [2]byte
+	if _, err := io.ReadFull(c.rdr, h[:]); err != nil {
+		return err
+	}
+
+	op := h[0] & 0x0F
+	c.masked = h[1]&0x80 != 0
+	size := uint64(h[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rdr, ext[:]); err != nil {
+			return err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rdr, ext[:]); err != nil {
+			return err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if c.masked {
+		if _, err := io.ReadFull(c.rdr, c.mask[:]); err != nil {
+			return err
+		}
+	}
+	c.maskPos = 0
+
+	switch op {
+	case opContinuation, opText, opBinary:
+		c.remaining = size
+		return nil
+	case opPing, opPong, opClose:
+		if size > maxControlPayload {
+			return ErrProtocol
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(c.rdr, payload); err != nil {
+			return err
+		}
+		if c.masked {
+			for i := range payload {
+				payload[i] ^= c.mask[i%4]
+			}
+		}
+
+		if op == opClose {
+			c.writeFrame(opClose, nil)
+			return io.EOF
+		}
+		if op == opPing {
+			return c.writeFrame(opPong, payload)
+		}
+
+		return nil
+	}
+
+	return ErrProtocol
+}
+
+// Write a single final frame, masked as required for clients.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|op)
+	size := len(payload)
+	switch {
+	case size <= maxControlPayload:
+		frame = append(frame, 0x80|byte(size))
+	case size <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(size>>8), byte(size))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(size))
+		frame = append(frame, 0x80|127)
+		frame = append(frame, ext[:]...)
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
@@ -0,0 +1,162 @@
+package workqws
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/iamduo/go-workq"
+)
+
+// Serve a single WebSocket connection calling fn after the handshake.
+func testServer(t *testing.T, fn func(rdr *bufio.Reader, conn net.Conn)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rdr := bufio.NewReader(conn)
+		req, err := http.ReadRequest(rdr)
+		if err != nil {
+			return
+		}
+
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + acceptKey(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"))
+		fn(rdr, conn)
+	}()
+
+	return ln
+}
+
+// Read a masked client frame returning its opcode and unmasked payload.
+func readClientFrame(rdr *bufio.Reader) (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(rdr, h[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := int(h[1] & 0x7F)
+	if size == 126 {
+		var ext [2]byte
+		io.ReadFull(rdr, ext[:])
+		size = int(ext[0])<<8 | int(ext[1])
+	}
+
+	var mask [4]byte
+	io.ReadFull(rdr, mask[:])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(rdr, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return h[0] & 0x0F, payload, nil
+}
+
+func serverFrame(op byte, payload string) []byte {
+	return append([]byte{0x80 | op, byte(len(payload))}, payload...)
+}
+
+func TestDial(t *testing.T) {
+	reqs := make(chan string, 1)
+	pongs := make(chan string, 1)
+	ln := testServer(t, func(rdr *bufio.Reader, conn net.Conn) {
+		op, payload, err := readClientFrame(rdr)
+		if err != nil || op != opBinary {
+			return
+		}
+		reqs <- string(payload)
+
+		// Split response across frames with a ping in between.
+		conn.Write(serverFrame(opBinary, "+O"))
+		conn.Write(serverFrame(opPing, "p"))
+		conn.Write(serverFrame(opBinary, "K\r\n"))
+		op, payload, err = readClientFrame(rdr)
+		if err == nil && op == opPong {
+			pongs <- string(payload)
+		}
+	})
+	defer ln.Close()
+
+	conn, err := Dial("ws://"+ln.Addr().String()+"/workq", nil)
+	if err != nil {
+		t.Fatalf("Unable to dial, err=%s", err)
+	}
+	defer conn.Close()
+
+	client := workq.NewClient(conn)
+	err = client.Delete("6ba7b810-9dad-11d1-80b4-00c04fd430c4")
+	if err != nil {
+		t.Fatalf("Response mismatch, err=%s", err)
+	}
+
+	if req := <-reqs; req != "delete 6ba7b810-9dad-11d1-80b4-00c04fd430c4\r\n" {
+		t.Fatalf("Request mismatch, act=%q", req)
+	}
+	if pong := <-pongs; pong != "p" {
+		t.Fatalf("Pong mismatch, act=%q", pong)
+	}
+}
+
+func TestReadClose(t *testing.T) {
+	ln := testServer(t, func(rdr *bufio.Reader, conn net.Conn) {
+		conn.Write(serverFrame(opClose, ""))
+		readClientFrame(rdr)
+	})
+	defer ln.Close()
+
+	conn, err := Dial("ws://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unable to dial, err=%s", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestDialBadHandshake(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to start test server, err=%s", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		http.ReadRequest(bufio.NewReader(conn))
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	}()
+
+	_, err = Dial("ws://"+ln.Addr().String(), nil)
+	if err != ErrBadHandshake {
+		t.Fatalf("Error mismatch, err=%v", err)
+	}
+}
+
+func TestDialUnsupportedScheme(t *testing.T) {
+	if _, err := Dial("http://localhost", nil); err == nil {
+		t.Fatalf("Expected unsupported scheme error")
+	}
+}